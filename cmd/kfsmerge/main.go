@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/nbcuni/kfs-flow-merge/kfsmerge"
 	"github.com/spf13/cobra"
@@ -12,13 +14,19 @@ import (
 
 var (
 	schemaPath       string
-	instanceAPath    string
+	rulesPath        string
+	instanceAPaths   []string
 	instanceBPath    string
+	layerSpecs       []string
 	outputPath       string
+	provenancePath   string
 	skipValidateA    bool
 	skipValidateB    bool
 	skipValidateR    bool
 	applyDefaultsStr string
+	maxDepth         int
+	bundleOutPath    string
+	lintFixPath      string
 	pretty           bool
 )
 
@@ -32,10 +40,34 @@ var rootCmd = &cobra.Command{
 	Use:   "kfsmerge",
 	Short: "Merge JSON instances according to a schema",
 	Long: `Merge two JSON instances according to a schema with x-kfs-merge rules.
-Instance A (request/override) is merged with B (base/template), with A taking precedence.`,
+Instance A (request/override) is merged with B (base/template), with A taking precedence.
+
+More than two instances can be merged as named layers, ordered from lowest to
+highest precedence: B first, then each --layer, then each -a. Layers are given
+as name=path or as a plain path, in which case the file name is used as the name.`,
 	RunE: runMerge,
 }
 
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Bundle a schema and the documents it references into one file",
+	Long: `Inline every definition the schema references from other documents into
+$defs and rewrite the references, producing a single self-contained schema.
+The bundle is checked to yield the same merge rules as the original.`,
+	RunE: runBundle,
+}
+
+var lintCmd = &cobra.Command{
+	Use:   "lint",
+	Short: "Report likely mistakes in the schema's merge rules",
+	Long: `Report likely mistakes in the schema's merge rules, one per line with the
+schema pointer it concerns. Exits with status 1 when there are warnings.
+
+With --fix, the suggested rules are written to a rules file usable with --rules,
+merged into the rules given with --rules, if any.`,
+	RunE: runLint,
+}
+
 var validateCmd = &cobra.Command{
 	Use:   "validate",
 	Short: "Validate JSON instances against the schema",
@@ -46,49 +78,52 @@ var validateCmd = &cobra.Command{
 func init() {
 	// Root command flags
 	rootCmd.PersistentFlags().StringVarP(&schemaPath, "schema", "s", "", "Path to JSON Schema file (required)")
-	rootCmd.PersistentFlags().StringVarP(&instanceAPath, "instance-a", "a", "", "Path to instance A JSON file")
+	rootCmd.PersistentFlags().StringArrayVarP(&instanceAPaths, "instance-a", "a", nil, "Path to instance A JSON file (repeatable for layered merges)")
 	rootCmd.PersistentFlags().StringVarP(&instanceBPath, "instance-b", "b", "", "Path to instance B JSON file")
+	rootCmd.PersistentFlags().StringVar(&rulesPath, "rules", "", "Path to a merge rules file applied to the schema")
 	rootCmd.MarkPersistentFlagRequired("schema")
 
 	// Merge-specific flags
+	rootCmd.Flags().StringArrayVarP(&layerSpecs, "layer", "l", nil, "Layer as name=path or path, lowest precedence first (repeatable)")
 	rootCmd.Flags().StringVarP(&outputPath, "output", "o", "", "Output file path (default: stdout)")
+	rootCmd.Flags().StringVar(&provenancePath, "provenance", "", "Write the winning layer of each leaf value to this file (layered merges)")
 	rootCmd.Flags().BoolVar(&skipValidateA, "skip-validate-a", false, "Skip validation of instance A")
 	rootCmd.Flags().BoolVar(&skipValidateB, "skip-validate-b", false, "Skip validation of instance B")
 	rootCmd.Flags().BoolVar(&skipValidateR, "skip-validate-result", false, "Skip validation of result")
 	rootCmd.Flags().StringVar(&applyDefaultsStr, "apply-defaults", "", "Apply schema default values: true, false, or empty to use schema setting")
+	rootCmd.Flags().IntVar(&maxDepth, "max-depth", 0, "Maximum nesting depth to merge (default: library default)")
 	rootCmd.Flags().BoolVar(&pretty, "pretty", true, "Pretty-print JSON output")
 
+	// Bundle flags
+	bundleCmd.Flags().StringVarP(&bundleOutPath, "output", "o", "", "Output file path (default: stdout)")
+
+	// Lint flags
+	lintCmd.Flags().StringVar(&lintFixPath, "fix", "", "Write the suggested rules to this rules file")
+
 	// Add subcommands
 	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(bundleCmd)
+	rootCmd.AddCommand(lintCmd)
 }
 
 func runMerge(cmd *cobra.Command, args []string) error {
-	if instanceAPath == "" || instanceBPath == "" {
+	layered := len(layerSpecs) > 0 || len(instanceAPaths) > 1 || provenancePath != ""
+	if !layered && (len(instanceAPaths) == 0 || instanceBPath == "") {
 		return fmt.Errorf("both --instance-a (-a) and --instance-b (-b) are required for merge")
 	}
 
 	// Load schema
-	schema, err := kfsmerge.LoadSchemaFromFile(schemaPath)
+	schema, err := loadSchema()
 	if err != nil {
 		return fmt.Errorf("error loading schema: %w", err)
 	}
 
-	// Read instances
-	aData, err := os.ReadFile(instanceAPath)
-	if err != nil {
-		return fmt.Errorf("error reading instance A: %w", err)
-	}
-
-	bData, err := os.ReadFile(instanceBPath)
-	if err != nil {
-		return fmt.Errorf("error reading instance B: %w", err)
-	}
-
 	// Build merge options
 	opts := kfsmerge.MergeOptions{
 		SkipValidateA:      skipValidateA,
 		SkipValidateB:      skipValidateB,
 		SkipValidateResult: skipValidateR,
+		MaxDepth:           maxDepth,
 	}
 
 	// Set ApplyDefaults if the flag was explicitly provided
@@ -106,22 +141,38 @@ func runMerge(cmd *cobra.Command, args []string) error {
 	}
 
 	// Merge
-	result, err := schema.MergeWithOptions(aData, bData, opts)
-	if err != nil {
-		return fmt.Errorf("merge failed: %w", err)
+	var result any
+	if layered {
+		result, err = mergeLayers(schema, opts)
+		if err != nil {
+			return err
+		}
+	} else {
+		aData, err := os.ReadFile(instanceAPaths[0])
+		if err != nil {
+			return fmt.Errorf("error reading instance A: %w", err)
+		}
+
+		bData, err := os.ReadFile(instanceBPath)
+		if err != nil {
+			return fmt.Errorf("error reading instance B: %w", err)
+		}
+
+		result, err = schema.MergeToValueWithOptions(aData, bData, opts)
+		if err != nil {
+			return fmt.Errorf("merge failed: %w", err)
+		}
 	}
 
 	// Format output
 	var output []byte
 	if pretty {
-		var v any
-		if err := json.Unmarshal(result, &v); err == nil {
-			output, _ = json.MarshalIndent(v, "", "  ")
-		} else {
-			output = result
-		}
+		output, err = json.MarshalIndent(result, "", "  ")
 	} else {
-		output = result
+		output, err = json.Marshal(result)
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding result: %w", err)
 	}
 
 	// Write output
@@ -137,21 +188,81 @@ func runMerge(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// mergeLayers reads the layers given on the command line and merges them in
+// order: -b first, then each --layer, then each -a.
+func mergeLayers(schema *kfsmerge.Schema, opts kfsmerge.MergeOptions) (any, error) {
+	var specs []string
+	if instanceBPath != "" {
+		specs = append(specs, "base="+instanceBPath)
+	}
+	specs = append(specs, layerSpecs...)
+	if len(instanceAPaths) == 1 && len(layerSpecs) == 0 {
+		specs = append(specs, "request="+instanceAPaths[0])
+	} else {
+		specs = append(specs, instanceAPaths...)
+	}
+
+	if len(specs) < 2 {
+		return nil, fmt.Errorf("at least two layers are required for merge")
+	}
+
+	layers := make([]kfsmerge.Layer, 0, len(specs))
+	for _, spec := range specs {
+		name, path := parseLayerSpec(spec)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading layer %q: %w", name, err)
+		}
+		layers = append(layers, kfsmerge.Layer{Name: name, JSON: data})
+	}
+
+	result, err := schema.MergeLayersWithOptions(opts, layers...)
+	if err != nil {
+		return nil, fmt.Errorf("merge failed: %w", err)
+	}
+
+	if provenancePath != "" {
+		data, err := json.MarshalIndent(result.Provenance, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("error encoding provenance: %w", err)
+		}
+		if err := os.WriteFile(provenancePath, data, 0644); err != nil {
+			return nil, fmt.Errorf("error writing provenance: %w", err)
+		}
+	}
+
+	return result.Value, nil
+}
+
+// parseLayerSpec splits a name=path layer spec. A plain path is named after
+// its file name without extension.
+func parseLayerSpec(spec string) (name, path string) {
+	if name, path, ok := strings.Cut(spec, "="); ok && name != "" && !strings.ContainsRune(name, filepath.Separator) {
+		return name, path
+	}
+	base := filepath.Base(spec)
+	return strings.TrimSuffix(base, filepath.Ext(base)), spec
+}
+
 func runValidate(cmd *cobra.Command, args []string) error {
 	// Load schema
-	schema, err := kfsmerge.LoadSchemaFromFile(schemaPath)
+	schema, err := loadSchema()
 	if err != nil {
 		return fmt.Errorf("error loading schema: %w", err)
 	}
 
 	hasError := false
 
-	if instanceAPath != "" {
-		if err := validateFile(schema, instanceAPath); err != nil {
-			fmt.Fprintf(os.Stderr, "Instance A validation failed: %v\n", err)
+	for _, path := range instanceAPaths {
+		label := "Instance A"
+		if len(instanceAPaths) > 1 {
+			label = fmt.Sprintf("Instance A (%s)", path)
+		}
+		if err := validateFile(schema, path); err != nil {
+			fmt.Fprintf(os.Stderr, "%s validation failed: %v\n", label, err)
 			hasError = true
 		} else {
-			fmt.Println("Instance A: valid")
+			fmt.Printf("%s: valid\n", label)
 		}
 	}
 
@@ -164,7 +275,7 @@ func runValidate(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	if instanceAPath == "" && instanceBPath == "" {
+	if len(instanceAPaths) == 0 && instanceBPath == "" {
 		return fmt.Errorf("at least one of --instance-a (-a) or --instance-b (-b) is required")
 	}
 
@@ -175,6 +286,92 @@ func runValidate(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func runBundle(cmd *cobra.Command, args []string) error {
+	schema, err := loadSchema()
+	if err != nil {
+		return fmt.Errorf("error loading schema: %w", err)
+	}
+
+	bundled, err := schema.Bundle()
+	if err != nil {
+		return fmt.Errorf("error bundling schema: %w", err)
+	}
+
+	if bundleOutPath != "" {
+		if err := os.WriteFile(bundleOutPath, append(bundled, '\n'), 0644); err != nil {
+			return fmt.Errorf("error writing output: %w", err)
+		}
+		return nil
+	}
+	fmt.Println(string(bundled))
+	return nil
+}
+
+func runLint(cmd *cobra.Command, args []string) error {
+	schema, err := loadSchema()
+	if err != nil {
+		return fmt.Errorf("error loading schema: %w", err)
+	}
+
+	warnings := schema.Lint()
+	for _, w := range warnings {
+		fmt.Println(w)
+	}
+
+	if lintFixPath != "" {
+		rules := make(map[string]any)
+		if rulesPath != "" {
+			data, err := os.ReadFile(rulesPath)
+			if err != nil {
+				return fmt.Errorf("error reading rules file: %w", err)
+			}
+			if err := json.Unmarshal(data, &rules); err != nil {
+				return fmt.Errorf("error parsing rules file: %w", err)
+			}
+		}
+		for target, fix := range kfsmerge.LintFixRules(warnings) {
+			rule, _ := rules[target].(map[string]any)
+			if rule == nil {
+				rules[target] = fix
+				continue
+			}
+			for key, value := range fix.(map[string]any) {
+				if _, exists := rule[key]; !exists {
+					rule[key] = value
+				}
+			}
+		}
+		data, err := json.MarshalIndent(rules, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding rules: %w", err)
+		}
+		if err := os.WriteFile(lintFixPath, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("error writing rules file: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Suggested rules written to %s\n", lintFixPath)
+		return nil
+	}
+
+	if len(warnings) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// loadSchema loads the schema given on the command line, with its rules file
+// if one was given.
+func loadSchema() (*kfsmerge.Schema, error) {
+	var opts []kfsmerge.LoadOption
+	if rulesPath != "" {
+		rules, err := os.ReadFile(rulesPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rules file: %w", err)
+		}
+		opts = append(opts, kfsmerge.WithRules(rules))
+	}
+	return kfsmerge.LoadSchemaFromFile(schemaPath, opts...)
+}
+
 func validateFile(schema *kfsmerge.Schema, path string) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -1,30 +1,17 @@
 package kfsmerge
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"strings"
 )
 
 // LoadSchemaFromURL loads a JSON Schema from a URL.
+// The schema and the documents it references are fetched with an HTTPLoader
+// using the default timeout and size limit.
 func LoadSchemaFromURL(url string) (*Schema, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch schema from URL: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch schema: HTTP %d", resp.StatusCode)
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read schema response: %w", err)
-	}
-	return LoadSchema(data)
+	return LoadSchemaWithLoader(context.Background(), url, &HTTPLoader{})
 }
 
 // LoadSchemaFromSource loads a schema from a file path, URL, or raw JSON.
@@ -48,52 +35,9 @@ func (s *Schema) Merge(a, b []byte) ([]byte, error) {
 
 // MergeWithOptions merges A into B with configurable validation behavior.
 func (s *Schema) MergeWithOptions(a, b []byte, opts MergeOptions) ([]byte, error) {
-	validator := NewValidator(s)
-
-	if !opts.SkipValidateA {
-		if err := validator.Validate(a, PhaseValidateA); err != nil {
-			return nil, fmt.Errorf("instance A validation failed: %w", err)
-		}
-	}
-
-	if !opts.SkipValidateB {
-		if err := validator.Validate(b, PhaseValidateB); err != nil {
-			return nil, fmt.Errorf("instance B validation failed: %w", err)
-		}
-	}
-
-	var aVal, bVal any
-	if err := json.Unmarshal(a, &aVal); err != nil {
-		return nil, fmt.Errorf("failed to parse instance A: %w", err)
-	}
-	if err := json.Unmarshal(b, &bVal); err != nil {
-		return nil, fmt.Errorf("failed to parse instance B: %w", err)
-	}
-
-	merger := NewMerger(s)
-
-	// Apply defaults if enabled: merge(A, merge(B, defaults))
-	if s.shouldApplyDefaults(opts) {
-		defaults := s.ExtractDefaults()
-		if defaults != nil {
-			// First merge B into defaults
-			bWithDefaults, err := merger.Merge(bVal, defaults)
-			if err != nil {
-				return nil, fmt.Errorf("failed to apply defaults to B: %w", err)
-			}
-			bVal = bWithDefaults
-		}
-	}
-
-	result, err := merger.Merge(aVal, bVal)
+	result, err := s.MergeToValueWithOptions(a, b, opts)
 	if err != nil {
-		return nil, fmt.Errorf("merge failed: %w", err)
-	}
-
-	if !opts.SkipValidateResult {
-		if err := validator.ValidateValue(result, PhaseValidateResult); err != nil {
-			return nil, fmt.Errorf("result validation failed: %w", err)
-		}
+		return nil, err
 	}
 
 	resultJSON, err := json.Marshal(result)
@@ -105,50 +49,60 @@ func (s *Schema) MergeWithOptions(a, b []byte, opts MergeOptions) ([]byte, error
 }
 
 // MergeToValue is like Merge but returns the result as a Go value instead of JSON bytes.
+// Numbers in the result are json.Number, not float64.
 func (s *Schema) MergeToValue(a, b []byte) (any, error) {
 	return s.MergeToValueWithOptions(a, b, DefaultMergeOptions())
 }
 
 // MergeToValueWithOptions is like MergeWithOptions but returns the result as a Go value.
+// Each instance is decoded once and shared between validation and merging.
 func (s *Schema) MergeToValueWithOptions(a, b []byte, opts MergeOptions) (any, error) {
+	aVal, err := parseInstance(a, "A", PhaseValidateA, opts.SkipValidateA)
+	if err != nil {
+		return nil, err
+	}
+	bVal, err := parseInstance(b, "B", PhaseValidateB, opts.SkipValidateB)
+	if err != nil {
+		return nil, err
+	}
+	return s.MergeValues(aVal, bVal, opts)
+}
+
+// MergeValues is like MergeToValueWithOptions for instances already decoded
+// by encoding/json (maps, slices, strings, json.Number or float64, bool and
+// nil). The inputs are not modified, but the result may share nested values
+// with them.
+func (s *Schema) MergeValues(a, b any, opts MergeOptions) (any, error) {
 	validator := NewValidator(s)
 
 	if !opts.SkipValidateA {
-		if err := validator.Validate(a, PhaseValidateA); err != nil {
+		if err := validator.validateRequest(a, PhaseValidateA); err != nil {
 			return nil, fmt.Errorf("instance A validation failed: %w", err)
 		}
 	}
 
 	if !opts.SkipValidateB {
-		if err := validator.Validate(b, PhaseValidateB); err != nil {
+		if err := validator.ValidateValue(b, PhaseValidateB); err != nil {
 			return nil, fmt.Errorf("instance B validation failed: %w", err)
 		}
 	}
 
-	var aVal, bVal any
-	if err := json.Unmarshal(a, &aVal); err != nil {
-		return nil, fmt.Errorf("failed to parse instance A: %w", err)
-	}
-	if err := json.Unmarshal(b, &bVal); err != nil {
-		return nil, fmt.Errorf("failed to parse instance B: %w", err)
-	}
-
-	merger := NewMerger(s)
+	merger := newMergerWithOptions(s, opts)
 
 	// Apply defaults if enabled: merge(A, merge(B, defaults))
 	if s.shouldApplyDefaults(opts) {
 		defaults := s.ExtractDefaults()
 		if defaults != nil {
 			// First merge B into defaults
-			bWithDefaults, err := merger.Merge(bVal, defaults)
+			bWithDefaults, err := merger.Merge(b, defaults)
 			if err != nil {
 				return nil, fmt.Errorf("failed to apply defaults to B: %w", err)
 			}
-			bVal = bWithDefaults
+			b = bWithDefaults
 		}
 	}
 
-	result, err := merger.Merge(aVal, bVal)
+	result, err := merger.Merge(a, b)
 	if err != nil {
 		return nil, fmt.Errorf("merge failed: %w", err)
 	}
@@ -162,6 +116,19 @@ func (s *Schema) MergeToValueWithOptions(a, b []byte, opts MergeOptions) (any, e
 	return result, nil
 }
 
+// parseInstance decodes a JSON instance. Invalid JSON fails validation of the
+// instance, or parsing when its validation is skipped.
+func parseInstance(data []byte, name string, phase ValidationPhase, skipValidate bool) (any, error) {
+	value, err := decodeJSON(data)
+	if err == nil {
+		return value, nil
+	}
+	if skipValidate {
+		return nil, fmt.Errorf("failed to parse instance %s: %w", name, err)
+	}
+	return nil, fmt.Errorf("instance %s validation failed: %w", name, invalidJSONError(err, phase))
+}
+
 // Validate validates a JSON instance against the schema.
 func (s *Schema) Validate(instanceJSON []byte) error {
 	validator := NewValidator(s)
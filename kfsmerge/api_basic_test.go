@@ -3,6 +3,7 @@ package kfsmerge
 import (
 	"encoding/json"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -152,3 +153,68 @@ func TestMergeFromFiles(t *testing.T) {
 		t.Errorf("count = %v, want 100", got["count"])
 	}
 }
+
+// TestMergeValues tests merging decoded instances, including their validation.
+func TestMergeValues(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"type": "object",
+		"x-kfs-merge": {"applyDefaults": true},
+		"properties": {
+			"name": {"type": "string"},
+			"count": {"type": "integer", "default": 1},
+			"tags": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	a := map[string]any{"name": "from-api", "tags": []any{"a"}}
+	b := map[string]any{"name": "template", "tags": []any{"b"}}
+	result, err := s.MergeValues(a, b, DefaultMergeOptions())
+	if err != nil {
+		t.Fatalf("MergeValues failed: %v", err)
+	}
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("failed to marshal result: %v", err)
+	}
+	assertJSONEqualString(t, resultJSON, `{"name": "from-api", "count": 1, "tags": ["b", "a"]}`)
+	if b["count"] != nil {
+		t.Errorf("MergeValues modified B: %v", b)
+	}
+
+	_, err = s.MergeValues(map[string]any{"count": "many"}, map[string]any{}, DefaultMergeOptions())
+	if err == nil || !strings.Contains(err.Error(), "instance A validation failed") {
+		t.Errorf("error = %v, want instance A validation error", err)
+	}
+}
+
+// TestMergeInvalidJSON tests that malformed instances fail validation, or
+// parsing when their validation is skipped.
+func TestMergeInvalidJSON(t *testing.T) {
+	s, err := LoadSchema([]byte(`{"type": "object"}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		a, b    string
+		opts    MergeOptions
+		wantErr string
+	}{
+		{name: "invalid A", a: `{`, b: `{}`, wantErr: "instance A validation failed: [validate_a] : invalid JSON"},
+		{name: "invalid B", a: `{}`, b: `[`, wantErr: "instance B validation failed: [validate_b] : invalid JSON"},
+		{name: "invalid A unvalidated", a: `{`, b: `{}`, opts: MergeOptions{SkipValidateA: true}, wantErr: "failed to parse instance A"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.MergeWithOptions([]byte(tt.a), []byte(tt.b), tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package kfsmerge
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// =============================================================================
+// Benchmarks
+// =============================================================================
+
+// mediaTierRules merges the tier ladder of the media schema by resolution.
+const mediaTierRules = `{
+	"#/$defs/OmniCAEDLPrivatePars/properties/tiers": {"strategy": "mergeByDiscriminator", "discriminatorField": "res", "replaceOnMatch": false}
+}`
+
+// loadMediaSchema loads examples/kfs_media_schema.json with mediaTierRules.
+func loadMediaSchema(b *testing.B) *Schema {
+	b.Helper()
+	data, err := os.ReadFile("../examples/kfs_media_schema.json")
+	if err != nil {
+		b.Fatalf("failed to read schema: %v", err)
+	}
+	s, err := LoadSchema(data, WithRules([]byte(mediaTierRules)))
+	if err != nil {
+		b.Fatalf("LoadSchema failed: %v", err)
+	}
+	return s
+}
+
+// mediaInstances returns a request and a base for the media schema whose
+// tier ladders have n matching tiers. The base starts from the schema defaults.
+func mediaInstances(s *Schema, n int) (a, b map[string]any) {
+	tiers := func(maxrate int) []any {
+		result := make([]any, n)
+		for i := range result {
+			result[i] = map[string]any{
+				"res":            fmt.Sprintf("%dx%d", 1920-i, 1080-i),
+				"maxrate":        float64(maxrate + i),
+				"minrate_factor": 0.5,
+				"crf_vals":       []any{float64(19), float64(28)},
+				"rating_pars": map[string]any{
+					"maxrating": map[string]any{"iters": float64(10), "passes": float64(3), "strat": "pchip"},
+				},
+			}
+		}
+		return result
+	}
+
+	b = deepCopyJSON(s.ExtractDefaults()).(map[string]any)
+	b["profile_caedl_pars"] = map[string]any{"omni_config": map[string]any{"tiers": tiers(5000)}}
+	a = map[string]any{
+		"job_type":           "vod",
+		"running_options":    map[string]any{"threads_per_task": float64(12)},
+		"profile_caedl_pars": map[string]any{"omni_config": map[string]any{"tiers": tiers(7000)}},
+	}
+	return a, b
+}
+
+// deepCopyJSON copies a decoded JSON value.
+func deepCopyJSON(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, item := range v {
+			result[k] = deepCopyJSON(item)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = deepCopyJSON(item)
+		}
+		return result
+	}
+	return value
+}
+
+// BenchmarkLoadMediaSchema measures loading the media schema, including
+// compiling its merge plan.
+func BenchmarkLoadMediaSchema(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		loadMediaSchema(b)
+	}
+}
+
+// BenchmarkMergeMediaSchema measures merging decoded media instances with
+// growing tier ladders.
+func BenchmarkMergeMediaSchema(b *testing.B) {
+	s := loadMediaSchema(b)
+	for _, n := range []int{10, 100, 1000} {
+		a, base := mediaInstances(s, n)
+		b.Run(fmt.Sprintf("tiers=%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewMerger(s).Merge(a, base); err != nil {
+					b.Fatalf("Merge failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkFieldConfigMediaSchema measures rule lookups by path.
+func BenchmarkFieldConfigMediaSchema(b *testing.B) {
+	s := loadMediaSchema(b)
+	paths := []string{
+		"/profile_caedl_pars/omni_config/tiers",
+		"/profile_caedl_pars/omni_config/tiers/items/rating_pars/maxrating/iters",
+		"/running_options/logging_options/log_level",
+		"/backend/options/json_runner/json_path",
+		"/timed_text/jobs/items/channels/items/outputs",
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			s.FieldConfig(path)
+		}
+	}
+}
+
+// lookupRulesByPath resolves the rules of value and every value below it from
+// the schema root by path, as the merger did before merge plans.
+func lookupRulesByPath(s *Schema, value any, path string) {
+	s.FieldConfig(path)
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			lookupRulesByPath(s, item, childPath(path, key))
+		}
+	case []any:
+		for i, item := range v {
+			lookupRulesByPath(s, item, childPath(path, strconv.Itoa(i)))
+		}
+	}
+}
+
+// lookupRulesByPlan resolves the rules of value and every value below it by
+// walking the plan cursor along with the instance, as the merger does.
+func lookupRulesByPlan(value any, path string, at planCursor) {
+	at.fieldConfig()
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			lookupRulesByPlan(item, childPath(path, key), at.child(key))
+		}
+	case []any:
+		for i, item := range v {
+			lookupRulesByPlan(item, childPath(path, strconv.Itoa(i)), at.child("items"))
+		}
+	}
+}
+
+// BenchmarkRuleLookupMediaSchema compares looking up the rules of every value
+// of a media instance by path with walking the merge plan.
+func BenchmarkRuleLookupMediaSchema(b *testing.B) {
+	s := loadMediaSchema(b)
+	a, _ := mediaInstances(s, 100)
+	b.Run("by-path", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			lookupRulesByPath(s, a, "")
+		}
+	})
+	b.Run("plan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			lookupRulesByPlan(a, "", planCursor{node: s.plan})
+		}
+	})
+}
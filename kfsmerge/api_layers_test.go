@@ -0,0 +1,274 @@
+package kfsmerge
+
+import (
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// Layered Merge Tests
+// =============================================================================
+
+const layersTestSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"properties": {
+		"name": {"type": "string"},
+		"priority": {"type": "integer"},
+		"region": {
+			"type": "string",
+			"x-kfs-merge": {"keepLayer": "org"}
+		},
+		"running_options": {
+			"type": "object",
+			"properties": {
+				"threads": {"type": "integer"},
+				"preset": {"type": "string"}
+			}
+		},
+		"tags": {
+			"type": "array",
+			"items": {"type": "string"},
+			"x-kfs-merge": {"strategy": "concat"}
+		},
+		"outputs": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"kind": {"type": "string"},
+					"bitrate": {"type": "integer", "x-kfs-merge": {"keepLayer": "org"}}
+				}
+			},
+			"x-kfs-merge": {"strategy": "mergeByDiscriminator", "discriminatorField": "kind", "replaceOnMatch": false}
+		}
+	}
+}`
+
+func loadLayersTestSchema(t *testing.T) *Schema {
+	t.Helper()
+	s, err := LoadSchema([]byte(layersTestSchema))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+	return s
+}
+
+// TestMergeLayers tests that layers are applied from lowest to highest precedence.
+func TestMergeLayers(t *testing.T) {
+	s := loadLayersTestSchema(t)
+
+	result, err := s.MergeLayers(
+		Layer{Name: "defaults", JSON: []byte(`{"name": "default", "priority": 1, "running_options": {"threads": 4, "preset": "medium"}, "tags": ["d"]}`)},
+		Layer{Name: "org", JSON: []byte(`{"priority": 2, "running_options": {"preset": "slow"}, "tags": ["o"]}`)},
+		Layer{Name: "team", JSON: []byte(`{"running_options": {"threads": 8}}`)},
+		Layer{Name: "request", JSON: []byte(`{"name": "job-42", "tags": ["r"]}`)},
+	)
+	if err != nil {
+		t.Fatalf("MergeLayers failed: %v", err)
+	}
+
+	assertJSONEqualString(t, result, `{
+		"name": "job-42",
+		"priority": 2,
+		"running_options": {"threads": 8, "preset": "slow"},
+		"tags": ["d", "o", "r"]
+	}`)
+}
+
+// TestMergeLayersMatchesTwoWayMerge tests that two layers behave like Merge(a, b).
+func TestMergeLayersMatchesTwoWayMerge(t *testing.T) {
+	s := loadLayersTestSchema(t)
+
+	a := []byte(`{"name": "request", "running_options": {"threads": 2}, "tags": ["a"]}`)
+	b := []byte(`{"name": "template", "priority": 5, "running_options": {"preset": "fast"}, "tags": ["b"]}`)
+
+	want, err := s.Merge(a, b)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	got, err := s.MergeLayers(Layer{Name: "base", JSON: b}, Layer{Name: "request", JSON: a})
+	if err != nil {
+		t.Fatalf("MergeLayers failed: %v", err)
+	}
+
+	assertJSONEqual(t, got, want)
+}
+
+// TestMergeLayersKeepLayer tests that keepLayer lets the named layer win over higher layers.
+func TestMergeLayersKeepLayer(t *testing.T) {
+	tests := []struct {
+		name     string
+		layers   []Layer
+		expected string
+		wantErr  string
+	}{
+		{
+			name: "named layer wins over higher layers",
+			layers: []Layer{
+				{Name: "defaults", JSON: []byte(`{"region": "us-east-1"}`)},
+				{Name: "org", JSON: []byte(`{"region": "eu-west-1"}`)},
+				{Name: "request", JSON: []byte(`{"region": "ap-south-1"}`)},
+			},
+			expected: `{"region": "eu-west-1"}`,
+		},
+		{
+			name: "normal merge when named layer omits the field",
+			layers: []Layer{
+				{Name: "defaults", JSON: []byte(`{"region": "us-east-1"}`)},
+				{Name: "org", JSON: []byte(`{}`)},
+				{Name: "request", JSON: []byte(`{"region": "ap-south-1"}`)},
+			},
+			expected: `{"region": "ap-south-1"}`,
+		},
+		{
+			name: "error when named layer is absent",
+			layers: []Layer{
+				{Name: "defaults", JSON: []byte(`{"region": "us-east-1"}`)},
+				{Name: "request", JSON: []byte(`{"region": "ap-south-1"}`)},
+			},
+			wantErr: `keepLayer at /region: no layer is named "org"`,
+		},
+		{
+			name: "discriminated items matched by discriminator value",
+			layers: []Layer{
+				{Name: "defaults", JSON: []byte(`{}`)},
+				{Name: "org", JSON: []byte(`{"outputs": [{"kind": "hls", "bitrate": 1000}, {"kind": "dash", "bitrate": 2000}]}`)},
+				{Name: "request", JSON: []byte(`{"outputs": [{"kind": "dash", "bitrate": 9000}]}`)},
+			},
+			expected: `{"outputs": [{"kind": "dash", "bitrate": 2000}, {"kind": "hls", "bitrate": 1000}]}`,
+		},
+	}
+
+	s := loadLayersTestSchema(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.MergeLayers(tt.layers...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergeLayers failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
+
+// TestMergeLayersProvenance tests that provenance reports the winning layer of each leaf.
+func TestMergeLayersProvenance(t *testing.T) {
+	s := loadLayersTestSchema(t)
+
+	result, err := s.MergeLayersWithOptions(DefaultMergeOptions(),
+		Layer{Name: "defaults", JSON: []byte(`{"name": "default", "priority": 1, "running_options": {"threads": 4, "preset": "medium"}}`)},
+		Layer{Name: "org", JSON: []byte(`{"priority": 2, "region": "eu-west-1"}`)},
+		Layer{Name: "team", JSON: []byte(`{"running_options": {"threads": 8}}`)},
+		Layer{Name: "request", JSON: []byte(`{"name": "job-42", "region": "ap-south-1"}`)},
+	)
+	if err != nil {
+		t.Fatalf("MergeLayersWithOptions failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"/name":                    "request",
+		"/priority":                "org",
+		"/region":                  "org",
+		"/running_options/threads": "team",
+		"/running_options/preset":  "defaults",
+	}
+	if len(result.Provenance) != len(expected) {
+		t.Errorf("provenance has %d entries, want %d: %v", len(result.Provenance), len(expected), result.Provenance)
+	}
+	for path, want := range expected {
+		if got := result.Provenance[path]; got != want {
+			t.Errorf("provenance[%s] = %q, want %q", path, got, want)
+		}
+	}
+}
+
+// TestMergeLayersProvenanceWithDefaults tests that schema defaults are reported as their own layer.
+func TestMergeLayersProvenanceWithDefaults(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"x-kfs-merge": {"applyDefaults": true},
+		"properties": {
+			"codec": {"type": "string", "default": "h264"},
+			"bitrate": {"type": "integer", "default": 1000}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	result, err := s.MergeLayersWithOptions(DefaultMergeOptions(),
+		Layer{Name: "org", JSON: []byte(`{"bitrate": 2000}`)},
+		Layer{Name: "request", JSON: []byte(`{}`)},
+	)
+	if err != nil {
+		t.Fatalf("MergeLayersWithOptions failed: %v", err)
+	}
+
+	assertJSONEqualString(t, result.JSON, `{"codec": "h264", "bitrate": 2000}`)
+	if got := result.Provenance["/codec"]; got != DefaultsLayerName {
+		t.Errorf("provenance[/codec] = %q, want %q", got, DefaultsLayerName)
+	}
+	if got := result.Provenance["/bitrate"]; got != "org" {
+		t.Errorf("provenance[/bitrate] = %q, want %q", got, "org")
+	}
+}
+
+// TestMergeLayersErrors tests error conditions for layered merges.
+func TestMergeLayersErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		layers  []Layer
+		wantErr string
+	}{
+		{
+			name:    "no layers",
+			layers:  nil,
+			wantErr: "at least one layer",
+		},
+		{
+			name: "unnamed layer",
+			layers: []Layer{
+				{Name: "", JSON: []byte(`{}`)},
+			},
+			wantErr: "has no name",
+		},
+		{
+			name: "duplicate layer names",
+			layers: []Layer{
+				{Name: "org", JSON: []byte(`{}`)},
+				{Name: "org", JSON: []byte(`{}`)},
+			},
+			wantErr: "duplicate layer name",
+		},
+		{
+			name: "invalid layer reports its name",
+			layers: []Layer{
+				{Name: "org", JSON: []byte(`{"priority": "high"}`)},
+				{Name: "request", JSON: []byte(`{}`)},
+			},
+			wantErr: `layer "org" validation failed`,
+		},
+	}
+
+	s := loadLayersTestSchema(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.MergeLayers(tt.layers...)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
@@ -25,7 +25,7 @@ func TestKfsMediaSchemaPattern(t *testing.T) {
 			},
 			"encoding": {
 				"type": "object",
-				"x-kfs-merge": {"strategy": "overlay"},
+				"x-kfs-merge": {"strategy": "deepMerge"},
 				"properties": {
 					"codec": {"type": "string"},
 					"bitrate": {"type": "integer"},
@@ -89,7 +89,7 @@ func TestKfsMediaSchemaPattern(t *testing.T) {
 		}
 	}
 
-	// Check encoding - overlay should preserve codec and profile
+	// Check encoding - deepMerge should preserve codec and profile
 	encoding := got["encoding"].(map[string]any)
 	if encoding["codec"] != "h264" {
 		t.Errorf("encoding.codec = %v, want 'h264'", encoding["codec"])
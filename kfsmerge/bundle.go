@@ -0,0 +1,253 @@
+package kfsmerge
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Bundle returns the schema as a single self-contained document: every
+// definition referenced from another document is copied into $defs (or
+// definitions, for draft-07 schemas without $defs) and the references to it
+// are rewritten. The bundle is loaded back without access to
+// the original documents and must yield the same merge rules for every path.
+func (s *Schema) Bundle() ([]byte, error) {
+	bundled := deepCopy(s.raw).(map[string]any)
+
+	// Allocate $defs names for all external targets in a stable order.
+	targets := s.externalTargets()
+	keyword := "$defs"
+	if _, ok := bundled["$defs"]; !ok && (s.draft == Draft7 || bundled["definitions"] != nil) {
+		keyword = "definitions"
+	}
+	defs, _ := bundled[keyword].(map[string]any)
+	if defs == nil {
+		defs = make(map[string]any)
+	}
+	existing := make(map[string]any)
+	for _, k := range defsKeywords {
+		if entries, ok := bundled[k].(map[string]any); ok {
+			for name := range entries {
+				existing[name] = true
+			}
+		}
+	}
+	names := make(map[string]string, len(targets))
+	for _, target := range targets {
+		names[target] = uniqueDefName(existing, names, bundleDefName(target))
+	}
+
+	rewrite := func(node any) {
+		walkSchema(node, "", "", "", false, func(node map[string]any, _ string, _ location) {
+			for _, refKeyword := range []string{"$ref", "$dynamicRef"} {
+				if ref, ok := node[refKeyword].(string); ok {
+					if name, ok := names[ref]; ok {
+						node[refKeyword] = "#/" + keyword + "/" + escapePointer(name)
+					}
+				}
+			}
+		})
+	}
+
+	rewrite(bundled)
+	for _, target := range targets {
+		defNode, _ := s.defNode(target)
+		inlined := deepCopy(defNode).(map[string]any)
+		stripResourceKeywords(inlined)
+		rewrite(inlined)
+		defs[names[target]] = inlined
+	}
+	if len(defs) > 0 {
+		bundled[keyword] = defs
+	}
+
+	data, err := json.MarshalIndent(bundled, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bundled schema: %w", err)
+	}
+
+	roundTrip, err := LoadSchema(data, WithLoader(MapLoader{}))
+	if err != nil {
+		return nil, fmt.Errorf("bundled schema does not load: %w", err)
+	}
+	if err := s.sameRules(roundTrip); err != nil {
+		return nil, fmt.Errorf("bundled schema changes merge rules: %w", err)
+	}
+	return data, nil
+}
+
+// externalTargets returns, sorted, the definitions in other documents reachable
+// from the schema document through references.
+func (s *Schema) externalTargets() []string {
+	seen := make(map[string]bool)
+	var visit func(node any)
+	visit = func(node any) {
+		walkSchema(node, "", "", "", false, func(node map[string]any, _ string, _ location) {
+			for _, keyword := range []string{"$ref", "$dynamicRef"} {
+				ref, ok := node[keyword].(string)
+				if !ok {
+					continue
+				}
+				defName, ok := s.resolveRef(ref)
+				if !ok || isLocalDef(defName) || strings.HasPrefix(defName, "#") || seen[defName] {
+					continue
+				}
+				seen[defName] = true
+				if defNode, ok := s.defNode(defName); ok {
+					visit(defNode)
+				}
+			}
+		})
+	}
+	visit(s.raw)
+
+	targets := make([]string, 0, len(seen))
+	for target := range seen {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// bundleDefName proposes a $defs name for an external definition: the last
+// token of its pointer, or the name of its document.
+func bundleDefName(target string) string {
+	i := strings.Index(target, "#")
+	if pointer := target[i+1:]; pointer != "" {
+		return unescapePointer(pointer[strings.LastIndex(pointer, "/")+1:])
+	}
+	name := path.Base(target[:i])
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// uniqueDefName returns name, suffixed if needed so it clashes with neither an
+// existing definition nor an allocated name.
+func uniqueDefName(defs map[string]any, allocated map[string]string, name string) string {
+	taken := func(candidate string) bool {
+		if _, ok := defs[candidate]; ok {
+			return true
+		}
+		for _, used := range allocated {
+			if used == candidate {
+				return true
+			}
+		}
+		return false
+	}
+	candidate := name
+	for i := 2; taken(candidate); i++ {
+		candidate = fmt.Sprintf("%s_%d", name, i)
+	}
+	return candidate
+}
+
+// stripResourceKeywords removes the keywords that would make an inlined
+// definition a resource of its own; its references are already rewritten to
+// JSON pointers, so $id and anchors are no longer needed.
+func stripResourceKeywords(node map[string]any) {
+	walkSchema(node, "", "", "", false, func(node map[string]any, _ string, _ location) {
+		for _, keyword := range []string{"$id", "$schema", "$anchor", "$dynamicAnchor"} {
+			delete(node, keyword)
+		}
+	})
+}
+
+// deepCopy copies a decoded JSON value.
+func deepCopy(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(value))
+		for k, v := range value {
+			copied[k] = deepCopy(v)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(value))
+		for i, v := range value {
+			copied[i] = deepCopy(v)
+		}
+		return copied
+	default:
+		return value
+	}
+}
+
+// sameRules reports where other resolves different merge rules than s.
+func (s *Schema) sameRules(other *Schema) error {
+	if !reflect.DeepEqual(s.globalConfig, other.globalConfig) {
+		return fmt.Errorf("global configuration differs")
+	}
+	mine, theirs := s.ruleTable(), other.ruleTable()
+	for path, config := range mine {
+		if otherConfig, ok := theirs[path]; !ok || !reflect.DeepEqual(config, otherConfig) {
+			return fmt.Errorf("rules differ at %q", path)
+		}
+	}
+	for path := range theirs {
+		if _, ok := mine[path]; !ok {
+			return fmt.Errorf("rules differ at %q", path)
+		}
+	}
+	return nil
+}
+
+// ruleTable returns the effective merge configuration of every schema path
+// that has one. Recursive definitions are expanded once.
+func (s *Schema) ruleTable() map[string]FieldMergeConfig {
+	table := make(map[string]FieldMergeConfig)
+	var walk func(path string, node map[string]any, visiting map[string]bool)
+	walk = func(path string, node map[string]any, visiting map[string]bool) {
+		if config, ok := s.FieldConfig(path); ok && path != "" {
+			table[path] = config
+		}
+
+		if ref, ok := schemaRef(node); ok {
+			if defName, ok := s.resolveRef(ref); ok && !visiting[defName] {
+				if defNode, ok := s.defNode(defName); ok {
+					visiting[defName] = true
+					walk(path, defNode, visiting)
+					delete(visiting, defName)
+				}
+			}
+		}
+		if props, ok := node["properties"].(map[string]any); ok {
+			for propName, propValue := range props {
+				if propMap, ok := propValue.(map[string]any); ok {
+					walk(childPath(path, propName), propMap, visiting)
+				}
+			}
+		}
+		if items, ok := node["items"].(map[string]any); ok {
+			walk(path+"/items", items, visiting)
+		}
+		mapSubschemas(node, func(segment string, sub map[string]any) error {
+			walk(childPath(path, segment), sub, visiting)
+			return nil
+		})
+		for _, keyword := range compositionKeywords {
+			switch value := node[keyword].(type) {
+			case []any:
+				for _, alt := range value {
+					if altMap, ok := alt.(map[string]any); ok {
+						walk(path, altMap, visiting)
+					}
+				}
+			case map[string]any:
+				if keyword != "dependentSchemas" {
+					walk(path, value, visiting)
+					continue
+				}
+				for _, sub := range value {
+					if subMap, ok := sub.(map[string]any); ok {
+						walk(path, subMap, visiting)
+					}
+				}
+			}
+		}
+	}
+	walk("", s.raw, map[string]bool{rootDefName: true})
+	return table
+}
@@ -0,0 +1,458 @@
+package kfsmerge
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+//go:embed x-kfs-merge.schema.json
+var metaSchema []byte
+
+// MetaSchema returns a JSON Schema (Draft 2020-12) meta-schema for schemas
+// with x-kfs-merge extensions. Referencing it from "$schema" lets editors
+// validate and autocomplete the extension.
+func MetaSchema() []byte {
+	return bytes.Clone(metaSchema)
+}
+
+// strategies lists the known merge strategies.
+var strategies = map[MergeStrategy]bool{
+	StrategyKeepBase:             true,
+	StrategyKeepRequest:          true,
+	StrategyDeepMerge:            true,
+	StrategyDeepMergeBaseWins:    true,
+	StrategyShallowMerge:         true,
+	StrategyReplace:              true,
+	StrategyConcat:               true,
+	StrategyMergeByDiscriminator: true,
+	StrategyNumeric:              true,
+	StrategySemver:               true,
+	StrategyTemporal:             true,
+	StrategyQuantity:             true,
+	StrategyStringJoin:           true,
+}
+
+// strategyOperations lists the operations of the strategies that take one.
+var strategyOperations = map[MergeStrategy][]string{
+	StrategyNumeric:  {"sum", "max", "min", "avg", "product", "clamp"},
+	StrategySemver:   {"max", "min", "satisfies"},
+	StrategyTemporal: {"max", "min", "earliest", "latest", "sum"},
+	StrategyQuantity: {"max", "min", "sum"},
+}
+
+// fieldOptionTypes maps the keys of a field's x-kfs-merge to their JSON types.
+var fieldOptionTypes = map[string]string{
+	"strategy":           "string",
+	"discriminatorField": "string",
+	"replaceOnMatch":     "boolean",
+	"nullHandling":       "string",
+	"unique":             "boolean",
+	"operation":          "string",
+	"multipleOf":         "number",
+	"roundTo":            "string",
+	"constraint":         "string",
+	"versionField":       "string",
+	"unit":               "string",
+	"canonicalUnit":      "string",
+	"separator":          "string",
+	"order":              "string",
+	"mode":               "string",
+	"keepLayer":          "string",
+	"depth":              "integer",
+	"byDiscriminator":    "object",
+	"mapKeys":            "string",
+	"when":               "array",
+}
+
+// globalOptionTypes maps the keys of the schema-level x-kfs-merge to their JSON types.
+var globalOptionTypes = map[string]string{
+	"defaultStrategy": "string",
+	"arrayStrategy":   "string",
+	"nullHandling":    "string",
+	"applyDefaults":   "boolean",
+}
+
+// checkOptionTypes reports unknown keys of a merge extension map and values
+// of the wrong JSON type.
+func checkOptionTypes(mergeMap map[string]any, types map[string]string) error {
+	keys := make([]string, 0, len(mergeMap))
+	for key := range mergeMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		want, ok := types[key]
+		if !ok {
+			return fmt.Errorf("unknown key %q", key)
+		}
+		if got := jsonType(mergeMap[key]); got != want && !(want == "integer" && got == "number" && isWhole(mergeMap[key])) {
+			return fmt.Errorf("%s must be %s %s, got %s", key, article(want), want, got)
+		}
+	}
+	return nil
+}
+
+// checkFieldMergeConfig reports option values a field configuration does not
+// accept, independently of the schema it applies to.
+func checkFieldMergeConfig(config FieldMergeConfig) error {
+	if config.Strategy != "" && !strategies[config.Strategy] {
+		return fmt.Errorf("unknown strategy %q", config.Strategy)
+	}
+	if config.Operation != "" {
+		operations, ok := strategyOperations[config.Strategy]
+		if !ok {
+			return fmt.Errorf("operation is not supported by strategy %q", config.Strategy)
+		}
+		if !slices.Contains(operations, config.Operation) {
+			return fmt.Errorf("unknown %s operation %q, want one of %s", config.Strategy, config.Operation, strings.Join(operations, ", "))
+		}
+	}
+	if err := checkNullHandling(config.NullHandling); err != nil {
+		return err
+	}
+	switch config.MapKeys {
+	case "", MapKeysMerge, MapKeysReplace:
+	default:
+		return fmt.Errorf("unknown mapKeys mode %q", config.MapKeys)
+	}
+	if config.MapKeys != "" && config.Strategy != "" && config.Strategy != StrategyDeepMerge {
+		return fmt.Errorf("mapKeys requires strategy %q", StrategyDeepMerge)
+	}
+	if config.Depth != nil && *config.Depth < 0 {
+		return fmt.Errorf("depth must not be negative, got %d", *config.Depth)
+	}
+	if config.MultipleOf != nil && *config.MultipleOf <= 0 {
+		return fmt.Errorf("multipleOf must be positive, got %v", *config.MultipleOf)
+	}
+	switch config.RoundTo {
+	case "", RoundNearest, RoundUp, RoundDown:
+	default:
+		return fmt.Errorf("unknown roundTo mode %q", config.RoundTo)
+	}
+	if (config.MultipleOf != nil || config.RoundTo != "") && config.Strategy != StrategyNumeric {
+		return fmt.Errorf("multipleOf and roundTo require strategy %q", StrategyNumeric)
+	}
+	if (config.Constraint != "" || config.VersionField != "") && config.Strategy != StrategySemver {
+		return fmt.Errorf("constraint and versionField require strategy %q", StrategySemver)
+	}
+	if config.Constraint == "" && config.Strategy == StrategySemver && config.Operation == "satisfies" {
+		return fmt.Errorf("operation %q requires a constraint", config.Operation)
+	}
+	if (config.Unit != "" || config.CanonicalUnit != "") && config.Strategy != StrategyQuantity {
+		return fmt.Errorf("unit and canonicalUnit require strategy %q", StrategyQuantity)
+	}
+	if config.Strategy == StrategyQuantity && config.Unit == "" {
+		return fmt.Errorf("strategy %q requires unit", config.Strategy)
+	}
+	switch config.Order {
+	case "", JoinBaseFirst, JoinRequestFirst:
+	default:
+		return fmt.Errorf("unknown order %q", config.Order)
+	}
+	switch config.Mode {
+	case "", JoinModeJoin, JoinModePrefix, JoinModeSuffix:
+	default:
+		return fmt.Errorf("unknown mode %q", config.Mode)
+	}
+	if (config.Separator != nil || config.Order != "" || config.Mode != "") && config.Strategy != StrategyStringJoin {
+		return fmt.Errorf("separator, order and mode require strategy %q", StrategyStringJoin)
+	}
+	if config.Order != "" && config.ModeOrDefault() != JoinModeJoin {
+		return fmt.Errorf("order is not supported in mode %q", config.Mode)
+	}
+	if config.Strategy == StrategyStringJoin && config.UniqueOrDefault() && config.SeparatorOrDefault() == "" {
+		return fmt.Errorf("unique requires a non-empty separator")
+	}
+	if config.ByDiscriminator != nil && config.Strategy != StrategyMergeByDiscriminator {
+		return fmt.Errorf("byDiscriminator requires strategy %q", StrategyMergeByDiscriminator)
+	}
+	return nil
+}
+
+// checkNullHandling reports an unknown nullHandling value.
+func checkNullHandling(nullHandling NullHandling) error {
+	switch nullHandling {
+	case "", NullAsValue, NullAsAbsent, NullPreserve:
+		return nil
+	}
+	return fmt.Errorf("unknown nullHandling %q", nullHandling)
+}
+
+// checkMergeExtensions validates every x-kfs-merge annotation of the schema
+// and the documents it references, including those not reachable from the
+// root. Errors name the annotation by JSON pointer.
+func (s *Schema) checkMergeExtensions() error {
+	uris := make([]string, 0, len(s.docs))
+	for uri := range s.docs {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	for _, uri := range uris {
+		var walkErr error
+		walkSchema(s.docs[uri], uri, uri, "", false, func(node map[string]any, _ string, at location) {
+			mergeRaw, ok := node[MergeExtensionKey]
+			if !ok || walkErr != nil {
+				return
+			}
+			if err := s.checkMergeExtension(node, mergeRaw, at); err != nil {
+				pointer := "#" + at.pointer + "/" + MergeExtensionKey
+				if at.doc != s.baseURI {
+					pointer = at.doc + pointer
+				}
+				walkErr = fmt.Errorf("%s: %w", pointer, err)
+			}
+		})
+		if walkErr != nil {
+			return walkErr
+		}
+	}
+	return nil
+}
+
+// checkMergeExtension validates the x-kfs-merge annotation of a schema node.
+func (s *Schema) checkMergeExtension(node map[string]any, mergeRaw any, at location) error {
+	mergeMap, ok := mergeRaw.(map[string]any)
+	if !ok {
+		return fmt.Errorf("must be an object")
+	}
+	if at.doc == s.baseURI && at.pointer == "" {
+		return checkGlobalMergeConfig(mergeMap)
+	}
+
+	config, err := parseFieldMergeConfig(mergeMap)
+	if err != nil {
+		return err
+	}
+	if err := s.checkConfigTypes(node, config); err != nil {
+		return err
+	}
+	for i, clause := range config.When {
+		if err := s.checkConfigTypes(node, clause.Then); err != nil {
+			return fmt.Errorf("when[%d].then: %w", i, err)
+		}
+	}
+	if items, ok := node["items"].(map[string]any); ok {
+		for _, value := range sortedKeys(config.ByDiscriminator) {
+			rule := config.ByDiscriminator[value]
+			if err := s.checkConfigTypes(items, rule); err != nil {
+				return fmt.Errorf("byDiscriminator %q: %w", value, err)
+			}
+			for i, clause := range rule.When {
+				if err := s.checkConfigTypes(items, clause.Then); err != nil {
+					return fmt.Errorf("byDiscriminator %q: when[%d].then: %w", value, i, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkGlobalMergeConfig validates the schema-level x-kfs-merge annotation.
+func checkGlobalMergeConfig(mergeMap map[string]any) error {
+	if err := checkOptionTypes(mergeMap, globalOptionTypes); err != nil {
+		return err
+	}
+	for _, key := range []string{"defaultStrategy", "arrayStrategy"} {
+		if strategy, ok := mergeMap[key].(string); ok && !strategies[MergeStrategy(strategy)] {
+			return fmt.Errorf("unknown %s %q", key, strategy)
+		}
+	}
+	if nullHandling, ok := mergeMap["nullHandling"].(string); ok {
+		return checkNullHandling(NullHandling(nullHandling))
+	}
+	return nil
+}
+
+// checkConfigTypes reports a field configuration whose strategy cannot merge
+// the JSON types the schema node allows, or names unit systems the schema
+// lacks. Nodes whose types are not known are not checked for types.
+func (s *Schema) checkConfigTypes(node map[string]any, config FieldMergeConfig) error {
+	if err := s.checkQuantityUnits(config); err != nil {
+		return err
+	}
+	types, known := s.schemaTypes(node, make(map[string]bool))
+	if !known {
+		return nil
+	}
+	allows := func(want ...string) bool {
+		for _, t := range want {
+			if types[t] {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case config.DiscriminatorField != "" && !allows("array") && !isUnionNode(node):
+		return fmt.Errorf("discriminatorField requires an array or oneOf/anyOf schema, got %s", typeList(types))
+	case config.Strategy == StrategyMergeByDiscriminator && !allows("array"):
+		return fmt.Errorf("strategy %q requires an array schema, got %s", config.Strategy, typeList(types))
+	case config.Strategy == StrategyConcat && !allows("array"):
+		return fmt.Errorf("strategy %q requires an array schema, got %s", config.Strategy, typeList(types))
+	case config.Strategy == StrategyNumeric && !allows("number", "integer"):
+		return fmt.Errorf("strategy %q requires a number schema, got %s", config.Strategy, typeList(types))
+	case config.Strategy == StrategySemver && !allows("string", "object"):
+		return fmt.Errorf("strategy %q requires a string or object schema, got %s", config.Strategy, typeList(types))
+	case config.Strategy == StrategyTemporal && !allows("string", "number", "integer"):
+		return fmt.Errorf("strategy %q requires a string or number schema, got %s", config.Strategy, typeList(types))
+	case config.Strategy == StrategyQuantity && !allows("string", "number", "integer"):
+		return fmt.Errorf("strategy %q requires a string or number schema, got %s", config.Strategy, typeList(types))
+	case config.Strategy == StrategyStringJoin && !allows("string"):
+		return fmt.Errorf("strategy %q requires a string schema, got %s", config.Strategy, typeList(types))
+	}
+	if err := s.checkTemporalFormat(node, config); err != nil {
+		return err
+	}
+	return s.checkNumericBounds(node, config)
+}
+
+// checkNumericBounds reports a numeric configuration that relies on range
+// keywords the schema node does not declare.
+func (s *Schema) checkNumericBounds(node map[string]any, config FieldMergeConfig) error {
+	if config.Strategy != StrategyNumeric {
+		return nil
+	}
+	bounds := s.numericBoundsOf(node, make(map[string]bool))
+	if config.Operation == "clamp" && (bounds == nil || bounds.minimum == nil && bounds.maximum == nil) {
+		return fmt.Errorf("operation %q requires minimum or maximum in the schema", config.Operation)
+	}
+	if config.RoundTo != "" && config.MultipleOf == nil && (bounds == nil || bounds.multipleOf == 0) {
+		return fmt.Errorf("roundTo requires multipleOf in the rule or the schema")
+	}
+	return nil
+}
+
+// schemaTypes returns the JSON types a schema node allows, following $refs
+// and oneOf/anyOf/allOf. It reports false when they are not declared.
+func (s *Schema) schemaTypes(node map[string]any, visiting map[string]bool) (map[string]bool, bool) {
+	switch t := node["type"].(type) {
+	case string:
+		return map[string]bool{t: true}, true
+	case []any:
+		types := make(map[string]bool, len(t))
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				types[name] = true
+			}
+		}
+		return types, true
+	}
+
+	if ref, ok := schemaRef(node); ok {
+		defName, ok := s.resolveRef(ref)
+		if !ok || visiting[defName] {
+			return nil, false
+		}
+		defNode, ok := s.defNode(defName)
+		if !ok {
+			return nil, false
+		}
+		visiting[defName] = true
+		defer delete(visiting, defName)
+		return s.schemaTypes(defNode, visiting)
+	}
+
+	for _, keyword := range []string{"oneOf", "anyOf"} {
+		alts, ok := node[keyword].([]any)
+		if !ok {
+			continue
+		}
+		types := make(map[string]bool)
+		for _, alt := range alts {
+			altMap, ok := alt.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			altTypes, known := s.schemaTypes(altMap, visiting)
+			if !known {
+				return nil, false
+			}
+			for t := range altTypes {
+				types[t] = true
+			}
+		}
+		return types, true
+	}
+
+	if parts, ok := node["allOf"].([]any); ok {
+		for _, part := range parts {
+			if partMap, ok := part.(map[string]any); ok {
+				if types, known := s.schemaTypes(partMap, visiting); known {
+					return types, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// isUnionNode reports whether a schema node declares oneOf or anyOf, whose
+// branches a discriminatorField may identify.
+func isUnionNode(node map[string]any) bool {
+	_, hasOneOf := node["oneOf"].([]any)
+	_, hasAnyOf := node["anyOf"].([]any)
+	return hasOneOf || hasAnyOf
+}
+
+// jsonType returns the JSON type name of a decoded value.
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// isWhole reports whether a decoded JSON number is an integer.
+func isWhole(value any) bool {
+	f, ok := value.(float64)
+	return ok && f == math.Trunc(f)
+}
+
+// article returns the indefinite article for a JSON type name.
+func article(typeName string) string {
+	switch typeName[0] {
+	case 'a', 'i', 'o':
+		return "an"
+	}
+	return "a"
+}
+
+// typeList formats a set of JSON types for error messages.
+func typeList(types map[string]bool) string {
+	names := make([]string, 0, len(types))
+	for t := range types {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+// sortedKeys returns the keys of a map in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
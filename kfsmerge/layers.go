@@ -0,0 +1,262 @@
+package kfsmerge
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// layerContext gives the merger access to the named layers of a layered merge.
+type layerContext struct {
+	index   map[string]int
+	docs    []any
+	current int                  // index of the layer currently being merged as A
+	items   map[string]layerItem // array items merged by discriminator, by path
+}
+
+// layerItem is the discriminator of an array item merged by discriminator.
+// The named layer's copy of the item is found by its discriminator value,
+// since its index may differ from the merged layer's.
+type layerItem struct {
+	field string
+	value any
+}
+
+// matchItem records that the array item at path was merged by discriminator.
+func (lc *layerContext) matchItem(path, field string, value any) {
+	if lc == nil {
+		return
+	}
+	if lc.items == nil {
+		lc.items = make(map[string]layerItem)
+	}
+	lc.items[path] = layerItem{field: field, value: value}
+}
+
+// keptValue resolves a keepLayer rule at path. It returns the named layer's
+// value once that layer has been merged, provided the layer defines the path.
+// Otherwise the field merges normally. The value is taken whole: an object
+// kept this way does not merge with the fields lower layers set. A name that
+// matches no layer is an error, so a misspelled layer does not silently lose
+// its precedence.
+func (lc *layerContext) keptValue(layerName, path string) (any, bool, error) {
+	if lc == nil {
+		return nil, false, nil
+	}
+	idx, ok := lc.index[layerName]
+	if !ok {
+		return nil, false, fmt.Errorf("keepLayer at %s: no layer is named %q", path, layerName)
+	}
+	if idx > lc.current {
+		return nil, false, nil
+	}
+	value, ok := lc.lookup(lc.docs[idx], path)
+	return value, ok, nil
+}
+
+// lookup returns the value at path within a layer document, matching array
+// items merged by discriminator by their discriminator value.
+func (lc *layerContext) lookup(doc any, path string) (any, bool) {
+	current, prefix := doc, ""
+	for _, segment := range splitPath(path) {
+		prefix = childPath(prefix, segment)
+		item, keyed := lc.items[prefix]
+		arr, isArr := current.([]any)
+		if !keyed || !isArr {
+			var ok bool
+			if current, ok = lookupSegment(current, segment); !ok {
+				return nil, false
+			}
+			continue
+		}
+		found := false
+		for _, candidate := range arr {
+			obj, isObj := candidate.(map[string]any)
+			if !isObj {
+				continue
+			}
+			if value, ok := obj[item.field]; ok && numberKey(value) == numberKey(item.value) {
+				current, found = candidate, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// MergeLayers merges named layers, ordered from lowest to highest precedence.
+// Each layer is validated once, and only the final result is validated.
+func (s *Schema) MergeLayers(layers ...Layer) ([]byte, error) {
+	result, err := s.MergeLayersWithOptions(DefaultMergeOptions(), layers...)
+	if err != nil {
+		return nil, err
+	}
+	return result.JSON, nil
+}
+
+// MergeLayersWithOptions merges named layers and reports the provenance of each
+// leaf value. The highest layer is validated as instance A and all lower layers
+// as instance B, so SkipValidateA and SkipValidateB apply accordingly.
+func (s *Schema) MergeLayersWithOptions(opts MergeOptions, layers ...Layer) (*LayeredResult, error) {
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("at least one layer is required")
+	}
+
+	lc := &layerContext{
+		index: make(map[string]int, len(layers)),
+		docs:  make([]any, len(layers)),
+	}
+	validator := NewValidator(s)
+	top := len(layers) - 1
+
+	for i, layer := range layers {
+		if layer.Name == "" {
+			return nil, fmt.Errorf("layer %d has no name", i)
+		}
+		if _, exists := lc.index[layer.Name]; exists {
+			return nil, fmt.Errorf("duplicate layer name %q", layer.Name)
+		}
+		lc.index[layer.Name] = i
+
+		skip, phase := opts.SkipValidateB, PhaseValidateB
+		if i == top {
+			skip, phase = opts.SkipValidateA, PhaseValidateA
+		}
+		doc, err := decodeJSON(layer.JSON)
+		if err != nil {
+			if skip {
+				return nil, fmt.Errorf("failed to parse layer %q: %w", layer.Name, err)
+			}
+			return nil, fmt.Errorf("layer %q validation failed: %w", layer.Name, invalidJSONError(err, phase))
+		}
+		if !skip {
+			validate := validator.ValidateValue
+			if i > 0 {
+				validate = validator.validateRequest
+			}
+			if err := validate(doc, phase); err != nil {
+				return nil, fmt.Errorf("layer %q validation failed: %w", layer.Name, err)
+			}
+		}
+		lc.docs[i] = doc
+	}
+
+	merger := newMergerWithOptions(s, opts)
+	merger.layers = lc
+
+	result := lc.docs[0]
+	provenance := recordProvenance(result, result, nil, layers[0].Name, nil)
+
+	// Apply defaults beneath the lowest layer: merge(layer0, defaults)
+	if s.shouldApplyDefaults(opts) {
+		defaults := s.ExtractDefaults()
+		if defaults != nil {
+			withDefaults, err := merger.Merge(result, defaults)
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply defaults to layer %q: %w", layers[0].Name, err)
+			}
+
+			defaultsProvenance := recordProvenance(defaults, defaults, nil, DefaultsLayerName, nil)
+			provenance = recordProvenance(withDefaults, result, defaults, layers[0].Name, defaultsProvenance)
+			result = withDefaults
+		}
+	}
+
+	for i := 1; i < len(layers); i++ {
+		lc.current, lc.items = i, nil
+		merged, err := merger.Merge(lc.docs[i], result)
+		if err != nil {
+			return nil, fmt.Errorf("merge of layer %q failed: %w", layers[i].Name, err)
+		}
+
+		provenance = recordProvenance(merged, lc.docs[i], result, layers[i].Name, provenance)
+		result = merged
+	}
+
+	if !opts.SkipValidateResult {
+		if err := validator.ValidateValue(result, PhaseValidateResult); err != nil {
+			return nil, fmt.Errorf("result validation failed: %w", err)
+		}
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	return &LayeredResult{JSON: resultJSON, Value: result, Provenance: provenance}, nil
+}
+
+// provenanceStep attributes the leaves of one merge step to layers.
+type provenanceStep struct {
+	upperName string
+	lower     map[string]string // attribution of the lower side's leaves
+	out       map[string]string
+}
+
+// record attributes every leaf of result. A leaf equal to the upper side's value
+// is attributed to the upper layer; a leaf carried over unchanged from the lower
+// side keeps its previous attribution. Values combined from both sides (e.g.
+// numeric sums) are attributed to the upper layer.
+func (p provenanceStep) record(result, upper, lower any, upperHas, lowerHas bool, path string) {
+	if resultMap, ok := result.(map[string]any); ok && len(resultMap) > 0 {
+		upperMap, _ := upper.(map[string]any)
+		lowerMap, _ := lower.(map[string]any)
+		for k, v := range resultMap {
+			upperVal, upperHasKey := upperMap[k]
+			lowerVal, lowerHasKey := lowerMap[k]
+			p.record(v, upperVal, lowerVal, upperHasKey, lowerHasKey, childPath(path, k))
+		}
+		return
+	}
+
+	if upperHas && reflect.DeepEqual(result, upper) {
+		p.out[path] = p.upperName
+		return
+	}
+	if name, ok := p.lower[path]; ok && lowerHas && reflect.DeepEqual(result, lower) {
+		p.out[path] = name
+		return
+	}
+	p.out[path] = p.upperName
+}
+
+// recordProvenance attributes the leaves of a merge of upper onto lower.
+func recordProvenance(result, upper, lower any, upperName string, lowerProvenance map[string]string) map[string]string {
+	out := make(map[string]string)
+	provenanceStep{upperName: upperName, lower: lowerProvenance, out: out}.record(result, upper, lower, true, lower != nil, "")
+	return out
+}
+
+// lookupPath returns the value at an instance path within a decoded JSON document.
+func lookupPath(doc any, path string) (any, bool) {
+	current := doc
+	for _, segment := range splitPath(path) {
+		var ok bool
+		if current, ok = lookupSegment(current, segment); !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// lookupSegment returns the member or item of node named by one path segment.
+func lookupSegment(node any, segment string) (any, bool) {
+	switch node := node.(type) {
+	case map[string]any:
+		value, ok := node[segment]
+		return value, ok
+	case []any:
+		idx, err := strconv.Atoi(segment)
+		if err != nil || idx < 0 || idx >= len(node) {
+			return nil, false
+		}
+		return node[idx], true
+	default:
+		return nil, false
+	}
+}
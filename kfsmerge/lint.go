@@ -0,0 +1,498 @@
+package kfsmerge
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Lint warning codes.
+const (
+	// LintMissingDiscriminator flags arrays of objects with an identifying
+	// property that are not merged by discriminator.
+	LintMissingDiscriminator = "missing-discriminator"
+	// LintKeepRequestRequiredDefault flags keepRequest on required fields with
+	// a default, which is never used.
+	LintKeepRequestRequiredDefault = "keeprequest-required-default"
+	// LintNullHandlingNotNullable flags nullHandling on fields that cannot be null.
+	LintNullHandlingNotNullable = "nullhandling-not-nullable"
+	// LintUnusedDefRules flags rules in definitions that are never referenced.
+	LintUnusedDefRules = "unused-def-rules"
+	// LintShadowedRule flags rules that another rule for the same field overrides.
+	LintShadowedRule = "shadowed-rule"
+)
+
+// discriminatorCandidates are the item properties suggested as discriminator
+// field, in order of preference.
+var discriminatorCandidates = []string{"id", "name", "type"}
+
+// LintWarning is a likely mistake in the merge rules of a schema.
+type LintWarning struct {
+	// Pointer locates the schema node: "#/pointer" in the schema document,
+	// "uri#/pointer" in a referenced document.
+	Pointer string
+	Code    string
+	Message string
+	// Fix is the suggested x-kfs-merge for the node, if there is one.
+	Fix map[string]any
+}
+
+// String formats the warning as "pointer: message (code)".
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%s: %s (%s)", w.Pointer, w.Message, w.Code)
+}
+
+// Lint reports likely mistakes in the merge rules of the schema and the
+// documents it references, ordered by pointer.
+func (s *Schema) Lint() []LintWarning {
+	var warnings []LintWarning
+	for _, uri := range sortedKeys(s.docs) {
+		warnings = append(warnings, s.lintFields(uri)...)
+	}
+	warnings = append(warnings, s.lintUnusedDefs()...)
+	warnings = append(warnings, s.lintShadowedRules()...)
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		if warnings[i].Pointer != warnings[j].Pointer {
+			return warnings[i].Pointer < warnings[j].Pointer
+		}
+		return warnings[i].Code < warnings[j].Code
+	})
+	return warnings
+}
+
+// LintFixRules returns the suggested fixes of warnings as a rules document for
+// WithRules. Fixes for referenced documents are left out, as rules apply to
+// the schema document only.
+func LintFixRules(warnings []LintWarning) map[string]any {
+	rules := make(map[string]any)
+	for _, w := range warnings {
+		if w.Fix == nil || !strings.HasPrefix(w.Pointer, "#") {
+			continue
+		}
+		rule, _ := rules[w.Pointer].(map[string]any)
+		if rule == nil {
+			rule = make(map[string]any)
+			rules[w.Pointer] = rule
+		}
+		for key, value := range w.Fix {
+			rule[key] = value
+		}
+	}
+	return rules
+}
+
+// lintPointer formats a location for a warning.
+func (s *Schema) lintPointer(at location) string {
+	if at.doc == s.baseURI {
+		return "#" + at.pointer
+	}
+	return at.doc + "#" + at.pointer
+}
+
+// lintFields checks the rules of every field of a document.
+func (s *Schema) lintFields(uri string) []LintWarning {
+	// Collect the fields and required fields first; both are declared by the parent.
+	fields := map[string]bool{"": true}
+	required := make(map[string]bool)
+	walkSchema(s.docs[uri], uri, uri, "", false, func(node map[string]any, _ string, at location) {
+		for _, keyword := range []string{"properties", "patternProperties", "$defs", "definitions"} {
+			entries, _ := node[keyword].(map[string]any)
+			for name := range entries {
+				fields[at.pointer+"/"+keyword+"/"+escapePointer(name)] = true
+			}
+		}
+		for _, keyword := range []string{"items", "additionalProperties"} {
+			if _, ok := node[keyword].(map[string]any); ok {
+				fields[at.pointer+"/"+keyword] = true
+			}
+		}
+		names, _ := node["required"].([]any)
+		for _, name := range names {
+			if name, ok := name.(string); ok {
+				required[at.pointer+"/properties/"+escapePointer(name)] = true
+			}
+		}
+	})
+
+	var warnings []LintWarning
+	walkSchema(s.docs[uri], uri, uri, "", false, func(node map[string]any, _ string, at location) {
+		if !fields[at.pointer] {
+			return
+		}
+		warn := func(code, message string, fix map[string]any) {
+			warnings = append(warnings, LintWarning{Pointer: s.lintPointer(at), Code: code, Message: message, Fix: fix})
+		}
+		config, hasRule := s.declaredConfig(node, make(map[string]bool))
+
+		if field := s.discriminatorSuggestion(node); field != "" && config.Strategy == "" {
+			warn(LintMissingDiscriminator,
+				fmt.Sprintf("array items have a %q property but are not merged by discriminator; arrayStrategy %q applies", field, s.globalConfig.ArrayStrategy),
+				map[string]any{"strategy": string(StrategyMergeByDiscriminator), "discriminatorField": field})
+		}
+
+		if !hasRule {
+			return
+		}
+		if config.Strategy == StrategyKeepRequest && required[at.pointer] && s.hasDefault(node, make(map[string]bool)) {
+			warn(LintKeepRequestRequiredDefault, "keepRequest on a required field: the request always supplies it, so its default is never used", nil)
+		}
+		if own, ok := node[MergeExtensionKey].(map[string]any); ok && own["nullHandling"] != nil {
+			if types, known := s.schemaTypes(node, make(map[string]bool)); known && !types["null"] {
+				warn(LintNullHandlingNotNullable, fmt.Sprintf("nullHandling %q has no effect: the field cannot be null", own["nullHandling"]), nil)
+			}
+		}
+	})
+	return warnings
+}
+
+// declaredConfig returns the rule a schema node declares, directly or through
+// its $ref or composition keywords, with the precedence LoadSchema applies.
+func (s *Schema) declaredConfig(node map[string]any, visiting map[string]bool) (FieldMergeConfig, bool) {
+	if mergeMap, ok := node[MergeExtensionKey].(map[string]any); ok {
+		config, err := s.parseNodeMergeConfig(node, mergeMap)
+		return config, err == nil
+	}
+	if ref, ok := schemaRef(node); ok {
+		if defName, ok := s.resolveRef(ref); ok && !visiting[defName] {
+			if defNode, ok := s.defNode(defName); ok {
+				visiting[defName] = true
+				if config, ok := s.declaredConfig(defNode, visiting); ok {
+					return config, true
+				}
+			}
+		}
+	}
+	for _, sub := range s.compositionSubschemas(node) {
+		if config, ok := s.declaredConfig(sub, visiting); ok {
+			return config, true
+		}
+	}
+	return FieldMergeConfig{}, false
+}
+
+// hasDefault reports whether a schema node, or the schema it references,
+// declares a default.
+func (s *Schema) hasDefault(node map[string]any, visiting map[string]bool) bool {
+	if _, ok := node["default"]; ok {
+		return true
+	}
+	if ref, ok := schemaRef(node); ok {
+		if defName, ok := s.resolveRef(ref); ok && !visiting[defName] {
+			if defNode, ok := s.defNode(defName); ok {
+				visiting[defName] = true
+				return s.hasDefault(defNode, visiting)
+			}
+		}
+	}
+	return false
+}
+
+// discriminatorSuggestion returns the discriminator field to suggest for an
+// array of objects: the items' declared discriminator.propertyName, or else
+// the first of discriminatorCandidates all items have. It returns "" for
+// other schemas.
+func (s *Schema) discriminatorSuggestion(node map[string]any) string {
+	items, ok := s.arrayItems(node, make(map[string]bool))
+	if !ok {
+		return ""
+	}
+	if discriminator, ok := items["discriminator"].(map[string]any); ok {
+		if field, ok := discriminator["propertyName"].(string); ok {
+			return field
+		}
+	}
+	props := s.objectPropertyNames(items, make(map[string]bool))
+	for _, candidate := range discriminatorCandidates {
+		if props[candidate] {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// arrayItems returns the items schema of a node that is an array, following
+// $refs and the alternatives of oneOf/anyOf (such as an optional array).
+func (s *Schema) arrayItems(node map[string]any, visiting map[string]bool) (map[string]any, bool) {
+	if items, ok := node["items"].(map[string]any); ok {
+		return items, true
+	}
+	if ref, ok := schemaRef(node); ok {
+		if defName, ok := s.resolveRef(ref); ok && !visiting[defName] {
+			if defNode, ok := s.defNode(defName); ok {
+				visiting[defName] = true
+				return s.arrayItems(defNode, visiting)
+			}
+		}
+		return nil, false
+	}
+	for _, keyword := range []string{"anyOf", "oneOf", "allOf"} {
+		alts, _ := node[keyword].([]any)
+		for _, alt := range alts {
+			if altMap, ok := alt.(map[string]any); ok {
+				if items, ok := s.arrayItems(altMap, visiting); ok {
+					return items, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// objectPropertyNames returns the properties every instance of an object
+// schema can have, following $refs and allOf. For oneOf/anyOf it returns the
+// properties all object alternatives share.
+func (s *Schema) objectPropertyNames(node map[string]any, visiting map[string]bool) map[string]bool {
+	names := make(map[string]bool)
+	if props, ok := node["properties"].(map[string]any); ok {
+		for name := range props {
+			names[name] = true
+		}
+	}
+	if ref, ok := schemaRef(node); ok {
+		if defName, ok := s.resolveRef(ref); ok && !visiting[defName] {
+			if defNode, ok := s.defNode(defName); ok {
+				visiting[defName] = true
+				for name := range s.objectPropertyNames(defNode, visiting) {
+					names[name] = true
+				}
+				delete(visiting, defName)
+			}
+		}
+	}
+	if parts, ok := node["allOf"].([]any); ok {
+		for _, part := range parts {
+			if partMap, ok := part.(map[string]any); ok {
+				for name := range s.objectPropertyNames(partMap, visiting) {
+					names[name] = true
+				}
+			}
+		}
+	}
+	for _, keyword := range []string{"oneOf", "anyOf"} {
+		alts, ok := node[keyword].([]any)
+		if !ok {
+			continue
+		}
+		var shared map[string]bool
+		for _, alt := range alts {
+			altMap, ok := alt.(map[string]any)
+			if !ok || !s.isObjectBranch(altMap) {
+				continue
+			}
+			altNames := s.objectPropertyNames(altMap, visiting)
+			if shared == nil {
+				shared = altNames
+				continue
+			}
+			for name := range shared {
+				if !altNames[name] {
+					delete(shared, name)
+				}
+			}
+		}
+		for name := range shared {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// lintUnusedDefs reports definitions of the schema document that declare
+// rules but are not reachable from the root.
+func (s *Schema) lintUnusedDefs() []LintWarning {
+	reachable := make(map[string]bool)
+	var visit func(node any)
+	visit = func(node any) {
+		walkSchema(node, "", "", "", false, func(node map[string]any, _ string, _ location) {
+			for _, keyword := range []string{"$ref", "$dynamicRef"} {
+				ref, ok := node[keyword].(string)
+				if !ok {
+					continue
+				}
+				defName, ok := s.resolveRef(ref)
+				if !ok {
+					continue
+				}
+				// A reference into a definition reaches the whole definition.
+				for _, k := range defsKeywords {
+					if rest, ok := strings.CutPrefix(defName, "#/"+k+"/"); ok {
+						name, _, _ := strings.Cut(rest, "/")
+						if name = unescapePointer(name); s.defsKeyword(name) == k {
+							defName = name
+						}
+					}
+				}
+				if reachable[defName] {
+					continue
+				}
+				reachable[defName] = true
+				if defNode, ok := s.defNode(defName); ok {
+					visit(defNode)
+				}
+			}
+		})
+	}
+	root := make(map[string]any, len(s.raw))
+	for key, value := range s.raw {
+		if key != "$defs" && key != "definitions" {
+			root[key] = value
+		}
+	}
+	visit(root)
+
+	var warnings []LintWarning
+	for _, keyword := range defsKeywords {
+		defs, _ := s.raw[keyword].(map[string]any)
+		for _, name := range sortedKeys(defs) {
+			defNode, ok := defs[name].(map[string]any)
+			if !ok || reachable[name] || s.defsKeyword(name) != keyword || !declaresRules(defNode) {
+				continue
+			}
+			warnings = append(warnings, LintWarning{
+				Pointer: "#/" + keyword + "/" + escapePointer(name),
+				Code:    LintUnusedDefRules,
+				Message: "the definition declares merge rules but is never referenced, so they never apply",
+			})
+		}
+	}
+	return warnings
+}
+
+// declaresRules reports whether a schema node or any subschema has x-kfs-merge.
+func declaresRules(node map[string]any) bool {
+	found := false
+	walkSchema(node, "", "", "", false, func(node map[string]any, _ string, _ location) {
+		if _, ok := node[MergeExtensionKey]; ok {
+			found = true
+		}
+	})
+	return found
+}
+
+// ruleCandidate is a rule declared for a field at a schema location, and the
+// number of $refs followed to reach it.
+type ruleCandidate struct {
+	pointer string
+	config  FieldMergeConfig
+	refs    int
+}
+
+// lintShadowedRules reports rules that do not take effect because another
+// rule for the same field takes precedence, such as a rule in a later allOf
+// branch than a referenced definition with rules. Rules of a referenced
+// definition overridden where it is referenced are deliberate and not reported.
+func (s *Schema) lintShadowedRules() []LintWarning {
+	candidates := make(map[string][]ruleCandidate)
+	var walk func(path string, at location, node map[string]any, visiting map[string]bool, refs int)
+	walk = func(path string, at location, node map[string]any, visiting map[string]bool, refs int) {
+		if mergeMap, ok := node[MergeExtensionKey].(map[string]any); ok && path != "" {
+			if config, err := s.parseNodeMergeConfig(node, mergeMap); err == nil {
+				candidates[path] = append(candidates[path], ruleCandidate{pointer: s.lintPointer(at), config: config, refs: refs})
+			}
+		}
+
+		if ref, ok := schemaRef(node); ok {
+			if defName, ok := s.resolveRef(ref); ok && !visiting[defName] {
+				if defNode, ok := s.defNode(defName); ok {
+					visiting[defName] = true
+					walk(path, s.defLocationOf(defName), defNode, visiting, refs+1)
+					delete(visiting, defName)
+				}
+			}
+		}
+		child := func(suffix string) location {
+			return location{doc: at.doc, pointer: at.pointer + suffix}
+		}
+		if props, ok := node["properties"].(map[string]any); ok {
+			for _, name := range sortedKeys(props) {
+				if propMap, ok := props[name].(map[string]any); ok {
+					walk(childPath(path, name), child("/properties/"+escapePointer(name)), propMap, visiting, refs)
+				}
+			}
+		}
+		if items, ok := node["items"].(map[string]any); ok {
+			walk(path+"/items", child("/items"), items, visiting, refs)
+		}
+		if additional, ok := node["additionalProperties"].(map[string]any); ok {
+			walk(childPath(path, additionalSegment), child("/additionalProperties"), additional, visiting, refs)
+		}
+		if patterns, ok := node["patternProperties"].(map[string]any); ok {
+			for _, pattern := range sortedKeys(patterns) {
+				if sub, ok := patterns[pattern].(map[string]any); ok {
+					walk(childPath(path, patternSegment(pattern)), child("/patternProperties/"+escapePointer(pattern)), sub, visiting, refs)
+				}
+			}
+		}
+		for _, keyword := range compositionKeywords {
+			switch value := node[keyword].(type) {
+			case []any:
+				if (keyword == "oneOf" || keyword == "anyOf") && s.isUnion(value) {
+					continue
+				}
+				for i, alt := range value {
+					if altMap, ok := alt.(map[string]any); ok {
+						walk(path, child(fmt.Sprintf("/%s/%d", keyword, i)), altMap, visiting, refs)
+					}
+				}
+			case map[string]any:
+				if keyword != "dependentSchemas" {
+					walk(path, child("/"+keyword), value, visiting, refs)
+					continue
+				}
+				for _, name := range sortedKeys(value) {
+					if sub, ok := value[name].(map[string]any); ok {
+						walk(path, child("/dependentSchemas/"+escapePointer(name)), sub, visiting, refs)
+					}
+				}
+			}
+		}
+	}
+	walk("", location{doc: s.baseURI}, s.raw, map[string]bool{rootDefName: true}, 0)
+
+	var warnings []LintWarning
+	seen := make(map[string]bool)
+	for _, path := range sortedKeys(candidates) {
+		effective, ok := s.FieldConfig(path)
+		if !ok {
+			continue
+		}
+		winner := ruleCandidate{refs: -1}
+		for _, c := range candidates[path] {
+			if reflect.DeepEqual(c.config, effective) {
+				winner = c
+				break
+			}
+		}
+		for _, c := range candidates[path] {
+			if c.pointer == winner.pointer || reflect.DeepEqual(c.config, effective) || seen[c.pointer] {
+				continue
+			}
+			if winner.refs >= 0 && c.refs > winner.refs {
+				continue
+			}
+			seen[c.pointer] = true
+			message := fmt.Sprintf("the rule for %s is overridden", path)
+			if winner.pointer != "" {
+				message = fmt.Sprintf("the rule for %s is overridden by the rule at %s", path, winner.pointer)
+			}
+			warnings = append(warnings, LintWarning{Pointer: c.pointer, Code: LintShadowedRule, Message: message})
+		}
+	}
+	return warnings
+}
+
+// defLocationOf returns the document and pointer of a definition.
+func (s *Schema) defLocationOf(defName string) location {
+	switch i := strings.Index(defName, "#"); {
+	case defName == rootDefName:
+		return location{doc: s.baseURI}
+	case i < 0:
+		return location{doc: s.baseURI, pointer: "/" + s.defsKeyword(defName) + "/" + escapePointer(defName)}
+	case i == 0:
+		return location{doc: s.baseURI, pointer: defName[1:]}
+	default:
+		return location{doc: defName[:i], pointer: defName[i+1:]}
+	}
+}
@@ -0,0 +1,284 @@
+package kfsmerge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Loader fetches schema documents by URI. The schema passed to
+// LoadSchemaWithLoader and every document it references are fetched through
+// the same Loader.
+type Loader interface {
+	Load(ctx context.Context, uri string) ([]byte, error)
+}
+
+const (
+	// DefaultHTTPTimeout bounds a single schema fetch over HTTP.
+	DefaultHTTPTimeout = 30 * time.Second
+	// DefaultMaxSchemaBytes is the largest schema document fetched over HTTP.
+	DefaultMaxSchemaBytes = 10 << 20
+)
+
+// LoadSchemaWithLoader loads the schema at uri, and every document it
+// references, through loader.
+func LoadSchemaWithLoader(ctx context.Context, uri string, loader Loader, opts ...LoadOption) (*Schema, error) {
+	data, err := loader.Load(ctx, uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema %q: %w", uri, err)
+	}
+	opts = append([]LoadOption{WithBaseURI(uri), WithLoader(loader), WithContext(ctx)}, opts...)
+	return LoadSchema(data, opts...)
+}
+
+// MapLoader serves schema documents from memory, keyed by URI.
+type MapLoader map[string][]byte
+
+// Load implements Loader.
+func (l MapLoader) Load(_ context.Context, uri string) ([]byte, error) {
+	data, ok := l[uri]
+	if !ok {
+		return nil, fmt.Errorf("schema %q: %w", uri, fs.ErrNotExist)
+	}
+	return data, nil
+}
+
+// FSLoader serves schema documents from a file system, such as an embed.FS.
+// URIs are slash-separated paths within it; a file:// scheme is ignored.
+type FSLoader struct {
+	FS fs.FS
+}
+
+// NewFSLoader returns a Loader reading from fsys.
+func NewFSLoader(fsys fs.FS) *FSLoader {
+	return &FSLoader{FS: fsys}
+}
+
+// NewDirLoader returns a Loader reading from the directory tree rooted at dir.
+// References cannot escape dir.
+func NewDirLoader(dir string) *FSLoader {
+	return &FSLoader{FS: os.DirFS(dir)}
+}
+
+// Load implements Loader.
+func (l *FSLoader) Load(ctx context.Context, uri string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "" && u.Scheme != "file" {
+		return nil, fmt.Errorf("unsupported URI scheme %q", u.Scheme)
+	}
+	name := strings.TrimPrefix(path.Clean("/"+u.Path), "/")
+	return fs.ReadFile(l.FS, name)
+}
+
+// HTTPLoader fetches schema documents over HTTP(S).
+type HTTPLoader struct {
+	// Client is the HTTP client to use; http.DefaultClient when nil.
+	Client *http.Client
+	// Timeout bounds each fetch; DefaultHTTPTimeout when zero.
+	Timeout time.Duration
+	// MaxBodyBytes is the largest accepted document; DefaultMaxSchemaBytes when zero.
+	MaxBodyBytes int64
+	// AllowedHosts restricts fetches, and the redirects they follow, to these
+	// hosts when non-empty. An entry "*.example.com" allows every subdomain
+	// of example.com.
+	AllowedHosts []string
+	// CacheDir, when set, stores fetched documents. Documents served with an
+	// ETag are revalidated with If-None-Match. A cached document is also used
+	// when the server cannot be reached.
+	CacheDir string
+}
+
+// Load implements Loader.
+func (l *HTTPLoader) Load(ctx context.Context, uri string) ([]byte, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URI scheme %q", u.Scheme)
+	}
+	if !l.hostAllowed(u.Hostname()) {
+		return nil, fmt.Errorf("host %q is not allowed", u.Hostname())
+	}
+
+	timeout := l.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(fetchCtx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	cached, etag := l.readCache(uri)
+	if cached != nil && etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := l.client().Do(req)
+	if err != nil {
+		// Offline or timed out: the cached copy stands in, unless the caller
+		// gave up.
+		if cached != nil && ctx.Err() == nil {
+			return cached, nil
+		}
+		return nil, fmt.Errorf("failed to fetch schema from URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch schema: HTTP %d", resp.StatusCode)
+	}
+
+	maxBytes := l.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxSchemaBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema response: %w", err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("schema response exceeds %d bytes", maxBytes)
+	}
+
+	if err := l.writeCache(uri, data, resp.Header.Get("ETag")); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// client returns a copy of the configured client, or of http.DefaultClient,
+// that refuses redirects to hosts that are not allowed.
+func (l *HTTPLoader) client() *http.Client {
+	client := http.DefaultClient
+	if l.Client != nil {
+		client = l.Client
+	}
+	checked := *client
+	checkRedirect := client.CheckRedirect
+	checked.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if !l.hostAllowed(req.URL.Hostname()) {
+			return fmt.Errorf("redirect to host %q is not allowed", req.URL.Hostname())
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &checked
+}
+
+// hostAllowed reports whether host may be fetched from.
+func (l *HTTPLoader) hostAllowed(host string) bool {
+	if len(l.AllowedHosts) == 0 {
+		return true
+	}
+	for _, allowed := range l.AllowedHosts {
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok && strings.HasSuffix(host, suffix) {
+			return true
+		}
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// cachePath returns the cache file of a URI, without extension.
+func (l *HTTPLoader) cachePath(uri string) string {
+	sum := sha256.Sum256([]byte(uri))
+	return filepath.Join(l.CacheDir, hex.EncodeToString(sum[:]))
+}
+
+// readCache returns the cached document of a URI and its ETag, which is empty
+// when the server sent none.
+func (l *HTTPLoader) readCache(uri string) ([]byte, string) {
+	if l.CacheDir == "" {
+		return nil, ""
+	}
+	base := l.cachePath(uri)
+	data, err := os.ReadFile(base + ".json")
+	if err != nil {
+		return nil, ""
+	}
+	etag, err := os.ReadFile(base + ".etag")
+	if err != nil {
+		return data, ""
+	}
+	return data, string(etag)
+}
+
+// writeCache stores a fetched document and its ETag, if any.
+func (l *HTTPLoader) writeCache(uri string, data []byte, etag string) error {
+	if l.CacheDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(l.CacheDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create schema cache: %w", err)
+	}
+	base := l.cachePath(uri)
+	if err := os.WriteFile(base+".json", data, 0o644); err != nil {
+		return fmt.Errorf("failed to write schema cache: %w", err)
+	}
+	if etag == "" {
+		if err := os.Remove(base + ".etag"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to write schema cache: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(base+".etag", []byte(etag), 0o644); err != nil {
+		return fmt.Errorf("failed to write schema cache: %w", err)
+	}
+	return nil
+}
+
+// offlineLoader fetches nothing. LoadSchema uses it when no Loader is given,
+// so a schema loaded from bytes never reads files or the network.
+type offlineLoader struct{}
+
+// Load implements Loader.
+func (offlineLoader) Load(context.Context, string) ([]byte, error) {
+	return nil, errors.New("external documents are only loaded with WithLoader, WithResource or LoadSchemaFromFile")
+}
+
+// fileLoader reads file paths and file:// URIs from disk. LoadSchemaFromFile
+// uses it when no Loader is given.
+type fileLoader struct{}
+
+// Load implements Loader.
+func (fileLoader) Load(_ context.Context, uri string) ([]byte, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "file" && u.Scheme != "" {
+		return nil, fmt.Errorf("%s documents are only loaded with WithLoader, e.g. an HTTPLoader", u.Scheme)
+	}
+	return os.ReadFile(u.Path)
+}
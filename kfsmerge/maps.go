@@ -0,0 +1,98 @@
+package kfsmerge
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// additionalSegment is the path segment under which rules declared in
+// additionalProperties are stored.
+const additionalSegment = "{additionalProperties}"
+
+// mapInfo describes an object whose keys are not all declared in properties.
+type mapInfo struct {
+	properties map[string]bool
+	patterns   []mapPattern
+	additional bool
+}
+
+// mapPattern is a patternProperties entry and the path segment its rules are stored under.
+type mapPattern struct {
+	re      *regexp.Regexp
+	segment string
+}
+
+// patternSegment returns the path segment under which rules declared in a
+// patternProperties entry are stored.
+func patternSegment(pattern string) string {
+	return "{patternProperties:" + pattern + "}"
+}
+
+// parseMapInfo returns the map description of an object schema node, or nil if
+// the node declares neither additionalProperties nor patternProperties subschemas.
+func parseMapInfo(node map[string]any) (*mapInfo, error) {
+	_, hasAdditional := node["additionalProperties"].(map[string]any)
+	patternProps, hasPatterns := node["patternProperties"].(map[string]any)
+	if !hasAdditional && !hasPatterns {
+		return nil, nil
+	}
+
+	info := &mapInfo{properties: make(map[string]bool), additional: hasAdditional}
+	if props, ok := node["properties"].(map[string]any); ok {
+		for propName := range props {
+			info.properties[propName] = true
+		}
+	}
+
+	patterns := make([]string, 0, len(patternProps))
+	for pattern := range patternProps {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid patternProperties pattern %q: %w", pattern, err)
+		}
+		info.patterns = append(info.patterns, mapPattern{re: re, segment: patternSegment(pattern)})
+	}
+	return info, nil
+}
+
+// segmentFor maps a dynamic key to the segment its rules are stored under.
+// Declared properties and keys not covered by the map keep their own name.
+func (info *mapInfo) segmentFor(key string) string {
+	if info.properties[key] {
+		return key
+	}
+	for _, p := range info.patterns {
+		if p.re.MatchString(key) {
+			return p.segment
+		}
+	}
+	if info.additional {
+		return additionalSegment
+	}
+	return key
+}
+
+// mapSubschemas calls fn for the additionalProperties and patternProperties
+// subschemas of node with the path segment their rules are stored under.
+func mapSubschemas(node map[string]any, fn func(segment string, sub map[string]any) error) error {
+	if additional, ok := node["additionalProperties"].(map[string]any); ok {
+		if err := fn(additionalSegment, additional); err != nil {
+			return err
+		}
+	}
+	if patternProps, ok := node["patternProperties"].(map[string]any); ok {
+		for pattern, sub := range patternProps {
+			if subMap, ok := sub.(map[string]any); ok {
+				if err := fn(patternSegment(pattern), subMap); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -1,13 +1,46 @@
 package kfsmerge
 
+import (
+	"fmt"
+)
+
 // Merger merges two JSON instances according to schema-defined rules.
 type Merger struct {
-	schema *Schema
+	schema       *Schema
+	layers       *layerContext            // nil unless merging named layers
+	branches     map[string]*activeBranch // union branches being merged, by path, for when predicates
+	rootA, rootB any                      // documents of the current Merge call, for when predicates
+	evaluating   map[string]bool          // merged paths being resolved for when predicates
+	maxDepth     int                      // maximum nesting depth of merged values
+}
+
+// MaxDepthError is returned when merging descends deeper than the maximum
+// merge depth, e.g. into deeply nested instances of a recursive schema.
+type MaxDepthError struct {
+	Path     string
+	MaxDepth int
+}
+
+// Error implements the error interface.
+func (e MaxDepthError) Error() string {
+	return fmt.Sprintf("merge exceeded maximum depth %d at %s", e.MaxDepth, e.Path)
 }
 
 // NewMerger creates a new Merger for the given schema.
 func NewMerger(s *Schema) *Merger {
-	return &Merger{schema: s}
+	return &Merger{
+		schema:     s,
+		branches:   make(map[string]*activeBranch),
+		evaluating: make(map[string]bool),
+		maxDepth:   DefaultMaxMergeDepth,
+	}
+}
+
+// newMergerWithOptions creates a Merger honoring the merge limits of opts.
+func newMergerWithOptions(s *Schema, opts MergeOptions) *Merger {
+	m := NewMerger(s)
+	m.maxDepth = opts.MaxDepthOrDefault()
+	return m
 }
 
 // Merge merges instance A into instance B according to the schema's merge rules.
@@ -15,21 +48,82 @@ func NewMerger(s *Schema) *Merger {
 // Parameter b is the base/template instance (typically defaults or template configuration).
 // By default, a takes precedence over b (request overrides base).
 func (m *Merger) Merge(a, b any) (any, error) {
-	return m.mergeValues(a, b, "")
+	m.rootA, m.rootB = a, b
+	return m.mergeValues(a, b, "", planCursor{node: m.schema.plan})
+}
+
+// mergeValues recursively merges two values at the given path, at the
+// cursor's position in the merge plan.
+func (m *Merger) mergeValues(a, b any, path string, at planCursor) (any, error) {
+	return m.mergeValuesAs(a, b, path, at, FieldMergeConfig{})
 }
 
-// mergeValues recursively merges two values at the given path.
-func (m *Merger) mergeValues(a, b any, path string) (any, error) {
-	a, b = m.handleNulls(a, b, path)
-	config := m.getFieldConfig(a, path)
+// mergeValuesAs merges two values at the given path. Fields without an explicit
+// strategy use inherited's strategy and depth, or the global default when
+// inherited has no strategy.
+func (m *Merger) mergeValuesAs(a, b any, path string, at planCursor, inherited FieldMergeConfig) (any, error) {
+	if at.depth > m.maxDepth {
+		return nil, MaxDepthError{Path: path, MaxDepth: m.maxDepth}
+	}
+
+	a, b = m.handleNulls(a, b, at)
+
+	// Polymorphic oneOf/anyOf: values of different branches are not blended,
+	// and values of the same branch are merged with that branch's rules.
+	conflict := false
+	if at.node != nil && at.node.union != nil {
+		union := at.node.union
+		var branch *unionBranch
+		branch, conflict = union.resolveUnion(a, b)
+		if branch != nil {
+			m.branches[path] = &activeBranch{union: union, branch: branch}
+			defer delete(m.branches, path)
+			at.branch = branch.plan
+		}
+	}
+
+	config, err := m.getFieldConfig(a, path, at, inherited)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.KeepLayer != "" {
+		value, ok, err := m.layers.keptValue(config.KeepLayer, path)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return value, nil
+		}
+	}
+
+	// Strategies that blend objects keep one side of a branch conflict whole;
+	// all other strategies apply as configured.
+	if conflict {
+		switch config.Strategy {
+		case StrategyDeepMerge, StrategyShallowMerge:
+			return a, nil
+		case StrategyDeepMergeBaseWins:
+			return b, nil
+		}
+	}
+
+	return m.applyStrategy(a, b, path, at, config)
+}
 
+// applyStrategy merges two values at the given path with the configured strategy.
+func (m *Merger) applyStrategy(a, b any, path string, at planCursor, config FieldMergeConfig) (any, error) {
 	switch config.Strategy {
 	case StrategyKeepBase:
 		return b, nil
 	case StrategyKeepRequest:
 		return a, nil
 	case StrategyDeepMerge:
-		return m.deepMerge(a, b, path)
+		return m.deepMergeKeys(a, b, path, at, config.MapKeysOrDefault())
+	case StrategyDeepMergeBaseWins:
+		return m.deepMergeBaseWins(a, b, path, at)
+	case StrategyShallowMerge:
+		return m.shallowMerge(a, b, path, at, config.DepthOrDefault())
 	case StrategyReplace:
 		if a != nil {
 			return a, nil
@@ -38,49 +132,117 @@ func (m *Merger) mergeValues(a, b any, path string) (any, error) {
 	case StrategyConcat:
 		return m.concatArrays(a, b, config.UniqueOrDefault())
 	case StrategyMergeByDiscriminator:
-		return m.mergeByDiscriminator(a, b, config.DiscriminatorField, config.ReplaceOnMatchOrDefault(), path)
+		return m.mergeByDiscriminator(a, b, config, path, at)
 	case StrategyNumeric:
-		return m.numericOperation(a, b, config.OperationOrDefault())
+		return m.numericOperation(a, b, path, config)
+	case StrategySemver:
+		return m.semverOperation(a, b, path, config)
+	case StrategyTemporal:
+		return m.temporalOperation(a, b, path, config)
+	case StrategyQuantity:
+		return m.quantityOperation(a, b, path, config)
+	case StrategyStringJoin:
+		return m.joinStrings(a, b, path, at, config)
 	default:
-		return m.deepMerge(a, b, path)
+		return m.deepMerge(a, b, path, at)
 	}
 }
 
 // getFieldConfig determines the merge configuration for a given path.
-func (m *Merger) getFieldConfig(a any, path string) FieldMergeConfig {
-	if config, ok := m.schema.FieldConfig(path); ok && config.Strategy != "" {
-		return config
+// A matching when clause replaces the configuration. Options such as keepLayer
+// are kept when the strategy falls back to the inherited strategy or the
+// global default.
+func (m *Merger) getFieldConfig(a any, path string, at planCursor, inherited FieldMergeConfig) (FieldMergeConfig, error) {
+	config, _ := at.fieldConfig()
+	config, err := m.resolveWhen(config, path)
+	if err != nil {
+		return FieldMergeConfig{}, err
+	}
+
+	if config.Strategy != "" {
+		return config, nil
+	}
+	if inherited.Strategy != "" {
+		config.Strategy = inherited.Strategy
+		if config.Depth == nil {
+			config.Depth = inherited.Depth
+		}
+		return config, nil
 	}
 
 	globalConfig := m.schema.GlobalConfig()
 	if _, isArray := a.([]any); isArray {
-		return FieldMergeConfig{Strategy: globalConfig.ArrayStrategy}
+		config.Strategy = globalConfig.ArrayStrategy
+	} else {
+		config.Strategy = globalConfig.DefaultStrategy
+	}
+	return config, nil
+}
+
+// resolveWhen returns the configuration of the first when clause of config
+// whose predicate holds, or config itself, without when clauses.
+func (m *Merger) resolveWhen(config FieldMergeConfig, path string) (FieldMergeConfig, error) {
+	for _, clause := range config.When {
+		matched, err := m.evalPredicate(clause.If)
+		if err != nil {
+			return FieldMergeConfig{}, fmt.Errorf("failed to evaluate when predicate at %s: %w", path, err)
+		}
+		if matched {
+			config = clause.Then
+			break
+		}
 	}
+	config.When = nil
+	return config, nil
+}
 
-	return FieldMergeConfig{Strategy: globalConfig.DefaultStrategy}
+// cursorAt returns the plan cursor of an instance path, within the innermost
+// union branch being merged that contains it.
+func (m *Merger) cursorAt(path string) planCursor {
+	at := planCursor{node: m.schema.plan}
+	if active, ok := m.branches[""]; ok {
+		at.branch = active.branch.plan
+	}
+	prefix := ""
+	for _, segment := range splitPath(path) {
+		prefix = childPath(prefix, segment)
+		at = at.child(segment)
+		if active, ok := m.branches[prefix]; ok {
+			at.branch = active.branch.plan
+		}
+	}
+	return at
 }
 
 // deepMerge recursively merges two values. For objects, it merges field-by-field.
 // For scalars, A wins if present. Respects nullHandling configuration.
-func (m *Merger) deepMerge(a, b any, path string) (any, error) {
+func (m *Merger) deepMerge(a, b any, path string, at planCursor) (any, error) {
+	return m.deepMergeKeys(a, b, path, at, MapKeysMerge)
+}
+
+// deepMergeKeys is deepMerge with a choice of how object keys combine: with
+// MapKeysReplace, keys only present in B are dropped.
+func (m *Merger) deepMergeKeys(a, b any, path string, at planCursor, mapKeys MapKeysMode) (any, error) {
 	aMap, aIsMap := a.(map[string]any)
 	bMap, bIsMap := b.(map[string]any)
 
 	// If both are objects, merge field-by-field
 	if aIsMap && bIsMap {
 		result := make(map[string]any)
-		for k, v := range bMap {
-			result[k] = v
+		if mapKeys != MapKeysReplace {
+			for k, v := range bMap {
+				result[k] = v
+			}
 		}
 
 		for k, aVal := range aMap {
-			fieldPath := path + "/" + k
+			fieldPath := childPath(path, k)
 			bVal, bHasKey := bMap[k]
 
 			if !bHasKey {
 				result[k] = aVal
 			} else {
-				merged, err := m.mergeValues(aVal, bVal, fieldPath)
+				merged, err := m.mergeValues(aVal, bVal, fieldPath, at.child(k))
 				if err != nil {
 					return nil, err
 				}
@@ -92,23 +254,117 @@ func (m *Merger) deepMerge(a, b any, path string) (any, error) {
 	}
 
 	// For non-objects (scalars, arrays, mixed types): A wins if present
-	// Respect nullHandling for null values
+	return m.requestWins(a, b, at), nil
+}
+
+// shallowMerge merges object keys down to depth levels. Below that, nested
+// objects are atomic: A's object replaces B's whole. Fields with their own
+// x-kfs-merge rules keep them.
+func (m *Merger) shallowMerge(a, b any, path string, at planCursor, depth int) (any, error) {
+	aMap, aIsMap := a.(map[string]any)
+	bMap, bIsMap := b.(map[string]any)
+
+	if !aIsMap || !bIsMap || depth < 1 {
+		return m.requestWins(a, b, at), nil
+	}
+
+	result := make(map[string]any)
+	for k, v := range bMap {
+		result[k] = v
+	}
+
+	for k, aVal := range aMap {
+		fieldPath := childPath(path, k)
+		bVal, bHasKey := bMap[k]
+
+		if !bHasKey {
+			result[k] = aVal
+			continue
+		}
+
+		remaining := depth - 1
+		inherited := FieldMergeConfig{Strategy: StrategyShallowMerge, Depth: &remaining}
+		merged, err := m.mergeValuesAs(aVal, bVal, fieldPath, at.child(k), inherited)
+		if err != nil {
+			return nil, err
+		}
+		result[k] = merged
+	}
+
+	return result, nil
+}
+
+// requestWins resolves a conflict in favor of A, respecting nullHandling for null values.
+func (m *Merger) requestWins(a, b any, at planCursor) any {
 	if a == nil {
-		nullHandling := m.schema.NullHandlingFor(path)
+		nullHandling := m.nullHandling(at)
 		if nullHandling == NullAsAbsent {
 			// Treat null as absent - B wins
-			return b, nil
+			return b
 		}
 		// NullAsValue or NullPreserve: null is a value, A (null) wins
+		return nil
+	}
+
+	return a
+}
+
+// deepMergeBaseWins recursively merges two values like deepMerge, but B wins on
+// conflict and A only fills gaps. Nested fields without an explicit strategy
+// inherit base-wins behavior; fields with their own x-kfs-merge rules keep them.
+func (m *Merger) deepMergeBaseWins(a, b any, path string, at planCursor) (any, error) {
+	aMap, aIsMap := a.(map[string]any)
+	bMap, bIsMap := b.(map[string]any)
+
+	// If both are objects, merge field-by-field
+	if aIsMap && bIsMap {
+		result := make(map[string]any)
+		for k, v := range aMap {
+			result[k] = v
+		}
+
+		for k, bVal := range bMap {
+			fieldPath := childPath(path, k)
+			aVal, aHasKey := aMap[k]
+
+			if !aHasKey {
+				result[k] = bVal
+			} else {
+				merged, err := m.mergeValuesAs(aVal, bVal, fieldPath, at.child(k), FieldMergeConfig{Strategy: StrategyDeepMergeBaseWins})
+				if err != nil {
+					return nil, err
+				}
+				result[k] = merged
+			}
+		}
+
+		return result, nil
+	}
+
+	// For non-objects (scalars, arrays, mixed types): B wins if present
+	// Respect nullHandling for null values
+	if b == nil {
+		if m.nullHandling(at) == NullAsAbsent {
+			// Treat null as absent - A fills the gap
+			return a, nil
+		}
 		return nil, nil
 	}
 
-	return a, nil
+	return b, nil
+}
+
+// nullHandling returns the null handling setting at the cursor's position.
+func (m *Merger) nullHandling(at planCursor) NullHandling {
+	if at.node == nil {
+		return m.schema.globalConfig.NullHandling
+	}
+	return at.node.nullHandling
 }
 
 // handleNulls adjusts A and B values based on null handling configuration.
-func (m *Merger) handleNulls(a, b any, path string) (any, any) {
-	nullHandling := m.schema.NullHandlingFor(path)
+func (m *Merger) handleNulls(a, b any, at planCursor) (any, any) {
+	nullHandling := m.nullHandling(at)
 
 	switch nullHandling {
 	case NullAsAbsent:
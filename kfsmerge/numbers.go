@@ -0,0 +1,388 @@
+package kfsmerge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Instances are decoded with json.Number, so numbers keep their literal form
+// until an operation computes a new one. Integers are exact up to int64;
+// other numbers are handled as float64.
+
+// toFloat64 converts a value to float64 if it's a number.
+func toFloat64(v any) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// integerOf returns the value of an integer: a Go integer, or a json.Number
+// written without fraction or exponent that fits in an int64.
+func integerOf(v any) (int64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := strconv.ParseInt(string(n), 10, 64)
+		return i, err == nil
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case int32:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// compareNumbers returns -1, 0 or 1 as number a is less than, equal to or
+// greater than number b. Integers are compared exactly.
+func compareNumbers(a, b any) int {
+	if aInt, ok := integerOf(a); ok {
+		if bInt, ok := integerOf(b); ok {
+			switch {
+			case aInt < bInt:
+				return -1
+			case aInt > bInt:
+				return 1
+			}
+			return 0
+		}
+	}
+	aNum, _ := toFloat64(a)
+	bNum, _ := toFloat64(b)
+	switch {
+	case aNum < bNum:
+		return -1
+	case aNum > bNum:
+		return 1
+	}
+	return 0
+}
+
+// numberKey returns a map key for v under which equal numbers collide, e.g.
+// json.Number("1"), json.Number("1.0") and float64(1). Other values are their
+// own key.
+func numberKey(v any) any {
+	if i, ok := integerOf(v); ok {
+		return i
+	}
+	f, ok := toFloat64(v)
+	if !ok {
+		return v
+	}
+	if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		return int64(f)
+	}
+	return f
+}
+
+// usesNumbers reports whether any of the operands was decoded as json.Number.
+func usesNumbers(operands ...any) bool {
+	for _, v := range operands {
+		if _, ok := v.(json.Number); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// integerResult returns a computed integer as json.Number when the operands
+// were decoded as json.Number, and as int64 otherwise.
+func integerResult(i int64, operands ...any) any {
+	if usesNumbers(operands...) {
+		return json.Number(strconv.FormatInt(i, 10))
+	}
+	return i
+}
+
+// floatResult returns a computed number as json.Number when the operands
+// were decoded as json.Number, and as float64 otherwise. json.Number results
+// are written without exponent.
+func floatResult(f float64, operands ...any) any {
+	if usesNumbers(operands...) {
+		return json.Number(strconv.FormatFloat(f, 'f', -1, 64))
+	}
+	return f
+}
+
+// withJSONNumbers returns a copy of a decoded JSON value with float64 numbers
+// replaced by json.Number, for values that come from the schema rather than
+// from an instance.
+func withJSONNumbers(value any) any {
+	switch v := value.(type) {
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'f', -1, 64))
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, item := range v {
+			result[k] = withJSONNumbers(item)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = withJSONNumbers(item)
+		}
+		return result
+	}
+	return value
+}
+
+// decodeSchema decodes a schema document. Numbers are float64, as the merge
+// rules read them, except in default values: those are instance data and keep
+// their literal as json.Number, so defaults beyond float64 precision stay
+// exact.
+func decodeSchema(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after top-level value")
+	}
+	schemaNumbers(raw, false)
+	return raw, nil
+}
+
+// schemaNumbers converts the json.Number values below a decoded schema node to
+// float64 in place, except within default values. names reports whether node
+// maps names to subschemas.
+func schemaNumbers(node any, names bool) any {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, value := range v {
+			switch {
+			case names:
+				v[key] = schemaNumbers(value, false)
+			case key == "default":
+			case isDataKeyword(key):
+				v[key] = floatNumbers(value)
+			default:
+				v[key] = schemaNumbers(value, isNamedSchemasKeyword(key))
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = schemaNumbers(item, false)
+		}
+	case json.Number:
+		return floatNumbers(v)
+	}
+	return node
+}
+
+// floatNumbers converts the json.Number values of a decoded JSON value to
+// float64 in place.
+func floatNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, item := range v {
+			v[key] = floatNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = floatNumbers(item)
+		}
+	}
+	return value
+}
+
+// numericBounds are the range keywords of a number schema.
+type numericBounds struct {
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum bool
+	multipleOf                         float64 // 0 when not declared
+	integer                            bool    // the schema's type is integer
+}
+
+// numericBoundsOf returns the range keywords of a schema node, including
+// those of its $ref and allOf subschemas; the tightest bound wins. It returns
+// nil when there are none and the type is not integer.
+func (s *Schema) numericBoundsOf(node map[string]any, visiting map[string]bool) *numericBounds {
+	bounds := &numericBounds{}
+	s.collectNumericBounds(bounds, node, visiting)
+	if bounds.minimum == nil && bounds.maximum == nil && bounds.multipleOf == 0 && !bounds.integer {
+		return nil
+	}
+	return bounds
+}
+
+// collectNumericBounds adds the range keywords of node to bounds.
+func (s *Schema) collectNumericBounds(bounds *numericBounds, node map[string]any, visiting map[string]bool) {
+	minimum, hasMinimum := node["minimum"].(float64)
+	maximum, hasMaximum := node["maximum"].(float64)
+	// Draft 4 marks minimum and maximum exclusive with booleans; later drafts
+	// give exclusive bounds their own values.
+	switch v := node["exclusiveMinimum"].(type) {
+	case float64:
+		bounds.setMinimum(v, true)
+	case bool:
+		if hasMinimum {
+			bounds.setMinimum(minimum, v)
+			hasMinimum = false
+		}
+	}
+	switch v := node["exclusiveMaximum"].(type) {
+	case float64:
+		bounds.setMaximum(v, true)
+	case bool:
+		if hasMaximum {
+			bounds.setMaximum(maximum, v)
+			hasMaximum = false
+		}
+	}
+	if hasMinimum {
+		bounds.setMinimum(minimum, false)
+	}
+	if hasMaximum {
+		bounds.setMaximum(maximum, false)
+	}
+	if node["type"] == "integer" {
+		bounds.integer = true
+	}
+	if multipleOf, ok := node["multipleOf"].(float64); ok && multipleOf > 0 && bounds.multipleOf == 0 {
+		bounds.multipleOf = multipleOf
+	}
+
+	if ref, ok := schemaRef(node); ok {
+		if defName, ok := s.resolveRef(ref); ok && !visiting[defName] {
+			if defNode, ok := s.defNode(defName); ok {
+				visiting[defName] = true
+				s.collectNumericBounds(bounds, defNode, visiting)
+				delete(visiting, defName)
+			}
+		}
+	}
+	if parts, ok := node["allOf"].([]any); ok {
+		for _, part := range parts {
+			if partMap, ok := part.(map[string]any); ok {
+				s.collectNumericBounds(bounds, partMap, visiting)
+			}
+		}
+	}
+}
+
+// setMinimum tightens the lower bound.
+func (b *numericBounds) setMinimum(value float64, exclusive bool) {
+	if b.minimum == nil || value > *b.minimum || value == *b.minimum && exclusive {
+		b.minimum, b.exclusiveMinimum = &value, exclusive
+	}
+}
+
+// setMaximum tightens the upper bound.
+func (b *numericBounds) setMaximum(value float64, exclusive bool) {
+	if b.maximum == nil || value < *b.maximum || value == *b.maximum && exclusive {
+		b.maximum, b.exclusiveMaximum = &value, exclusive
+	}
+}
+
+// alignNumber rounds number v to a multiple of step. Integers aligned to an
+// integer step stay exact. An aligned v is returned unchanged.
+func alignNumber(v any, step float64, mode RoundMode) any {
+	if i, ok := integerOf(v); ok && step == math.Trunc(step) && step < 1<<62 {
+		n := int64(step)
+		down := i - ((i%n)+n)%n
+		if down == i {
+			return v
+		}
+		up := down + n
+		switch mode {
+		case RoundUp:
+			return integerResult(up, v)
+		case RoundDown:
+			return integerResult(down, v)
+		}
+		if i-down < up-i {
+			return integerResult(down, v)
+		}
+		return integerResult(up, v)
+	}
+
+	f, _ := toFloat64(v)
+	var q float64
+	switch mode {
+	case RoundUp:
+		q = math.Ceil(f / step)
+	case RoundDown:
+		q = math.Floor(f / step)
+	default:
+		q = math.Floor(f/step + 0.5)
+	}
+	if aligned := q * step; aligned != f {
+		return numberLike(aligned, v)
+	}
+	return v
+}
+
+// clampNumber bounds number v by the range keywords. With a step, the bound
+// used is the multiple of step closest to it within the range. A v within
+// the range is returned unchanged.
+func clampNumber(v any, bounds *numericBounds, step float64) any {
+	f, _ := toFloat64(v)
+	if max := bounds.maximum; max != nil && (f > *max || f == *max && bounds.exclusiveMaximum) {
+		return numberLike(boundValue(*max, bounds.exclusiveMaximum, step, bounds.integer, -1), v)
+	}
+	if min := bounds.minimum; min != nil && (f < *min || f == *min && bounds.exclusiveMinimum) {
+		return numberLike(boundValue(*min, bounds.exclusiveMinimum, step, bounds.integer, 1), v)
+	}
+	return v
+}
+
+// boundValue returns the value closest to bound on the inside of the range,
+// which lies in direction dir (1 above a minimum, -1 below a maximum): a
+// multiple of step when step is set, an integer for integer schemas.
+func boundValue(bound float64, exclusive bool, step float64, integer bool, dir float64) float64 {
+	round := math.Floor
+	if dir > 0 {
+		round = math.Ceil
+	}
+	switch {
+	case step > 0:
+		value := round(bound/step) * step
+		if exclusive && value == bound {
+			value += dir * step
+		}
+		return value
+	case integer:
+		value := round(bound)
+		if exclusive && value == bound {
+			value += dir
+		}
+		return value
+	case exclusive:
+		return math.Nextafter(bound, dir*math.Inf(1))
+	}
+	return bound
+}
+
+// numberLike returns a computed number in the representation of like: an
+// integer when like is an integer and f is whole.
+func numberLike(f float64, like any) any {
+	if _, ok := integerOf(like); ok && f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		return integerResult(int64(f), like)
+	}
+	return floatResult(f, like)
+}
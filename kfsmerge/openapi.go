@@ -0,0 +1,162 @@
+package kfsmerge
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// openAPISchemasPrefix is the reference prefix of OpenAPI component schemas.
+const openAPISchemasPrefix = "#/components/schemas/"
+
+// LoadSchemaFromOpenAPI loads the component schema componentName of an
+// OpenAPI 3.x document in JSON. The component becomes the root of the schema,
+// so its x-kfs-merge is the global configuration, and the component schemas it
+// references become $defs entries. OpenAPI 3.0 nullable and boolean
+// exclusiveMinimum/exclusiveMaximum are translated to JSON Schema.
+func LoadSchemaFromOpenAPI(doc []byte, componentName string, opts ...LoadOption) (*Schema, error) {
+	// Numbers keep their literal, so defaults stay exact through the
+	// translated schema.
+	value, err := decodeJSON(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	openAPI, _ := value.(map[string]any)
+	version, _ := openAPI["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", version)
+	}
+
+	components, _ := openAPI["components"].(map[string]any)
+	schemas, _ := components["schemas"].(map[string]any)
+	root, ok := schemas[componentName].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("component schema %q not found", componentName)
+	}
+	root = deepCopy(root).(map[string]any)
+
+	// Copy the referenced component schemas, transitively, into $defs.
+	defs, _ := root["$defs"].(map[string]any)
+	if defs == nil {
+		defs = make(map[string]any)
+	}
+	copied := make(map[string]bool)
+	pending := []map[string]any{root}
+	for len(pending) > 0 {
+		node := pending[0]
+		pending = pending[1:]
+		for _, name := range openAPIRefs(node) {
+			if name == componentName || copied[name] {
+				continue
+			}
+			component, ok := schemas[name].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("component schema %q not found", name)
+			}
+			if _, exists := defs[name]; exists {
+				return nil, fmt.Errorf("component schema %q conflicts with $defs entry of %q", name, componentName)
+			}
+			copied[name] = true
+			component = deepCopy(component).(map[string]any)
+			defs[name] = component
+			pending = append(pending, component)
+		}
+	}
+	if len(defs) > 0 {
+		root["$defs"] = defs
+	}
+
+	rewriteOpenAPIRefs(root, componentName)
+	if strings.HasPrefix(version, "3.0") {
+		convertOpenAPI30(root)
+	}
+
+	data, err := json.Marshal(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal component schema %q: %w", componentName, err)
+	}
+	return LoadSchema(data, opts...)
+}
+
+// openAPIRefs returns, sorted, the component schemas referenced below node.
+func openAPIRefs(node map[string]any) []string {
+	seen := make(map[string]bool)
+	walkSchema(node, "", "", "", false, func(node map[string]any, _ string, _ location) {
+		for _, keyword := range []string{"$ref", "$dynamicRef"} {
+			ref, ok := node[keyword].(string)
+			if !ok {
+				continue
+			}
+			if rest, ok := strings.CutPrefix(ref, openAPISchemasPrefix); ok {
+				name, _, _ := strings.Cut(rest, "/")
+				seen[unescapePointer(name)] = true
+			}
+		}
+	})
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rewriteOpenAPIRefs points references to component schemas at their $defs
+// entries, and references to the component loaded as root at the root.
+func rewriteOpenAPIRefs(root map[string]any, componentName string) {
+	walkSchema(root, "", "", "", false, func(node map[string]any, _ string, _ location) {
+		for _, keyword := range []string{"$ref", "$dynamicRef"} {
+			ref, ok := node[keyword].(string)
+			if !ok {
+				continue
+			}
+			rest, ok := strings.CutPrefix(ref, openAPISchemasPrefix)
+			if !ok {
+				continue
+			}
+			name, pointer, _ := strings.Cut(rest, "/")
+			if pointer != "" {
+				pointer = "/" + pointer
+			}
+			if unescapePointer(name) == componentName {
+				node[keyword] = "#" + pointer
+			} else {
+				node[keyword] = "#/$defs/" + name + pointer
+			}
+		}
+	})
+}
+
+// convertOpenAPI30 rewrites the OpenAPI 3.0 schema keywords that differ from
+// JSON Schema: nullable becomes a "null" type, and boolean exclusiveMinimum and
+// exclusiveMaximum take the value of minimum and maximum.
+func convertOpenAPI30(root map[string]any) {
+	walkSchema(root, "", "", "", false, func(node map[string]any, _ string, _ location) {
+		if nullable, ok := node["nullable"].(bool); ok {
+			delete(node, "nullable")
+			if nullable {
+				switch t := node["type"].(type) {
+				case string:
+					node["type"] = []any{t, "null"}
+				case []any:
+					node["type"] = append(t, "null")
+				}
+				if enum, ok := node["enum"].([]any); ok {
+					node["enum"] = append(enum, nil)
+				}
+			}
+		}
+		for exclusive, bound := range map[string]string{"exclusiveMinimum": "minimum", "exclusiveMaximum": "maximum"} {
+			flag, ok := node[exclusive].(bool)
+			if !ok {
+				continue
+			}
+			delete(node, exclusive)
+			if value, ok := node[bound]; ok && flag {
+				node[exclusive] = value
+				delete(node, bound)
+			}
+		}
+	})
+}
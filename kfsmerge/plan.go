@@ -0,0 +1,367 @@
+package kfsmerge
+
+import (
+	"strings"
+)
+
+// planNode is the merge plan for one position of the instance: the rules that
+// apply there, compiled from the schema at load time, and the plan nodes of
+// the keys below it. The merger walks the plan in lockstep with the documents
+// instead of looking up rules by path. Nodes are shared between positions with
+// the same rules below them, so recursive schemas yield a finite graph. A nil
+// node is a position without rules.
+type planNode struct {
+	config       FieldMergeConfig
+	hasConfig    bool
+	nullHandling NullHandling // including the global default
+	union        *unionInfo
+	mapInfo      *mapInfo
+	fields       map[string]*planNode // by instance key
+	segments     map[string]*planNode // dynamic map keys, by segment (see mapInfo.segmentFor)
+}
+
+// child returns the plan node of a key of the object or array at n.
+func (n *planNode) child(key string) *planNode {
+	if n == nil {
+		return nil
+	}
+	if child, ok := n.fields[key]; ok {
+		return child
+	}
+	if n.mapInfo != nil {
+		key = n.mapInfo.segmentFor(key)
+	}
+	return n.segments[key]
+}
+
+// at returns the plan node of an instance path relative to n.
+func (n *planNode) at(path string) *planNode {
+	for _, segment := range splitPath(path) {
+		n = n.child(segment)
+	}
+	return n
+}
+
+// planCursor is the position of the merger in the merge plan: the schema's
+// plan node and, within a union branch, the branch's plan node, whose rules
+// take precedence. depth is the number of keys below the root, which the
+// merger checks against its maximum depth.
+type planCursor struct {
+	node   *planNode
+	branch *planNode
+	depth  int
+}
+
+// child returns the cursor of a key below the cursor's position.
+func (c planCursor) child(key string) planCursor {
+	return planCursor{node: c.node.child(key), branch: c.branch.child(key), depth: c.depth + 1}
+}
+
+// fieldConfig returns the merge configuration at the cursor's position.
+func (c planCursor) fieldConfig() (FieldMergeConfig, bool) {
+	if c.branch != nil && c.branch.hasConfig {
+		return c.branch.config, true
+	}
+	if c.node != nil && c.node.hasConfig {
+		return c.node.config, true
+	}
+	return FieldMergeConfig{}, false
+}
+
+// planPosition is a path within a definition.
+type planPosition struct {
+	def, path string
+}
+
+// planSide is where an instance path leads in the rule tables: the same path
+// in the tables as long as rules are stored below it, and the positions in
+// definitions it reaches through $refs, in lookup order.
+type planSide struct {
+	path      string
+	inTables  bool
+	positions []planPosition
+}
+
+// empty reports whether no rules apply at or below the side.
+func (side planSide) empty() bool {
+	return !side.inTables && len(side.positions) == 0
+}
+
+// key identifies the side for sharing plan nodes.
+func (side planSide) key() string {
+	var sb strings.Builder
+	if side.inTables {
+		sb.WriteString(side.path)
+	}
+	for _, pos := range side.positions {
+		sb.WriteString("\x00")
+		sb.WriteString(pos.def)
+		sb.WriteString("\x01")
+		sb.WriteString(pos.path)
+	}
+	return sb.String()
+}
+
+// planTables are the rules a plan is compiled from, by instance path: the
+// schema's, or a union branch's relative to the branch.
+type planTables struct {
+	configs  map[string]FieldMergeConfig
+	refs     map[string]string // path -> definition referenced there
+	maps     map[string]*mapInfo
+	unions   map[string]*unionInfo
+	children map[string]map[string]bool // path -> segments below it with rules
+}
+
+// addPaths records the paths of a table's keys as leading to rules.
+func (t *planTables) addPaths(path string) {
+	if path != "" && path[0] != '/' {
+		return // a definition's key in Schema.maps
+	}
+	parent := ""
+	for _, segment := range splitPath(path) {
+		if t.children[parent] == nil {
+			t.children[parent] = make(map[string]bool)
+		}
+		t.children[parent][segment] = true
+		parent = childPath(parent, segment)
+	}
+}
+
+// Instance paths are JSON pointers: keys are escaped, so a key containing "/"
+// stays one segment.
+
+// childPath returns the instance path of key below path.
+func childPath(path, key string) string {
+	return path + "/" + escapePointer(key)
+}
+
+// splitPath returns the unescaped segments of an instance path.
+func splitPath(path string) []string {
+	if path == "" {
+		return nil
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = unescapePointer(segment)
+	}
+	return segments
+}
+
+// planBuilder compiles rule tables into plan nodes.
+type planBuilder struct {
+	s           *Schema
+	tables      planTables
+	defChildren map[planPosition]map[string]bool
+	nodes       map[string]*planNode
+}
+
+// compilePlan compiles the merge plan of the schema and of its union branches.
+func (s *Schema) compilePlan() {
+	defChildren := make(map[planPosition]map[string]bool)
+	for defName, paths := range s.defPaths {
+		for path := range paths {
+			parent := ""
+			for _, segment := range splitPath(path) {
+				pos := planPosition{defName, parent}
+				if defChildren[pos] == nil {
+					defChildren[pos] = make(map[string]bool)
+				}
+				defChildren[pos][segment] = true
+				parent = childPath(parent, segment)
+			}
+		}
+	}
+
+	tables := planTables{
+		configs:  s.fieldConfigs,
+		refs:     s.refToDefName,
+		maps:     s.maps,
+		unions:   s.unions,
+		children: make(map[string]map[string]bool),
+	}
+	for path := range s.fieldConfigs {
+		tables.addPaths(path)
+	}
+	for path := range s.refToDefName {
+		tables.addPaths(path)
+	}
+	for path := range s.maps {
+		tables.addPaths(path)
+	}
+	for path := range s.unions {
+		tables.addPaths(path)
+	}
+	s.plan = newPlanBuilder(s, tables, defChildren).root()
+
+	for _, union := range s.unions {
+		for _, branch := range union.branches {
+			branchTables := planTables{
+				configs:  branch.fieldConfigs,
+				refs:     make(map[string]string),
+				children: make(map[string]map[string]bool),
+			}
+			if branch.defName != "" {
+				branchTables.refs[""] = branch.defName
+			}
+			for path := range branch.fieldConfigs {
+				branchTables.addPaths(path)
+			}
+
+			// The branch-level rule applies unless the union has its own,
+			// which the schema's plan already holds.
+			root := *newPlanBuilder(s, branchTables, defChildren).root()
+			root.config, root.hasConfig = FieldMergeConfig{}, false
+			if !union.hasOwnConfig && branch.config != nil {
+				root.config, root.hasConfig = *branch.config, true
+			}
+			branch.plan = &root
+		}
+	}
+}
+
+// newPlanBuilder returns a builder for the given tables.
+func newPlanBuilder(s *Schema, tables planTables, defChildren map[planPosition]map[string]bool) *planBuilder {
+	return &planBuilder{s: s, tables: tables, defChildren: defChildren, nodes: make(map[string]*planNode)}
+}
+
+// root returns the plan node of the instance root. It is never nil.
+func (b *planBuilder) root() *planNode {
+	side := planSide{inTables: true}
+	if defName, ok := b.tables.refs[""]; ok {
+		side.positions = b.appendPosition(nil, planPosition{def: defName}, make(map[planPosition]bool))
+	}
+	if n := b.node(side, side); n != nil {
+		return n
+	}
+	return &planNode{nullHandling: b.s.globalConfig.NullHandling}
+}
+
+// node returns the plan node of an instance path leading to raw in the rule
+// tables, and to canonical once dynamic map keys are replaced by the segments
+// their rules are stored under. Rules found for raw take precedence.
+func (b *planBuilder) node(raw, canonical planSide) *planNode {
+	if raw.empty() {
+		raw = canonical
+	}
+	if raw.empty() {
+		return nil
+	}
+	key := raw.key() + "\x02" + canonical.key()
+	if n, ok := b.nodes[key]; ok {
+		return n
+	}
+	n := &planNode{nullHandling: b.s.globalConfig.NullHandling}
+	b.nodes[key] = n
+
+	if n.config, n.hasConfig = b.config(raw); !n.hasConfig {
+		n.config, n.hasConfig = b.config(canonical)
+	}
+	for _, side := range []planSide{raw, canonical} {
+		if config, ok := b.tables.configs[side.path]; ok && side.inTables && config.NullHandling != "" {
+			n.nullHandling = config.NullHandling
+			break
+		}
+	}
+	if raw.inTables {
+		n.union = b.tables.unions[raw.path]
+	}
+	n.mapInfo = b.mapInfo(canonical)
+
+	for _, segment := range b.childSegments(raw) {
+		canonicalSegment := segment
+		if n.mapInfo != nil {
+			canonicalSegment = n.mapInfo.segmentFor(segment)
+		}
+		if child := b.node(b.childSide(raw, segment), b.childSide(canonical, canonicalSegment)); child != nil {
+			if n.fields == nil {
+				n.fields = make(map[string]*planNode)
+			}
+			n.fields[segment] = child
+		}
+	}
+	for _, segment := range b.childSegments(canonical) {
+		side := b.childSide(canonical, segment)
+		if child := b.node(side, side); child != nil {
+			if n.segments == nil {
+				n.segments = make(map[string]*planNode)
+			}
+			n.segments[segment] = child
+		}
+	}
+	return n
+}
+
+// config returns the first rule stored for a side: in the tables, then in
+// the definitions it reaches.
+func (b *planBuilder) config(side planSide) (FieldMergeConfig, bool) {
+	if config, ok := b.tables.configs[side.path]; ok && side.inTables {
+		return config, true
+	}
+	for _, pos := range side.positions {
+		if config, ok := b.s.defConfigs[defConfigKey(pos.def, pos.path)]; ok {
+			return config, true
+		}
+	}
+	return FieldMergeConfig{}, false
+}
+
+// mapInfo returns the first map description stored for a side.
+func (b *planBuilder) mapInfo(side planSide) *mapInfo {
+	if info, ok := b.tables.maps[side.path]; ok && side.inTables {
+		return info
+	}
+	for _, pos := range side.positions {
+		if info, ok := b.s.maps[pos.def+":"+pos.path]; ok {
+			return info
+		}
+	}
+	return nil
+}
+
+// childSegments returns the segments below a side that lead to rules.
+func (b *planBuilder) childSegments(side planSide) []string {
+	segments := make(map[string]bool)
+	if side.inTables {
+		for segment := range b.tables.children[side.path] {
+			segments[segment] = true
+		}
+	}
+	for _, pos := range side.positions {
+		for segment := range b.defChildren[pos] {
+			segments[segment] = true
+		}
+	}
+	return sortedKeys(segments)
+}
+
+// childSide returns the side of a segment below side. Positions keep their
+// order, each followed by the definitions it references, so rules are found
+// in the order defConfigAt finds them.
+func (b *planBuilder) childSide(side planSide, segment string) planSide {
+	var child planSide
+	seen := make(map[planPosition]bool)
+	if side.inTables && b.tables.children[side.path][segment] {
+		child.path, child.inTables = childPath(side.path, segment), true
+		if defName, ok := b.tables.refs[child.path]; ok {
+			child.positions = b.appendPosition(child.positions, planPosition{def: defName}, seen)
+		}
+	}
+	for _, pos := range side.positions {
+		child.positions = b.appendPosition(child.positions, planPosition{def: pos.def, path: childPath(pos.path, segment)}, seen)
+	}
+	return child
+}
+
+// appendPosition appends a position that leads to rules and, when it holds a
+// $ref, the referenced definition.
+func (b *planBuilder) appendPosition(positions []planPosition, pos planPosition, seen map[planPosition]bool) []planPosition {
+	if seen[pos] || !b.s.defPaths[pos.def][pos.path] {
+		return positions
+	}
+	seen[pos] = true
+	positions = append(positions, pos)
+	if target, ok := b.s.defRefs[defConfigKey(pos.def, pos.path)]; ok {
+		positions = b.appendPosition(positions, planPosition{def: target}, seen)
+	}
+	return positions
+}
@@ -0,0 +1,554 @@
+package kfsmerge
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// PredicateDoc selects the document a predicate is evaluated against.
+type PredicateDoc string
+
+const (
+	// DocRequest evaluates against instance A.
+	DocRequest PredicateDoc = "a"
+	// DocBase evaluates against instance B.
+	DocBase PredicateDoc = "b"
+	// DocMerged evaluates against the merged value at the path (default).
+	DocMerged PredicateDoc = "merged"
+)
+
+// ConditionalConfig selects an alternative field configuration when its predicate holds.
+type ConditionalConfig struct {
+	If   Predicate        `json:"if"`
+	Then FieldMergeConfig `json:"then"`
+}
+
+// Predicate is a condition over the documents being merged. Exactly one
+// operator is set.
+type Predicate struct {
+	Equals *Comparison `json:"equals,omitempty"`
+	In     *Comparison `json:"in,omitempty"`
+	Exists *Comparison `json:"exists,omitempty"`
+	And    []Predicate `json:"and,omitempty"`
+	Or     []Predicate `json:"or,omitempty"`
+	Not    *Predicate  `json:"not,omitempty"`
+}
+
+// Comparison addresses a value by path in one of the documents.
+type Comparison struct {
+	Path   string       `json:"path"`
+	Doc    PredicateDoc `json:"doc,omitempty"`
+	Value  any          `json:"value,omitempty"`  // For equals
+	Values []any        `json:"values,omitempty"` // For in
+}
+
+// DocOrDefault returns the Doc setting with default "merged".
+func (c Comparison) DocOrDefault() PredicateDoc {
+	if c.Doc != "" {
+		return c.Doc
+	}
+	return DocMerged
+}
+
+// parseWhen parses the when clause of a merge extension map.
+func parseWhen(raw any) ([]ConditionalConfig, error) {
+	clauses, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("when must be an array")
+	}
+
+	result := make([]ConditionalConfig, 0, len(clauses))
+	for i, clauseRaw := range clauses {
+		clause, ok := clauseRaw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("when[%d] must be an object", i)
+		}
+
+		predicate, err := parsePredicate(clause["if"])
+		if err != nil {
+			return nil, fmt.Errorf("when[%d].if: %w", i, err)
+		}
+
+		thenMap, ok := clause["then"].(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("when[%d].then must be an object", i)
+		}
+		then, err := parseFieldMergeConfig(thenMap)
+		if err != nil {
+			return nil, fmt.Errorf("when[%d].then: %w", i, err)
+		}
+		if len(then.When) > 0 {
+			return nil, fmt.Errorf("when[%d].then must not contain a nested when", i)
+		}
+
+		result = append(result, ConditionalConfig{If: predicate, Then: then})
+	}
+	return result, nil
+}
+
+// parsePredicate parses a predicate object with exactly one operator.
+func parsePredicate(raw any) (Predicate, error) {
+	node, ok := raw.(map[string]any)
+	if !ok {
+		return Predicate{}, fmt.Errorf("predicate must be an object")
+	}
+	if len(node) != 1 {
+		return Predicate{}, fmt.Errorf("predicate must have exactly one operator, got %d", len(node))
+	}
+
+	var p Predicate
+	for op, arg := range node {
+		switch op {
+		case "equals", "in", "exists":
+			comparison, err := parseComparison(op, arg)
+			if err != nil {
+				return Predicate{}, err
+			}
+			switch op {
+			case "equals":
+				p.Equals = comparison
+			case "in":
+				p.In = comparison
+			case "exists":
+				p.Exists = comparison
+			}
+		case "and", "or":
+			items, ok := arg.([]any)
+			if !ok || len(items) == 0 {
+				return Predicate{}, fmt.Errorf("%s must be a non-empty array", op)
+			}
+			operands := make([]Predicate, 0, len(items))
+			for i, item := range items {
+				operand, err := parsePredicate(item)
+				if err != nil {
+					return Predicate{}, fmt.Errorf("%s[%d]: %w", op, i, err)
+				}
+				operands = append(operands, operand)
+			}
+			if op == "and" {
+				p.And = operands
+			} else {
+				p.Or = operands
+			}
+		case "not":
+			operand, err := parsePredicate(arg)
+			if err != nil {
+				return Predicate{}, fmt.Errorf("not: %w", err)
+			}
+			p.Not = &operand
+		default:
+			return Predicate{}, fmt.Errorf("unknown predicate operator %q", op)
+		}
+	}
+	return p, nil
+}
+
+// parseComparison parses the argument of an equals, in or exists operator.
+func parseComparison(op string, raw any) (*Comparison, error) {
+	node, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be an object", op)
+	}
+
+	c := &Comparison{}
+	path, ok := node["path"].(string)
+	if !ok || (path != "" && !strings.HasPrefix(path, "/")) {
+		return nil, fmt.Errorf("%s.path must be a string starting with /", op)
+	}
+	c.Path = path
+
+	if docRaw, ok := node["doc"]; ok {
+		doc, ok := docRaw.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s.doc must be a string", op)
+		}
+		switch PredicateDoc(doc) {
+		case DocRequest, DocBase, DocMerged:
+			c.Doc = PredicateDoc(doc)
+		default:
+			return nil, fmt.Errorf("%s.doc must be one of a, b, merged, got %q", op, doc)
+		}
+	}
+
+	switch op {
+	case "equals":
+		value, ok := node["value"]
+		if !ok {
+			return nil, fmt.Errorf("equals requires a value")
+		}
+		c.Value = value
+	case "in":
+		values, ok := node["values"].([]any)
+		if !ok || len(values) == 0 {
+			return nil, fmt.Errorf("in.values must be a non-empty array")
+		}
+		c.Values = values
+	}
+
+	for key := range node {
+		switch key {
+		case "path", "doc":
+		case "value":
+			if op != "equals" {
+				return nil, fmt.Errorf("%s does not accept value", op)
+			}
+		case "values":
+			if op != "in" {
+				return nil, fmt.Errorf("%s does not accept values", op)
+			}
+		default:
+			return nil, fmt.Errorf("%s has unknown key %q", op, key)
+		}
+	}
+	return c, nil
+}
+
+// checkPredicates type-checks every when predicate against the schema.
+func (s *Schema) checkPredicates() error {
+	var check func(location string, config FieldMergeConfig) error
+	check = func(location string, config FieldMergeConfig) error {
+		for i, clause := range config.When {
+			if err := s.checkPredicate(clause.If); err != nil {
+				return fmt.Errorf("when[%d] at %s: %w", i, location, err)
+			}
+		}
+		for _, value := range sortedKeys(config.ByDiscriminator) {
+			if err := check(fmt.Sprintf("%s byDiscriminator %q", location, value), config.ByDiscriminator[value]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for path, config := range s.fieldConfigs {
+		if err := check(path, config); err != nil {
+			return err
+		}
+	}
+	for key, config := range s.defConfigs {
+		if err := check("$defs/"+key, config); err != nil {
+			return err
+		}
+	}
+	for path, union := range s.unions {
+		for _, branch := range union.branches {
+			if branch.config != nil {
+				if err := check(path, *branch.config); err != nil {
+					return err
+				}
+			}
+			for relPath, config := range branch.fieldConfigs {
+				if err := check(path+relPath, config); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkPredicate verifies that predicate paths exist in the schema and that
+// compared values match the schema's types, consts and enums.
+func (s *Schema) checkPredicate(p Predicate) error {
+	for _, c := range []*Comparison{p.Equals, p.In, p.Exists} {
+		if c == nil {
+			continue
+		}
+		nodes := s.schemaNodesAt(c.Path)
+		if len(nodes) == 0 {
+			return fmt.Errorf("path %q does not exist in the schema", c.Path)
+		}
+		values := c.Values
+		if p.Equals != nil {
+			values = []any{c.Value}
+		}
+		for _, value := range values {
+			if !valueAllowedByAny(value, nodes) {
+				return fmt.Errorf("value %v is not allowed by the schema at %q", value, c.Path)
+			}
+		}
+	}
+
+	for _, operand := range append(append([]Predicate{}, p.And...), p.Or...) {
+		if err := s.checkPredicate(operand); err != nil {
+			return err
+		}
+	}
+	if p.Not != nil {
+		return s.checkPredicate(*p.Not)
+	}
+	return nil
+}
+
+// schemaNodesAt returns the schema nodes that may describe the instance at path,
+// following properties, map subschemas, items, local $refs and oneOf/anyOf/allOf
+// branches.
+// Numeric path segments also match array items.
+func (s *Schema) schemaNodesAt(path string) []map[string]any {
+	nodes := s.expandSchemaNode(s.raw, make(map[string]bool))
+	if path == "" {
+		return nodes
+	}
+
+	for _, segment := range splitPath(path) {
+		var next []map[string]any
+		for _, node := range nodes {
+			if props, ok := node["properties"].(map[string]any); ok {
+				if propMap, ok := props[segment].(map[string]any); ok {
+					next = append(next, s.expandSchemaNode(propMap, make(map[string]bool))...)
+					continue
+				}
+			}
+			if info, err := parseMapInfo(node); err == nil && info != nil {
+				mapSubschemas(node, func(sub string, subMap map[string]any) error {
+					if sub == info.segmentFor(segment) {
+						next = append(next, s.expandSchemaNode(subMap, make(map[string]bool))...)
+					}
+					return nil
+				})
+			}
+			if items, ok := node["items"].(map[string]any); ok && (segment == "items" || isIndex(segment)) {
+				next = append(next, s.expandSchemaNode(items, make(map[string]bool))...)
+			}
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// expandSchemaNode returns node together with the nodes it references or composes.
+func (s *Schema) expandSchemaNode(node map[string]any, visiting map[string]bool) []map[string]any {
+	nodes := []map[string]any{node}
+
+	if ref, ok := schemaRef(node); ok {
+		if defName, isLocal := s.resolveRef(ref); isLocal && !visiting[defName] {
+			if defNode, ok := s.defNode(defName); ok {
+				visiting[defName] = true
+				nodes = append(nodes, s.expandSchemaNode(defNode, visiting)...)
+			}
+		}
+	}
+
+	for _, keyword := range []string{"oneOf", "anyOf", "allOf"} {
+		if alts, ok := node[keyword].([]any); ok {
+			for _, alt := range alts {
+				if altMap, ok := alt.(map[string]any); ok {
+					nodes = append(nodes, s.expandSchemaNode(altMap, visiting)...)
+				}
+			}
+		}
+	}
+	return nodes
+}
+
+// valueAllowedByAny reports whether any of the schema nodes admits value
+// according to its type, const and enum keywords.
+func valueAllowedByAny(value any, nodes []map[string]any) bool {
+	constrained := false
+	for _, node := range nodes {
+		_, hasType := node["type"]
+		_, hasConst := node["const"]
+		_, hasEnum := node["enum"]
+		if !hasType && !hasConst && !hasEnum {
+			continue
+		}
+		constrained = true
+		if valueAllowed(value, node) {
+			return true
+		}
+	}
+	return !constrained
+}
+
+// valueAllowed checks value against a single node's type, const and enum keywords.
+func valueAllowed(value any, node map[string]any) bool {
+	if constValue, ok := node["const"]; ok && !reflect.DeepEqual(constValue, value) {
+		return false
+	}
+	if enum, ok := node["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch t := node["type"].(type) {
+	case string:
+		return jsonTypeMatches(value, t)
+	case []any:
+		for _, item := range t {
+			if name, ok := item.(string); ok && jsonTypeMatches(value, name) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// jsonTypeMatches reports whether value is an instance of the named JSON Schema type.
+func jsonTypeMatches(value any, typeName string) bool {
+	switch typeName {
+	case "null":
+		return value == nil
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := toFloat64(value)
+		return ok
+	case "integer":
+		n, ok := toFloat64(value)
+		return ok && n == math.Trunc(n)
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	}
+	return false
+}
+
+// isIndex reports whether a path segment is an array index.
+func isIndex(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	for _, r := range segment {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// evalPredicate evaluates a predicate against the documents being merged.
+func (m *Merger) evalPredicate(p Predicate) (bool, error) {
+	switch {
+	case p.Equals != nil:
+		value, ok, err := m.predicateValue(*p.Equals)
+		if err != nil || !ok {
+			return false, err
+		}
+		return valuesEqual(value, p.Equals.Value), nil
+	case p.In != nil:
+		value, ok, err := m.predicateValue(*p.In)
+		if err != nil || !ok {
+			return false, err
+		}
+		for _, candidate := range p.In.Values {
+			if valuesEqual(value, candidate) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case p.Exists != nil:
+		_, ok, err := m.predicateValue(*p.Exists)
+		return ok, err
+	case len(p.And) > 0:
+		for _, operand := range p.And {
+			ok, err := m.evalPredicate(operand)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case len(p.Or) > 0:
+		for _, operand := range p.Or {
+			ok, err := m.evalPredicate(operand)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case p.Not != nil:
+		ok, err := m.evalPredicate(*p.Not)
+		return !ok, err
+	}
+	return false, nil
+}
+
+// predicateValue resolves the value a comparison refers to. For the merged
+// document the subtree at the path is merged on demand.
+func (m *Merger) predicateValue(c Comparison) (any, bool, error) {
+	aVal, aHas := lookupPath(m.rootA, c.Path)
+	bVal, bHas := lookupPath(m.rootB, c.Path)
+
+	switch c.DocOrDefault() {
+	case DocRequest:
+		return aVal, aHas, nil
+	case DocBase:
+		return bVal, bHas, nil
+	}
+
+	switch {
+	case !aHas && !bHas:
+		return nil, false, nil
+	case !bHas:
+		return aVal, true, nil
+	case !aHas:
+		return bVal, true, nil
+	}
+
+	if m.evaluating[c.Path] {
+		return nil, false, fmt.Errorf("when predicate on %s depends on its own merged value", c.Path)
+	}
+	m.evaluating[c.Path] = true
+	defer delete(m.evaluating, c.Path)
+
+	merged, err := m.mergeValues(aVal, bVal, c.Path, m.cursorAt(c.Path))
+	if err != nil {
+		return nil, false, err
+	}
+	return merged, true, nil
+}
+
+// valuesEqual compares two decoded JSON values, treating numbers by value,
+// also within objects and arrays.
+func valuesEqual(a, b any) bool {
+	_, aOk := toFloat64(a)
+	_, bOk := toFloat64(b)
+	if aOk && bOk {
+		return compareNumbers(a, b) == 0
+	}
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			if w, ok := bv[k]; !ok || !valuesEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !valuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
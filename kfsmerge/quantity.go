@@ -0,0 +1,222 @@
+package kfsmerge
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UnitSystem maps the unit suffixes of one kind of quantity to their size in
+// the system's base unit, e.g. "k": 1000 for bitrates in bits per second. The
+// empty suffix is the base unit, which plain JSON numbers are read in.
+type UnitSystem map[string]float64
+
+// builtinUnitSystems are the unit systems of every schema.
+var builtinUnitSystems = map[string]UnitSystem{
+	"bitrate": {
+		"": 1, "bps": 1,
+		"k": 1e3, "K": 1e3, "kbps": 1e3, "Kbps": 1e3,
+		"M": 1e6, "Mbps": 1e6,
+		"G": 1e9, "Gbps": 1e9,
+	},
+	"bytes": {
+		"": 1, "B": 1,
+		"k": 1e3, "K": 1e3, "kB": 1e3, "KB": 1e3,
+		"M": 1e6, "MB": 1e6,
+		"G": 1e9, "GB": 1e9,
+		"T": 1e12, "TB": 1e12,
+		"Ki": 1 << 10, "KiB": 1 << 10,
+		"Mi": 1 << 20, "MiB": 1 << 20,
+		"Gi": 1 << 30, "GiB": 1 << 30,
+		"Ti": 1 << 40, "TiB": 1 << 40,
+	},
+	"time": {
+		"": 1, "s": 1,
+		"ns": 1e-9, "us": 1e-6, "µs": 1e-6, "ms": 1e-3,
+		"m": 60, "min": 60,
+		"h": 3600,
+		"d": 86400,
+	},
+}
+
+// WithUnitSystem registers a unit system for the quantity strategy under
+// name, in addition to the built-in "bitrate", "bytes" and "time" systems. A
+// system registered under a built-in name replaces it.
+func WithUnitSystem(name string, units UnitSystem) LoadOption {
+	return func(c *loadConfig) {
+		if c.unitSystems == nil {
+			c.unitSystems = make(map[string]UnitSystem)
+		}
+		c.unitSystems[name] = units
+	}
+}
+
+// unitSystemsWith returns the built-in unit systems with those registered by
+// load options.
+func unitSystemsWith(registered map[string]UnitSystem) map[string]UnitSystem {
+	systems := make(map[string]UnitSystem, len(builtinUnitSystems)+len(registered))
+	for name, units := range builtinUnitSystems {
+		systems[name] = units
+	}
+	for name, units := range registered {
+		systems[name] = units
+	}
+	return systems
+}
+
+// checkQuantityUnits reports a quantity configuration naming a unit system
+// or canonical unit the schema does not know.
+func (s *Schema) checkQuantityUnits(config FieldMergeConfig) error {
+	if config.Strategy != StrategyQuantity {
+		return nil
+	}
+	units, ok := s.unitSystems[config.Unit]
+	if !ok {
+		names := make([]string, 0, len(s.unitSystems))
+		for name := range s.unitSystems {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown unit system %q, want one of %s", config.Unit, strings.Join(names, ", "))
+	}
+	if _, ok := units[config.CanonicalUnit]; config.CanonicalUnit != "" && !ok {
+		return fmt.Errorf("unknown %s unit %q", config.Unit, config.CanonicalUnit)
+	}
+	return nil
+}
+
+// quantity is a value read in a unit system: its size in the base unit, the
+// unit it was written in and the value as written. Whole sizes are kept as
+// integers, so that they add exactly.
+type quantity struct {
+	base any
+	unit string
+	raw  any
+}
+
+// parseQuantity reads a quantity such as "4.5Mbps", "800k", "30 s" or a
+// plain JSON number in the base unit.
+func parseQuantity(value any, units UnitSystem, system string) (quantity, error) {
+	if _, ok := toFloat64(value); ok {
+		return quantity{base: value, raw: value}, nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return quantity{}, fmt.Errorf("quantity strategy requires strings or numbers, got %s", jsonType(value))
+	}
+	end := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if end < 0 {
+		end = len(s)
+	}
+	n, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil {
+		return quantity{}, fmt.Errorf("%q is not a %s quantity", s, system)
+	}
+	unit := strings.TrimSpace(s[end:])
+	factor, ok := units[unit]
+	if !ok {
+		return quantity{}, fmt.Errorf("unknown %s unit %q in %q", system, unit, s)
+	}
+	base := json.Number(strconv.FormatFloat(n*factor, 'f', -1, 64))
+	if i, err := strconv.ParseInt(s[:end], 10, 64); err == nil {
+		if f, ok := wholeFactor(factor); ok && (i == 0 || i*f/f == i) {
+			base = json.Number(strconv.FormatInt(i*f, 10))
+		}
+	}
+	return quantity{base: base, unit: unit, raw: value}, nil
+}
+
+// wholeFactor returns a unit's size as an integer when it is a whole number.
+func wholeFactor(factor float64) (int64, bool) {
+	if factor < 1 || factor != math.Trunc(factor) || factor >= 1<<62 {
+		return 0, false
+	}
+	return int64(factor), true
+}
+
+// formatQuantity writes a size in the base unit in unit. A size in the base
+// unit stays a JSON number when like is one. Sizes that are whole multiples
+// of the unit are written exactly.
+func formatQuantity(base any, unit string, units UnitSystem, like any) any {
+	var value any = base
+	if factor := units[unit]; factor != 1 {
+		value = nil
+		if i, ok := integerOf(base); ok {
+			if f, ok := wholeFactor(factor); ok && i%f == 0 {
+				value = integerResult(i/f, base)
+			}
+		}
+		if value == nil {
+			// Round away float noise from unit conversions, e.g. 0.1M + 0.2M.
+			f, _ := toFloat64(base)
+			rounded, _ := strconv.ParseFloat(strconv.FormatFloat(f/factor, 'g', 12, 64), 64)
+			value = floatResult(rounded, base)
+		}
+	}
+	if _, isString := like.(string); unit == "" && !isString {
+		return value
+	}
+	if i, ok := integerOf(value); ok {
+		return strconv.FormatInt(i, 10) + unit
+	}
+	if n, ok := value.(json.Number); ok {
+		return string(n) + unit
+	}
+	f, _ := toFloat64(value)
+	return strconv.FormatFloat(f, 'f', -1, 64) + unit
+}
+
+// quantityOperation resolves two quantities of the configured unit system:
+// the larger (max, default), the smaller (min) or their sum. Without a
+// canonical unit, a picked value is returned as written and a sum is written
+// in A's unit.
+func (m *Merger) quantityOperation(a, b any, path string, config FieldMergeConfig) (any, error) {
+	if a == nil {
+		return b, nil
+	}
+	if b == nil {
+		return a, nil
+	}
+	units := m.schema.unitSystems[config.Unit]
+	aQty, err := parseQuantity(a, units, config.Unit)
+	if err != nil {
+		return nil, fmt.Errorf("quantity at %s: %w", path, err)
+	}
+	bQty, err := parseQuantity(b, units, config.Unit)
+	if err != nil {
+		return nil, fmt.Errorf("quantity at %s: %w", path, err)
+	}
+
+	var picked quantity
+	switch operation := config.OperationOrDefault(); operation {
+	case "max":
+		picked = aQty
+		if compareNumbers(bQty.base, aQty.base) > 0 {
+			picked = bQty
+		}
+	case "min":
+		picked = aQty
+		if compareNumbers(bQty.base, aQty.base) < 0 {
+			picked = bQty
+		}
+	case "sum":
+		sum, err := combineNumbers(aQty.base, bQty.base, "sum")
+		if err != nil {
+			return nil, fmt.Errorf("quantity at %s: %w", path, err)
+		}
+		if config.CanonicalUnit != "" {
+			return formatQuantity(sum, config.CanonicalUnit, units, ""), nil
+		}
+		return formatQuantity(sum, aQty.unit, units, a), nil
+	default:
+		return nil, fmt.Errorf("quantity at %s: unknown operation %q", path, operation)
+	}
+
+	if config.CanonicalUnit == "" {
+		return picked.raw, nil
+	}
+	return formatQuantity(picked.base, config.CanonicalUnit, units, ""), nil
+}
@@ -0,0 +1,466 @@
+package kfsmerge
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// rootDefName is the definition name under which references to the root of
+// the schema document ("#", or an anchor declared on the root) are resolved.
+//
+// Other definition names are the entry name for definitions of the schema
+// document (in $defs, or draft-07 definitions), "#/pointer" for other locations in the schema document,
+// and "uri#/pointer" for locations in other documents.
+const rootDefName = "#"
+
+// defaultBaseURI is the URI of a schema document loaded without WithBaseURI.
+const defaultBaseURI = "schema.json"
+
+// defsKeywords lists the keywords holding named definitions, in lookup order:
+// an entry of $defs shadows a definitions entry of the same name.
+var defsKeywords = []string{"$defs", "definitions"}
+
+// location identifies a subschema by the URI of its document and a JSON pointer.
+type location struct {
+	doc     string
+	pointer string
+}
+
+// schemaRef returns the reference of a schema node: its $ref, or else its
+// $dynamicRef. A $dynamicRef resolves to the $dynamicAnchor of the same name
+// in the referenced resource, so both are followed the same way.
+func schemaRef(node map[string]any) (string, bool) {
+	if ref, ok := node["$ref"].(string); ok {
+		return ref, true
+	}
+	ref, ok := node["$dynamicRef"].(string)
+	return ref, ok
+}
+
+// resolveRef resolves a reference, as rewritten by resolveResources, to a
+// definition name.
+func (s *Schema) resolveRef(ref string) (string, bool) {
+	for _, keyword := range defsKeywords {
+		token, ok := strings.CutPrefix(ref, "#/"+keyword+"/")
+		if !ok || token == "" || strings.Contains(token, "/") {
+			continue
+		}
+		if name := unescapePointer(token); s.defsKeyword(name) == keyword {
+			return name, true
+		}
+	}
+	if ref == rootDefName || strings.HasPrefix(ref, "#/") {
+		return ref, true
+	}
+	if i := strings.Index(ref, "#"); i > 0 && (i+1 == len(ref) || ref[i+1] == '/') {
+		if _, ok := s.docs[ref[:i]]; ok {
+			return ref, true
+		}
+	}
+	return "", false
+}
+
+// defNode returns the raw schema of a definition.
+func (s *Schema) defNode(defName string) (map[string]any, bool) {
+	if defName == rootDefName {
+		return s.raw, true
+	}
+	i := strings.Index(defName, "#")
+	if i < 0 {
+		defs, ok := s.raw[s.defsKeyword(defName)].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		defNode, ok := defs[defName].(map[string]any)
+		return defNode, ok
+	}
+
+	doc := s.raw
+	if i > 0 {
+		doc = s.docs[defName[:i]]
+	}
+	return pointerNode(doc, defName[i+1:])
+}
+
+// defLocation returns the absolute location of a definition, as understood by the compiler.
+func (s *Schema) defLocation(defName string) string {
+	switch {
+	case defName == rootDefName:
+		return s.baseURI + "#"
+	case strings.HasPrefix(defName, "#"):
+		return s.baseURI + defName
+	case strings.Contains(defName, "#"):
+		return defName
+	default:
+		return s.baseURI + "#/" + s.defsKeyword(defName) + "/" + escapePointer(defName)
+	}
+}
+
+// defsKeyword returns the keyword of the schema document holding the named
+// definition; "$defs" if there is none.
+func (s *Schema) defsKeyword(name string) string {
+	for _, keyword := range defsKeywords {
+		if defs, ok := s.raw[keyword].(map[string]any); ok {
+			if _, ok := defs[name]; ok {
+				return keyword
+			}
+		}
+	}
+	return "$defs"
+}
+
+// defDisplayName returns a definition name for use in error messages.
+func (s *Schema) defDisplayName(defName string) string {
+	if strings.Contains(defName, "#") {
+		return defName
+	}
+	return s.defsKeyword(defName) + "/" + defName
+}
+
+// isLocalDef reports whether a definition is an entry of the schema document's
+// $defs (or definitions) or its root, whose rules are collected eagerly at load.
+func isLocalDef(defName string) bool {
+	return defName == rootDefName || !strings.Contains(defName, "#")
+}
+
+// parseRefTarget collects the merge rules of a referenced definition that is
+// not a $defs entry of the schema document, the first time it is referenced.
+func (s *Schema) parseRefTarget(defName string) error {
+	if isLocalDef(defName) || s.parsedTargets[defName] {
+		return nil
+	}
+	s.parsedTargets[defName] = true
+
+	node, ok := s.defNode(defName)
+	if !ok {
+		return nil
+	}
+	return s.parseDefFieldConfigs(defName, "", node)
+}
+
+// refsRoot reports whether any collected reference targets the schema root.
+func (s *Schema) refsRoot() bool {
+	for _, defName := range s.refToDefName {
+		if defName == rootDefName {
+			return true
+		}
+	}
+	for _, defName := range s.defRefs {
+		if defName == rootDefName {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRootDefConfigs registers the rules of the root schema as the definition
+// rootDefName, so that recursive references to the root resolve them like any
+// other definition. The root's own x-kfs-merge is the global configuration and
+// is not part of it.
+func (s *Schema) parseRootDefConfigs() error {
+	if !s.refsRoot() {
+		return nil
+	}
+	body := make(map[string]any, len(s.raw))
+	for key, value := range s.raw {
+		if key != MergeExtensionKey && key != "$defs" && key != "definitions" {
+			body[key] = value
+		}
+	}
+	return s.parseDefFieldConfigs(rootDefName, "", body)
+}
+
+// resourceIndex locates the documents, $ids and anchors of a schema.
+type resourceIndex struct {
+	docs    map[string]map[string]any // document URI -> raw document
+	sources map[string][]byte         // document URI -> JSON source
+	ids     map[string]location       // absolute $id -> location
+	anchors map[string]location       // resource URI + "#" + anchor -> location
+}
+
+// resolveResources loads every document reachable through $ref or $dynamicRef
+// from the schema and the registered resources, and rewrites each reference in
+// place to its canonical form: "#/pointer" within the schema document,
+// "uri#/pointer" elsewhere. Relative references are resolved against the
+// enclosing $id, or the URI of their document. It returns the JSON source of
+// every document by URI.
+func (s *Schema) resolveResources(source []byte, cfg loadConfig) (map[string][]byte, error) {
+	idx := &resourceIndex{
+		docs:    make(map[string]map[string]any),
+		sources: make(map[string][]byte),
+		ids:     make(map[string]location),
+		anchors: make(map[string]location),
+	}
+	idx.add(s.baseURI, s.raw, source)
+	for uri, data := range cfg.resources {
+		raw, err := decodeSchema(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse schema resource %q: %w", uri, err)
+		}
+		idx.add(uri, raw, data)
+	}
+
+	// Load referenced documents until every reference points into a known one.
+	for scanned := make(map[string]bool); ; {
+		var missing []string
+		for uri, doc := range idx.docs {
+			if scanned[uri] {
+				continue
+			}
+			scanned[uri] = true
+			walkSchema(doc, uri, uri, "", false, func(node map[string]any, base string, _ location) {
+				ref, ok := schemaRef(node)
+				if !ok {
+					return
+				}
+				target, _, err := resolveURI(base, ref)
+				if err != nil || idx.known(target) || isMetaSchema(target) {
+					return
+				}
+				missing = append(missing, target)
+			})
+		}
+		if len(missing) == 0 {
+			break
+		}
+		for _, uri := range missing {
+			if idx.known(uri) {
+				continue
+			}
+			data, err := cfg.loader.Load(cfg.ctx, uri)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load referenced schema %q: %w", uri, err)
+			}
+			raw, err := decodeSchema(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse referenced schema %q: %w", uri, err)
+			}
+			idx.add(uri, raw, data)
+		}
+	}
+
+	for uri, doc := range idx.docs {
+		var walkErr error
+		walkSchema(doc, uri, uri, "", false, func(node map[string]any, base string, at location) {
+			for _, keyword := range []string{"$ref", "$dynamicRef"} {
+				ref, ok := node[keyword].(string)
+				if !ok || walkErr != nil {
+					continue
+				}
+				target, fragment, err := resolveURI(base, ref)
+				if err != nil {
+					walkErr = fmt.Errorf("invalid %s %q at %s#%s: %w", keyword, ref, at.doc, at.pointer, err)
+					continue
+				}
+				if isMetaSchema(target) {
+					continue
+				}
+				loc, ok := idx.locate(target, fragment)
+				if !ok {
+					if keyword == "$ref" {
+						walkErr = fmt.Errorf("unresolved $ref %q at %s#%s", ref, at.doc, at.pointer)
+					}
+					continue
+				}
+				node[keyword] = s.canonicalRef(loc)
+			}
+		})
+		if walkErr != nil {
+			return nil, walkErr
+		}
+	}
+
+	s.docs = idx.docs
+	return idx.sources, nil
+}
+
+// canonicalRef returns the reference form of a location understood by resolveRef.
+func (s *Schema) canonicalRef(loc location) string {
+	if loc.doc == s.baseURI {
+		return "#" + loc.pointer
+	}
+	return loc.doc + "#" + loc.pointer
+}
+
+// add registers a document and indexes its $ids and anchors.
+func (idx *resourceIndex) add(uri string, doc map[string]any, source []byte) {
+	idx.docs[uri] = doc
+	idx.sources[uri] = source
+	walkSchema(doc, uri, uri, "", false, func(node map[string]any, base string, at location) {
+		anchors := []string{"$anchor", "$dynamicAnchor"}
+		if id, ok := node["$id"].(string); ok {
+			if strings.HasPrefix(id, "#") {
+				// A draft-07 "$id": "#name" declares an anchor, not a resource.
+				anchors = append(anchors, "$id")
+			} else if _, exists := idx.ids[base]; !exists {
+				idx.ids[base] = at
+			}
+		}
+		for _, keyword := range anchors {
+			if anchor, ok := node[keyword].(string); ok {
+				anchor = strings.TrimPrefix(anchor, "#")
+				if _, exists := idx.anchors[base+"#"+anchor]; !exists {
+					idx.anchors[base+"#"+anchor] = at
+				}
+			}
+		}
+	})
+}
+
+// known reports whether a URI (without fragment) identifies a loaded resource.
+func (idx *resourceIndex) known(uri string) bool {
+	if _, ok := idx.docs[uri]; ok {
+		return true
+	}
+	_, ok := idx.ids[uri]
+	return ok
+}
+
+// locate returns the location a resource URI and fragment refer to. The
+// fragment is either a JSON pointer relative to the resource or an anchor.
+func (idx *resourceIndex) locate(uri, fragment string) (location, bool) {
+	resource, ok := idx.ids[uri]
+	if !ok {
+		if _, isDoc := idx.docs[uri]; !isDoc {
+			return location{}, false
+		}
+		resource = location{doc: uri}
+	}
+
+	if fragment == "" || strings.HasPrefix(fragment, "/") {
+		return location{doc: resource.doc, pointer: resource.pointer + fragment}, true
+	}
+	loc, ok := idx.anchors[uri+"#"+fragment]
+	return loc, ok
+}
+
+// walkSchema calls fn for every schema object below node with the base URI in
+// effect there (following $id) and its location. Keywords holding instance
+// data rather than subschemas are not descended into; names is set while
+// walking a map of names to subschemas, such as properties.
+func walkSchema(node any, base, doc, pointer string, names bool, fn func(node map[string]any, base string, at location)) {
+	switch node := node.(type) {
+	case map[string]any:
+		if !names {
+			if id, ok := node["$id"].(string); ok {
+				if resolved, _, err := resolveURI(base, id); err == nil {
+					base = resolved
+				}
+			}
+			fn(node, base, location{doc: doc, pointer: pointer})
+		}
+		for key, value := range node {
+			if !names && isDataKeyword(key) {
+				continue
+			}
+			walkSchema(value, base, doc, pointer+"/"+escapePointer(key), !names && isNamedSchemasKeyword(key), fn)
+		}
+	case []any:
+		for i, item := range node {
+			walkSchema(item, base, doc, pointer+"/"+strconv.Itoa(i), false, fn)
+		}
+	}
+}
+
+// isDataKeyword reports whether a keyword's value is instance data or an
+// annotation rather than a subschema.
+func isDataKeyword(key string) bool {
+	switch key {
+	case "const", "enum", "default", "examples", "required", MergeExtensionKey:
+		return true
+	}
+	return false
+}
+
+// isNamedSchemasKeyword reports whether a keyword maps names to subschemas.
+func isNamedSchemasKeyword(key string) bool {
+	switch key {
+	case "properties", "patternProperties", "$defs", "definitions", "dependentSchemas":
+		return true
+	}
+	return false
+}
+
+// isMetaSchema reports whether a URI refers to a JSON Schema meta-schema,
+// which the compiler provides itself.
+func isMetaSchema(uri string) bool {
+	return strings.HasPrefix(uri, "https://json-schema.org/") || strings.HasPrefix(uri, "http://json-schema.org/")
+}
+
+// resolveURI resolves ref against base and splits off its fragment.
+func resolveURI(base, ref string) (uri, fragment string, err error) {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return "", "", err
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", "", err
+	}
+	var resolved *url.URL
+	if !baseURL.IsAbs() && !refURL.IsAbs() && refURL.Host == "" {
+		// A relative base such as the default "schema.json" stays relative.
+		resolved = &url.URL{Path: baseURL.Path, Fragment: refURL.Fragment}
+		if refURL.Path != "" {
+			resolved.Path = refURL.Path
+			if !path.IsAbs(refURL.Path) {
+				resolved.Path = path.Join(path.Dir(baseURL.Path), refURL.Path)
+			}
+		}
+	} else {
+		resolved = baseURL.ResolveReference(refURL)
+	}
+	fragment = resolved.Fragment
+	resolved.Fragment, resolved.RawFragment = "", ""
+	return resolved.String(), fragment, nil
+}
+
+// fileURI returns the file:// URI of a local path.
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// pointerNode returns the schema object a JSON pointer refers to within doc.
+func pointerNode(doc map[string]any, pointer string) (map[string]any, bool) {
+	var node any = doc
+	if pointer != "" {
+		for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+			token = unescapePointer(token)
+			switch current := node.(type) {
+			case map[string]any:
+				node = current[token]
+			case []any:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(current) {
+					return nil, false
+				}
+				node = current[i]
+			default:
+				return nil, false
+			}
+		}
+	}
+	nodeMap, ok := node.(map[string]any)
+	return nodeMap, ok
+}
+
+// unescapePointer reverses escapePointer.
+func unescapePointer(token string) string {
+	token = strings.ReplaceAll(token, "~1", "/")
+	return strings.ReplaceAll(token, "~0", "~")
+}
+
+// idLoader serves referenced documents to the compiler by their root $id,
+// for references that name a document by $id rather than by its URI.
+type idLoader map[string]any
+
+// Load implements jsonschema.URLLoader.
+func (l idLoader) Load(url string) (any, error) {
+	if doc, ok := l[url]; ok {
+		return doc, nil
+	}
+	return nil, fmt.Errorf("schema %q is not loaded", url)
+}
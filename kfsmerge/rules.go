@@ -0,0 +1,98 @@
+package kfsmerge
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// WithRules applies merge rules kept in a separate document instead of inline
+// x-kfs-merge annotations, for schemas that are generated. The document is a
+// JSON object mapping targets to x-kfs-merge objects:
+//
+//	{
+//	  "#": {"arrayStrategy": "concat"},
+//	  "#/properties/tags": {"strategy": "concat", "unique": true},
+//	  "Output": {"strategy": "deepMerge"}
+//	}
+//
+// A target is "#" for the global configuration, a JSON pointer to a subschema
+// of the schema document ("#/..." or "/..."), or the name of a $defs (or
+// definitions) entry. Keys of a rule take precedence over the same keys of an
+// inline annotation. A target that does not exist in the schema is a load error.
+func WithRules(rulesJSON []byte) LoadOption {
+	return func(c *loadConfig) {
+		c.rules = rulesJSON
+	}
+}
+
+// applyRules adds the rules of a rules document to the x-kfs-merge annotations
+// of the schema document.
+func (s *Schema) applyRules(rulesJSON []byte) error {
+	var rules map[string]any
+	if err := json.Unmarshal(rulesJSON, &rules); err != nil {
+		return fmt.Errorf("failed to parse rules JSON: %w", err)
+	}
+
+	nodes := make(map[string]map[string]any)
+	walkSchema(s.raw, s.baseURI, s.baseURI, "", false, func(node map[string]any, _ string, at location) {
+		nodes[at.pointer] = node
+	})
+
+	targets := make([]string, 0, len(rules))
+	for target := range rules {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	for _, target := range targets {
+		rule, ok := rules[target].(map[string]any)
+		if !ok {
+			return fmt.Errorf("rule for %q must be an object", target)
+		}
+		pointer, err := s.rulePointer(target)
+		if err != nil {
+			return err
+		}
+		node, ok := nodes[pointer]
+		if !ok {
+			return fmt.Errorf("rule target %q is not a subschema of the schema", target)
+		}
+		if pointer != "" {
+			if _, err := parseFieldMergeConfig(rule); err != nil {
+				return fmt.Errorf("rule for %q: %w", target, err)
+			}
+		}
+
+		merged := make(map[string]any)
+		if inline, ok := node[MergeExtensionKey].(map[string]any); ok {
+			for key, value := range inline {
+				merged[key] = value
+			}
+		}
+		for key, value := range rule {
+			merged[key] = value
+		}
+		node[MergeExtensionKey] = merged
+	}
+	return nil
+}
+
+// rulePointer returns the JSON pointer within the schema document of a rules
+// target.
+func (s *Schema) rulePointer(target string) (string, error) {
+	switch {
+	case target == "#" || target == "":
+		return "", nil
+	case strings.HasPrefix(target, "#/"):
+		return target[1:], nil
+	case strings.HasPrefix(target, "/"):
+		return target, nil
+	}
+	keyword := s.defsKeyword(target)
+	if defs, ok := s.raw[keyword].(map[string]any); !ok || defs[target] == nil {
+		return "", fmt.Errorf("rule target %q is not a $defs entry of the schema", target)
+	}
+	return "/" + keyword + "/" + escapePointer(target), nil
+}
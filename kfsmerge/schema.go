@@ -2,9 +2,12 @@ package kfsmerge
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/santhosh-tekuri/jsonschema/v6"
 )
@@ -14,53 +17,217 @@ const MergeExtensionKey = "x-kfs-merge"
 
 // Schema represents a parsed JSON Schema with merge extensions.
 type Schema struct {
-	compiled     *jsonschema.Schema
-	raw          map[string]any
-	globalConfig GlobalMergeConfig
-	fieldConfigs map[string]FieldMergeConfig
-	defConfigs   map[string]FieldMergeConfig
-	refToDefName map[string]string
-	defaults     map[string]any // cached extracted defaults from schema
+	compiled      *jsonschema.Schema
+	raw           map[string]any
+	globalConfig  GlobalMergeConfig
+	fieldConfigs  map[string]FieldMergeConfig
+	defConfigs    map[string]FieldMergeConfig
+	refToDefName  map[string]string
+	defRefs       map[string]string          // defName or defName:path -> $ref'd definition inside $defs
+	defPaths      map[string]map[string]bool // defName -> paths parsed within the definition
+	baseURI       string
+	draft         Draft
+	docs          map[string]map[string]any // referenced documents by URI, including the schema itself
+	parsedTargets map[string]bool           // referenced definitions outside $defs whose rules are collected
+	unions        map[string]*unionInfo     // polymorphic oneOf/anyOf nodes by path
+	maps          map[string]*mapInfo       // additionalProperties/patternProperties objects by path or defName:path
+	defaults      map[string]any            // cached extracted defaults from schema
+	plan          *planNode                 // merge plan compiled from the rules above
+	unitSystems   map[string]UnitSystem     // unit systems of the quantity strategy by name
 }
 
 // LoadSchemaFromFile loads a JSON Schema from a file path.
-func LoadSchemaFromFile(path string) (*Schema, error) {
+// Relative $refs are resolved against the file's location and read from disk.
+// Other documents, such as http(s) URLs, require WithLoader.
+func LoadSchemaFromFile(path string, opts ...LoadOption) (*Schema, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read schema file: %w", err)
 	}
-	return LoadSchema(data)
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve schema file path: %w", err)
+	}
+	opts = append([]LoadOption{WithBaseURI(fileURI(filepath.ToSlash(absPath))), WithLoader(fileLoader{})}, opts...)
+	return LoadSchema(data, opts...)
+}
+
+// LoadOption configures LoadSchema.
+type LoadOption func(*loadConfig)
+
+// loadConfig holds the settings applied by LoadOptions.
+type loadConfig struct {
+	baseURI   string
+	resources map[string][]byte
+	loader    Loader
+	ctx       context.Context
+	draft     Draft
+	rules     []byte
+
+	unitSystems map[string]UnitSystem
+}
+
+// Draft identifies a JSON Schema draft.
+type Draft string
+
+// Supported JSON Schema drafts.
+const (
+	Draft7    Draft = "draft-07"
+	Draft2019 Draft = "2019-09"
+	Draft2020 Draft = "2020-12"
+)
+
+// compilerDrafts maps each supported draft to the compiler's draft.
+var compilerDrafts = map[Draft]*jsonschema.Draft{
+	Draft7:    jsonschema.Draft7,
+	Draft2019: jsonschema.Draft2019,
+	Draft2020: jsonschema.Draft2020,
+}
+
+// draftFromURI returns the draft a $schema URI identifies.
+func draftFromURI(uri string) (Draft, bool) {
+	uri = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(uri, "https://"), "http://"), "#")
+	switch uri {
+	case "json-schema.org/draft-07/schema":
+		return Draft7, true
+	case "json-schema.org/draft/2019-09/schema":
+		return Draft2019, true
+	case "json-schema.org/draft/2020-12/schema":
+		return Draft2020, true
+	}
+	return "", false
+}
+
+// WithBaseURI sets the URI of the schema document, against which relative
+// $refs to other documents are resolved. It defaults to "schema.json", so
+// relative refs resolve against the working directory.
+func WithBaseURI(uri string) LoadOption {
+	return func(c *loadConfig) {
+		c.baseURI = uri
+	}
+}
+
+// WithResource registers a schema document under uri. $refs to uri, or to an
+// $id the document declares, resolve to it without reading it from disk.
+func WithResource(uri string, schemaJSON []byte) LoadOption {
+	return func(c *loadConfig) {
+		c.resources[uri] = schemaJSON
+	}
+}
+
+// WithLoader fetches the documents the schema references through loader.
+// Without it, LoadSchema loads no external documents.
+func WithLoader(loader Loader) LoadOption {
+	return func(c *loadConfig) {
+		c.loader = loader
+	}
+}
+
+// WithDraft sets the draft of schema documents that do not declare one with
+// $schema. It defaults to Draft2020; a $schema keyword always takes precedence.
+func WithDraft(draft Draft) LoadOption {
+	return func(c *loadConfig) {
+		c.draft = draft
+	}
+}
+
+// WithContext sets the context for fetching referenced documents.
+func WithContext(ctx context.Context) LoadOption {
+	return func(c *loadConfig) {
+		c.ctx = ctx
+	}
 }
 
 // LoadSchema parses a JSON Schema with x-kfs-merge extensions.
-func LoadSchema(schemaJSON []byte) (*Schema, error) {
-	var raw map[string]any
-	if err := json.Unmarshal(schemaJSON, &raw); err != nil {
+// $refs to other documents are loaded and registered for validation, and
+// the merge rules and defaults they declare apply like local ones. Documents
+// are only fetched through WithLoader or registered with WithResource: by
+// default LoadSchema reads no files and makes no network requests, and a $ref
+// to another document is an error.
+func LoadSchema(schemaJSON []byte, opts ...LoadOption) (*Schema, error) {
+	cfg := loadConfig{
+		baseURI:   defaultBaseURI,
+		resources: make(map[string][]byte),
+		loader:    offlineLoader{},
+		ctx:       context.Background(),
+		draft:     Draft2020,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	defaultDraft, ok := compilerDrafts[cfg.draft]
+	if !ok {
+		return nil, fmt.Errorf("unsupported JSON Schema draft %q", cfg.draft)
+	}
+
+	raw, err := decodeSchema(schemaJSON)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse schema JSON: %w", err)
 	}
 
-	schemaValue, err := jsonschema.UnmarshalJSON(bytes.NewReader(schemaJSON))
+	s := &Schema{
+		raw:           raw,
+		globalConfig:  DefaultGlobalConfig(),
+		fieldConfigs:  make(map[string]FieldMergeConfig),
+		defConfigs:    make(map[string]FieldMergeConfig),
+		refToDefName:  make(map[string]string),
+		defRefs:       make(map[string]string),
+		defPaths:      make(map[string]map[string]bool),
+		baseURI:       cfg.baseURI,
+		draft:         cfg.draft,
+		parsedTargets: make(map[string]bool),
+		unions:        make(map[string]*unionInfo),
+		maps:          make(map[string]*mapInfo),
+		unitSystems:   unitSystemsWith(cfg.unitSystems),
+	}
+
+	sources, err := s.resolveResources(schemaJSON, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal schema: %w", err)
+		return nil, fmt.Errorf("failed to resolve schema references: %w", err)
+	}
+
+	if cfg.rules != nil {
+		if err := s.applyRules(cfg.rules); err != nil {
+			return nil, fmt.Errorf("failed to apply merge rules: %w", err)
+		}
+	}
+
+	if uri, ok := raw["$schema"].(string); ok {
+		if draft, ok := draftFromURI(uri); ok {
+			s.draft = draft
+		}
 	}
 
 	compiler := jsonschema.NewCompiler()
-	if err := compiler.AddResource("schema.json", schemaValue); err != nil {
-		return nil, fmt.Errorf("failed to add schema resource: %w", err)
+	compiler.DefaultDraft(defaultDraft)
+	byID := make(idLoader)
+	for uri, source := range sources {
+		value, err := jsonschema.UnmarshalJSON(bytes.NewReader(source))
+		if err != nil {
+			if uri == s.baseURI {
+				return nil, fmt.Errorf("failed to unmarshal schema: %w", err)
+			}
+			return nil, fmt.Errorf("failed to unmarshal schema %q: %w", uri, err)
+		}
+		if err := compiler.AddResource(uri, value); err != nil {
+			return nil, fmt.Errorf("failed to add schema resource %q: %w", uri, err)
+		}
+		if id, ok := s.docs[uri]["$id"].(string); ok && uri != s.baseURI {
+			if resolved, _, err := resolveURI(uri, id); err == nil && resolved != uri {
+				byID[resolved] = value
+			}
+		}
 	}
+	compiler.UseLoader(byID)
 
-	compiled, err := compiler.Compile("schema.json")
+	compiled, err := compiler.Compile(s.baseURI)
 	if err != nil {
 		return nil, fmt.Errorf("failed to compile schema: %w", err)
 	}
+	s.compiled = compiled
 
-	s := &Schema{
-		compiled:     compiled,
-		raw:          raw,
-		globalConfig: DefaultGlobalConfig(),
-		fieldConfigs: make(map[string]FieldMergeConfig),
-		defConfigs:   make(map[string]FieldMergeConfig),
-		refToDefName: make(map[string]string),
+	if err := s.checkMergeExtensions(); err != nil {
+		return nil, fmt.Errorf("invalid merge rules: %w", err)
 	}
 
 	if err := s.parseGlobalConfig(); err != nil {
@@ -75,6 +242,20 @@ func LoadSchema(schemaJSON []byte) (*Schema, error) {
 		return nil, fmt.Errorf("failed to parse field merge configs: %w", err)
 	}
 
+	if err := s.parseRootDefConfigs(); err != nil {
+		return nil, fmt.Errorf("failed to parse recursive root merge configs: %w", err)
+	}
+
+	if err := s.parseUnions(compiler, "", s.baseURI+"#", raw, make(map[string]bool)); err != nil {
+		return nil, fmt.Errorf("failed to parse oneOf/anyOf branches: %w", err)
+	}
+
+	if err := s.checkPredicates(); err != nil {
+		return nil, fmt.Errorf("invalid when predicate: %w", err)
+	}
+
+	s.compilePlan()
+
 	// Pre-extract defaults if applyDefaults is enabled at schema level
 	if s.globalConfig.ApplyDefaults {
 		s.ExtractDefaults()
@@ -84,8 +265,11 @@ func LoadSchema(schemaJSON []byte) (*Schema, error) {
 }
 
 // parseFieldMergeConfig extracts a FieldMergeConfig from a merge extension map.
-func parseFieldMergeConfig(mergeMap map[string]any) FieldMergeConfig {
+func parseFieldMergeConfig(mergeMap map[string]any) (FieldMergeConfig, error) {
 	config := FieldMergeConfig{}
+	if err := checkOptionTypes(mergeMap, fieldOptionTypes); err != nil {
+		return config, err
+	}
 	if strategy, ok := mergeMap["strategy"].(string); ok {
 		config.Strategy = MergeStrategy(strategy)
 	}
@@ -104,7 +288,92 @@ func parseFieldMergeConfig(mergeMap map[string]any) FieldMergeConfig {
 	if operation, ok := mergeMap["operation"].(string); ok {
 		config.Operation = operation
 	}
-	return config
+	if multipleOf, ok := mergeMap["multipleOf"].(float64); ok {
+		config.MultipleOf = &multipleOf
+	}
+	if roundTo, ok := mergeMap["roundTo"].(string); ok {
+		config.RoundTo = RoundMode(roundTo)
+	}
+	if constraint, ok := mergeMap["constraint"].(string); ok {
+		parsed, err := parseSemverConstraint(constraint)
+		if err != nil {
+			return config, err
+		}
+		config.Constraint, config.constraint = constraint, parsed
+	}
+	if versionField, ok := mergeMap["versionField"].(string); ok {
+		config.VersionField = versionField
+	}
+	if unit, ok := mergeMap["unit"].(string); ok {
+		config.Unit = unit
+	}
+	if canonicalUnit, ok := mergeMap["canonicalUnit"].(string); ok {
+		config.CanonicalUnit = canonicalUnit
+	}
+	if separator, ok := mergeMap["separator"].(string); ok {
+		config.Separator = &separator
+	}
+	if order, ok := mergeMap["order"].(string); ok {
+		config.Order = JoinOrder(order)
+	}
+	if mode, ok := mergeMap["mode"].(string); ok {
+		config.Mode = JoinMode(mode)
+	}
+	if keepLayer, ok := mergeMap["keepLayer"].(string); ok {
+		config.KeepLayer = keepLayer
+	}
+	if depth, ok := mergeMap["depth"].(float64); ok {
+		d := int(depth)
+		config.Depth = &d
+	}
+	if byDiscriminator, ok := mergeMap["byDiscriminator"].(map[string]any); ok {
+		config.ByDiscriminator = make(map[string]FieldMergeConfig, len(byDiscriminator))
+		for discValue, ruleRaw := range byDiscriminator {
+			if ruleMap, ok := ruleRaw.(map[string]any); ok {
+				rule, err := parseFieldMergeConfig(ruleMap)
+				if err != nil {
+					return config, fmt.Errorf("byDiscriminator %q: %w", discValue, err)
+				}
+				config.ByDiscriminator[discValue] = rule
+			}
+		}
+	}
+	if mapKeys, ok := mergeMap["mapKeys"].(string); ok {
+		config.MapKeys = MapKeysMode(mapKeys)
+	}
+	if whenRaw, ok := mergeMap["when"]; ok {
+		when, err := parseWhen(whenRaw)
+		if err != nil {
+			return config, err
+		}
+		config.When = when
+	}
+	return config, checkFieldMergeConfig(config)
+}
+
+// parseNodeMergeConfig is parseFieldMergeConfig for the x-kfs-merge annotation
+// of a schema node. Numeric configurations record the node's range keywords,
+// temporal ones its format.
+func (s *Schema) parseNodeMergeConfig(node, mergeMap map[string]any) (FieldMergeConfig, error) {
+	config, err := parseFieldMergeConfig(mergeMap)
+	if err != nil {
+		return config, err
+	}
+	bounds := s.numericBoundsOf(node, make(map[string]bool))
+	format := s.schemaFormat(node, make(map[string]bool))
+	withSchema := func(c *FieldMergeConfig) {
+		switch c.Strategy {
+		case StrategyNumeric:
+			c.bounds = bounds
+		case StrategyTemporal:
+			c.format = format
+		}
+	}
+	withSchema(&config)
+	for i := range config.When {
+		withSchema(&config.When[i].Then)
+	}
+	return config, nil
 }
 
 // parseGlobalConfig extracts the schema-level x-kfs-merge configuration.
@@ -118,6 +387,9 @@ func (s *Schema) parseGlobalConfig() error {
 	if !ok {
 		return fmt.Errorf("%s must be an object", MergeExtensionKey)
 	}
+	if err := checkGlobalMergeConfig(mergeMap); err != nil {
+		return err
+	}
 
 	if strategy, ok := mergeMap["defaultStrategy"].(string); ok {
 		s.globalConfig.DefaultStrategy = MergeStrategy(strategy)
@@ -135,54 +407,77 @@ func (s *Schema) parseGlobalConfig() error {
 	return nil
 }
 
-// parseDefsConfigs extracts merge configurations from $defs.
+// parseDefsConfigs extracts merge configurations from $defs and definitions.
 func (s *Schema) parseDefsConfigs() error {
-	defs, ok := s.raw["$defs"].(map[string]any)
-	if !ok {
-		return nil
-	}
-
-	for defName, defValue := range defs {
-		defMap, ok := defValue.(map[string]any)
+	for _, keyword := range defsKeywords {
+		defs, ok := s.raw[keyword].(map[string]any)
 		if !ok {
 			continue
 		}
 
-		if mergeRaw, ok := defMap[MergeExtensionKey]; ok {
-			mergeMap, ok := mergeRaw.(map[string]any)
-			if !ok {
-				return fmt.Errorf("%s in $defs/%s must be an object", MergeExtensionKey, defName)
+		for defName, defValue := range defs {
+			defMap, ok := defValue.(map[string]any)
+			if !ok || s.defsKeyword(defName) != keyword {
+				continue
 			}
 
-			config := parseFieldMergeConfig(mergeMap)
-			s.defConfigs[defName] = config
-		}
-
-		if err := s.parseDefFieldConfigs(defName, "", defMap); err != nil {
-			return err
+			if err := s.parseDefFieldConfigs(defName, "", defMap); err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// defConfigKey returns the defConfigs key for a path within a definition.
+func defConfigKey(defName, path string) string {
+	if path == "" {
+		return defName
+	}
+	return defName + ":" + path
+}
+
 // parseDefFieldConfigs parses field configs within a $defs definition.
+// Like parseFieldConfigs, rules from composition keywords do not override rules
+// already collected for the same path.
 func (s *Schema) parseDefFieldConfigs(defName, path string, node map[string]any) error {
-	if path != "" {
-		if mergeRaw, ok := node[MergeExtensionKey]; ok {
-			mergeMap, ok := mergeRaw.(map[string]any)
-			if !ok {
-				return fmt.Errorf("%s in $defs/%s%s must be an object", MergeExtensionKey, defName, path)
-			}
+	if s.defPaths[defName] == nil {
+		s.defPaths[defName] = make(map[string]bool)
+	}
+	s.defPaths[defName][path] = true
 
-			config := parseFieldMergeConfig(mergeMap)
-			s.defConfigs[defName+":"+path] = config
+	if mergeRaw, ok := node[MergeExtensionKey]; ok {
+		mergeMap, ok := mergeRaw.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s in %s%s must be an object", MergeExtensionKey, s.defDisplayName(defName), path)
+		}
+
+		config, err := s.parseNodeMergeConfig(node, mergeMap)
+		if err != nil {
+			return fmt.Errorf("%s in %s%s: %w", MergeExtensionKey, s.defDisplayName(defName), path, err)
+		}
+		key := defConfigKey(defName, path)
+		if _, exists := s.defConfigs[key]; !exists {
+			s.defConfigs[key] = config
+		}
+	}
+
+	if ref, ok := schemaRef(node); ok {
+		if target, isLocal := s.resolveRef(ref); isLocal {
+			if err := s.parseRefTarget(target); err != nil {
+				return err
+			}
+			key := defConfigKey(defName, path)
+			if _, exists := s.defRefs[key]; !exists {
+				s.defRefs[key] = target
+			}
 		}
 	}
 
 	if props, ok := node["properties"].(map[string]any); ok {
 		for propName, propValue := range props {
-			propPath := path + "/" + propName
+			propPath := childPath(path, propName)
 			if propMap, ok := propValue.(map[string]any); ok {
 				if err := s.parseDefFieldConfigs(defName, propPath, propMap); err != nil {
 					return err
@@ -198,31 +493,36 @@ func (s *Schema) parseDefFieldConfigs(defName, path string, node map[string]any)
 		}
 	}
 
-	return nil
-}
+	info, err := parseMapInfo(node)
+	if err != nil {
+		return fmt.Errorf("%s%s: %w", s.defDisplayName(defName), path, err)
+	}
+	if info != nil {
+		if _, exists := s.maps[defName+":"+path]; !exists {
+			s.maps[defName+":"+path] = info
+		}
+		err := mapSubschemas(node, func(segment string, sub map[string]any) error {
+			return s.parseDefFieldConfigs(defName, childPath(path, segment), sub)
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-// resolveRef resolves a $ref string to the definition name.
-func (s *Schema) resolveRef(ref string) (string, bool) {
-	const defsPrefix = "#/$defs/"
-	if len(ref) > len(defsPrefix) && ref[:len(defsPrefix)] == defsPrefix {
-		return ref[len(defsPrefix):], true
+	for _, sub := range s.compositionSubschemas(node) {
+		if err := s.parseDefFieldConfigs(defName, path, sub); err != nil {
+			return err
+		}
 	}
-	return "", false
+
+	return nil
 }
 
 // parseFieldConfigs recursively extracts per-field x-kfs-merge configurations.
+// Subschemas of composition keywords are walked at the same path; the first
+// rule collected for a path wins, so a node's own rules take precedence over
+// those of its subschemas (see compositionKeywords).
 func (s *Schema) parseFieldConfigs(path string, node map[string]any) error {
-	if ref, ok := node["$ref"].(string); ok {
-		if defName, isLocal := s.resolveRef(ref); isLocal {
-			s.refToDefName[path] = defName
-			if config, ok := s.defConfigs[defName]; ok {
-				if _, exists := s.fieldConfigs[path]; !exists {
-					s.fieldConfigs[path] = config
-				}
-			}
-		}
-	}
-
 	if mergeRaw, ok := node[MergeExtensionKey]; ok {
 		if path != "" {
 			mergeMap, ok := mergeRaw.(map[string]any)
@@ -230,37 +530,27 @@ func (s *Schema) parseFieldConfigs(path string, node map[string]any) error {
 				return fmt.Errorf("%s at %s must be an object", MergeExtensionKey, path)
 			}
 
-			config := parseFieldMergeConfig(mergeMap)
-			s.fieldConfigs[path] = config
-		}
-	}
-
-	if anyOf, ok := node["anyOf"].([]any); ok {
-		for _, alt := range anyOf {
-			if altMap, ok := alt.(map[string]any); ok {
-				if ref, ok := altMap["$ref"].(string); ok {
-					if defName, isLocal := s.resolveRef(ref); isLocal {
-						s.refToDefName[path] = defName
-						if config, ok := s.defConfigs[defName]; ok {
-							if _, exists := s.fieldConfigs[path]; !exists {
-								s.fieldConfigs[path] = config
-							}
-						}
-					}
-				}
+			config, err := s.parseNodeMergeConfig(node, mergeMap)
+			if err != nil {
+				return fmt.Errorf("%s at %s: %w", MergeExtensionKey, path, err)
+			}
+			if _, exists := s.fieldConfigs[path]; !exists {
+				s.fieldConfigs[path] = config
 			}
 		}
 	}
 
-	if oneOf, ok := node["oneOf"].([]any); ok {
-		for _, alt := range oneOf {
-			if altMap, ok := alt.(map[string]any); ok {
-				if ref, ok := altMap["$ref"].(string); ok {
-					if defName, isLocal := s.resolveRef(ref); isLocal {
-						if _, exists := s.refToDefName[path]; !exists {
-							s.refToDefName[path] = defName
-						}
-					}
+	if ref, ok := schemaRef(node); ok {
+		if defName, isLocal := s.resolveRef(ref); isLocal {
+			if err := s.parseRefTarget(defName); err != nil {
+				return err
+			}
+			if _, exists := s.refToDefName[path]; !exists {
+				s.refToDefName[path] = defName
+			}
+			if config, ok := s.defConfigAt(defName, ""); ok {
+				if _, exists := s.fieldConfigs[path]; !exists {
+					s.fieldConfigs[path] = config
 				}
 			}
 		}
@@ -268,7 +558,7 @@ func (s *Schema) parseFieldConfigs(path string, node map[string]any) error {
 
 	if props, ok := node["properties"].(map[string]any); ok {
 		for propName, propValue := range props {
-			propPath := path + "/" + propName
+			propPath := childPath(path, propName)
 			if propMap, ok := propValue.(map[string]any); ok {
 				if err := s.parseFieldConfigs(propPath, propMap); err != nil {
 					return err
@@ -284,41 +574,163 @@ func (s *Schema) parseFieldConfigs(path string, node map[string]any) error {
 		}
 	}
 
+	info, err := parseMapInfo(node)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if info != nil {
+		if _, exists := s.maps[path]; !exists {
+			s.maps[path] = info
+		}
+		err := mapSubschemas(node, func(segment string, sub map[string]any) error {
+			return s.parseFieldConfigs(childPath(path, segment), sub)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range s.compositionSubschemas(node) {
+		if err := s.parseFieldConfigs(path, sub); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// compositionKeywords lists the applicator keywords whose subschemas describe
+// the same instance as their parent, in precedence order: when several
+// subschemas supply rules for the same path, earlier keywords win, and within
+// a keyword earlier branches win.
+var compositionKeywords = []string{"allOf", "anyOf", "oneOf", "then", "else", "if", "dependentSchemas", "not"}
+
+// compositionSubschemas returns the subschemas of node's composition keywords
+// in precedence order. Polymorphic oneOf/anyOf alternatives (two or more object
+// branches) are skipped: their rules apply only within the matched branch.
+func (s *Schema) compositionSubschemas(node map[string]any) []map[string]any {
+	var subs []map[string]any
+	for _, keyword := range compositionKeywords {
+		switch value := node[keyword].(type) {
+		case []any:
+			if (keyword == "oneOf" || keyword == "anyOf") && s.isUnion(value) {
+				continue
+			}
+			for _, alt := range value {
+				if altMap, ok := alt.(map[string]any); ok {
+					subs = append(subs, altMap)
+				}
+			}
+		case map[string]any:
+			if keyword != "dependentSchemas" {
+				subs = append(subs, value)
+				continue
+			}
+			names := make([]string, 0, len(value))
+			for name := range value {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if depMap, ok := value[name].(map[string]any); ok {
+					subs = append(subs, depMap)
+				}
+			}
+		}
+	}
+	return subs
+}
+
+// isUnion reports whether oneOf/anyOf alternatives form a polymorphic union.
+func (s *Schema) isUnion(alts []any) bool {
+	objects := 0
+	for _, alt := range alts {
+		if altMap, ok := alt.(map[string]any); ok && s.isObjectBranch(altMap) {
+			objects++
+		}
+	}
+	return objects >= 2
+}
+
 // GlobalConfig returns the schema-level merge configuration.
 func (s *Schema) GlobalConfig() GlobalMergeConfig {
 	return s.globalConfig
 }
 
-// FieldConfig returns the merge configuration for a specific field path.
+// FieldConfig returns the merge configuration for a specific field path, a
+// JSON pointer such as "/vars/a~1b" for the key "a/b". Dynamic keys of
+// map-like objects resolve to their additionalProperties or patternProperties
+// rules.
 func (s *Schema) FieldConfig(path string) (FieldMergeConfig, bool) {
-	if config, ok := s.fieldConfigs[path]; ok {
-		return config, true
+	if node := s.plan.at(path); node != nil && node.hasConfig {
+		return node.config, true
 	}
+	return FieldMergeConfig{}, false
+}
 
-	for basePath := range s.refToDefName {
-		if len(path) > len(basePath) && path[:len(basePath)] == basePath {
-			defName := s.refToDefName[basePath]
-			relativePath := path[len(basePath):]
-			if config, ok := s.defConfigs[defName+":"+relativePath]; ok {
-				return config, true
-			}
+// defConfigAt returns the config for a path relative to a definition,
+// following $refs between definitions transitively.
+func (s *Schema) defConfigAt(defName, relativePath string) (FieldMergeConfig, bool) {
+	var config FieldMergeConfig
+	found := s.resolveInDefs(defName, relativePath, make(map[string]bool), func(defName, relativePath string) bool {
+		var ok bool
+		config, ok = s.defConfigs[defConfigKey(defName, relativePath)]
+		return ok
+	})
+	return config, found
+}
+
+// resolveInDefs calls found for a path relative to a definition and, until it
+// reports true, for the same location seen through each $ref inside the
+// definition that the path passes through, longest reference first. Each
+// definition/path pair is visited at most once, so reference cycles terminate.
+func (s *Schema) resolveInDefs(defName, relativePath string, visiting map[string]bool, found func(defName, relativePath string) bool) bool {
+	key := defName + ":" + relativePath
+	if visiting[key] {
+		return false
+	}
+	visiting[key] = true
+
+	if found(defName, relativePath) {
+		return true
+	}
+
+	var refPaths []string
+	for refKey := range s.defRefs {
+		refPath, ok := strings.CutPrefix(refKey, defName)
+		if !ok || (refPath != "" && refPath[0] != ':') {
+			continue
+		}
+		refPath = strings.TrimPrefix(refPath, ":")
+		if relativePath == refPath || strings.HasPrefix(relativePath, refPath+"/") {
+			refPaths = append(refPaths, refPath)
 		}
 	}
+	sort.Slice(refPaths, func(i, j int) bool { return len(refPaths[i]) > len(refPaths[j]) })
 
-	return FieldMergeConfig{}, false
+	for _, refPath := range refPaths {
+		target := s.defRefs[defConfigKey(defName, refPath)]
+		if s.resolveInDefs(target, relativePath[len(refPath):], visiting, found) {
+			return true
+		}
+	}
+	return false
 }
 
 // NullHandlingFor returns the null handling setting for a specific field path.
 func (s *Schema) NullHandlingFor(path string) NullHandling {
-	if config, ok := s.fieldConfigs[path]; ok && config.NullHandling != "" {
-		return config.NullHandling
+	if node := s.plan.at(path); node != nil {
+		return node.nullHandling
 	}
 	return s.globalConfig.NullHandling
 }
 
+// Draft returns the draft of the schema document: the one its $schema
+// declares, or else the one set with WithDraft.
+func (s *Schema) Draft() Draft {
+	return s.draft
+}
+
 // CompiledSchema returns the underlying compiled JSON Schema.
 func (s *Schema) CompiledSchema() *jsonschema.Schema {
 	return s.compiled
@@ -331,13 +743,13 @@ func (s *Schema) Defaults() map[string]any {
 }
 
 // ExtractDefaults extracts and caches default values from the schema.
-// This is called automatically during LoadSchema if applyDefaults is enabled.
+// Numbers are json.Number, as in decoded instances. This is called automatically during LoadSchema if applyDefaults is enabled.
 func (s *Schema) ExtractDefaults() map[string]any {
 	if s.defaults != nil {
 		return s.defaults
 	}
 
-	defaults := s.extractDefaultsFromNode(s.raw)
+	defaults := withJSONNumbers(s.extractDefaultsFromNode(s.raw, map[string]bool{rootDefName: true}))
 	if defaultsMap, ok := defaults.(map[string]any); ok {
 		s.defaults = defaultsMap
 	}
@@ -345,14 +757,16 @@ func (s *Schema) ExtractDefaults() map[string]any {
 }
 
 // extractDefaultsFromNode recursively extracts defaults from a schema node.
-func (s *Schema) extractDefaultsFromNode(node map[string]any) any {
+// Definitions already being expanded higher up are not expanded again, so
+// recursive schemas contribute defaults down to their first repetition.
+func (s *Schema) extractDefaultsFromNode(node map[string]any, visiting map[string]bool) any {
 	// Handle $ref first
-	if ref, ok := node["$ref"].(string); ok {
-		if defName, isLocal := s.resolveRef(ref); isLocal {
-			if defs, ok := s.raw["$defs"].(map[string]any); ok {
-				if defNode, ok := defs[defName].(map[string]any); ok {
-					return s.extractDefaultsFromNode(defNode)
-				}
+	if ref, ok := schemaRef(node); ok {
+		if defName, isLocal := s.resolveRef(ref); isLocal && !visiting[defName] {
+			if defNode, ok := s.defNode(defName); ok {
+				visiting[defName] = true
+				defer delete(visiting, defName)
+				return s.extractDefaultsFromNode(defNode, visiting)
 			}
 		}
 		return nil
@@ -376,7 +790,7 @@ func (s *Schema) extractDefaultsFromNode(node map[string]any) any {
 			continue
 		}
 
-		propDefault := s.extractDefaultsFromNode(propMap)
+		propDefault := s.extractDefaultsFromNode(propMap, visiting)
 		if propDefault != nil {
 			leafDefaults[propName] = propDefault
 		}
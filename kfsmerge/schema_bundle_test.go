@@ -0,0 +1,158 @@
+package kfsmerge
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// Schema Bundling Tests
+// =============================================================================
+
+// TestBundle tests inlining external references into a self-contained schema.
+func TestBundle(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"job.json": `{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"type": "object",
+			"$defs": {
+				"Limit": {"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "max"}}
+			},
+			"properties": {
+				"workers": {"$ref": "#/$defs/Limit"},
+				"audio": {"$ref": "media/audio.json"},
+				"chain": {"$ref": "media/filters.json#/$defs/FilterChain"}
+			}
+		}`,
+		"media/audio.json": `{
+			"$id": "audio.json",
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"type": "object",
+			"properties": {
+				"bitrate": {"$ref": "common.json#/$defs/Limit"},
+				"tracks": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat", "unique": true}}
+			}
+		}`,
+		"media/common.json": `{
+			"$defs": {
+				"Limit": {"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "min"}}
+			}
+		}`,
+		"media/filters.json": `{
+			"$defs": {
+				"FilterChain": {
+					"$anchor": "chain",
+					"type": "object",
+					"properties": {
+						"filters": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat"}},
+						"child": {"$ref": "#chain"}
+					}
+				}
+			}
+		}`,
+	})
+
+	s, err := LoadSchemaFromFile(filepath.Join(dir, "job.json"))
+	if err != nil {
+		t.Fatalf("LoadSchemaFromFile failed: %v", err)
+	}
+
+	bundled, err := s.Bundle()
+	if err != nil {
+		t.Fatalf("Bundle failed: %v", err)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(bundled, &doc); err != nil {
+		t.Fatalf("bundled schema is not JSON: %v", err)
+	}
+	defs, _ := doc["$defs"].(map[string]any)
+	for _, name := range []string{"Limit", "Limit_2", "audio", "FilterChain"} {
+		if _, ok := defs[name]; !ok {
+			t.Errorf("bundled $defs missing %q; got %v", name, keysOf(defs))
+		}
+	}
+	if strings.Contains(string(bundled), ".json#") {
+		t.Errorf("bundled schema still references other documents:\n%s", bundled)
+	}
+
+	standalone, err := LoadSchema(bundled, WithLoader(MapLoader{}))
+	if err != nil {
+		t.Fatalf("LoadSchema of bundle failed: %v", err)
+	}
+
+	a := []byte(`{"workers": 2, "audio": {"bitrate": 256, "tracks": ["en", "fr"]}, "chain": {"child": {"filters": ["crop"]}}}`)
+	b := []byte(`{"workers": 4, "audio": {"bitrate": 128, "tracks": ["en"]}, "chain": {"child": {"filters": ["scale"]}}}`)
+	expected := `{"workers": 4, "audio": {"bitrate": 128, "tracks": ["en", "fr"]}, "chain": {"child": {"filters": ["scale", "crop"]}}}`
+
+	for name, schema := range map[string]*Schema{"original": s, "bundled": standalone} {
+		result, err := schema.Merge(a, b)
+		if err != nil {
+			t.Fatalf("%s Merge failed: %v", name, err)
+		}
+		assertJSONEqualString(t, result, expected)
+	}
+}
+
+// TestBundleWithoutExternalRefs tests that a self-contained schema bundles to itself.
+func TestBundleWithoutExternalRefs(t *testing.T) {
+	s, err := LoadSchemaFromFile("../examples/kfs_media_schema.json")
+	if err != nil {
+		t.Fatalf("LoadSchemaFromFile failed: %v", err)
+	}
+
+	bundled, err := s.Bundle()
+	if err != nil {
+		t.Fatalf("Bundle failed: %v", err)
+	}
+
+	data, err := os.ReadFile("../examples/kfs_media_schema.json")
+	if err != nil {
+		t.Fatalf("failed to read schema: %v", err)
+	}
+	var original, got map[string]any
+	if err := json.Unmarshal(data, &original); err != nil {
+		t.Fatalf("failed to parse schema: %v", err)
+	}
+	if err := json.Unmarshal(bundled, &got); err != nil {
+		t.Fatalf("bundled schema is not JSON: %v", err)
+	}
+	if len(got["$defs"].(map[string]any)) != len(original["$defs"].(map[string]any)) {
+		t.Error("bundling a self-contained schema changed its $defs")
+	}
+}
+
+// TestSameRulesDetectsDifferences tests the round-trip rule table comparison.
+func TestSameRulesDetectsDifferences(t *testing.T) {
+	load := func(strategy string) *Schema {
+		s, err := LoadSchema([]byte(`{
+			"type": "object",
+			"$defs": {"Tags": {"type": "array", "x-kfs-merge": {"strategy": "` + strategy + `"}}},
+			"properties": {"tags": {"$ref": "#/$defs/Tags"}}
+		}`))
+		if err != nil {
+			t.Fatalf("LoadSchema failed: %v", err)
+		}
+		return s
+	}
+
+	if err := load("concat").sameRules(load("concat")); err != nil {
+		t.Errorf("sameRules on equal schemas: %v", err)
+	}
+	err := load("concat").sameRules(load("replace"))
+	if err == nil || !strings.Contains(err.Error(), `"/tags"`) {
+		t.Errorf("sameRules error = %v, want difference at /tags", err)
+	}
+}
+
+// keysOf returns the keys of a map, for failure messages.
+func keysOf(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
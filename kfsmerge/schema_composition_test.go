@@ -0,0 +1,204 @@
+package kfsmerge
+
+import "testing"
+
+// =============================================================================
+// Composition Keyword Rule Collection Tests
+// =============================================================================
+
+// TestMergeRulesInsideComposition tests that rules declared inside composition
+// keywords apply to the instance path the composition describes.
+func TestMergeRulesInsideComposition(t *testing.T) {
+	schemaJSON := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"$defs": {
+			"Retry": {
+				"type": "object",
+				"properties": {
+					"attempts": {"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "max"}}
+				}
+			}
+		},
+		"properties": {
+			"output": {
+				"anyOf": [
+					{
+						"type": "object",
+						"properties": {
+							"tags": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat"}}
+						}
+					},
+					{"type": "null"}
+				]
+			},
+			"encoder": {
+				"allOf": [
+					{"properties": {"preset": {"type": "string", "x-kfs-merge": {"strategy": "keepBase"}}}},
+					{"properties": {"retry": {"$ref": "#/$defs/Retry"}}}
+				]
+			},
+			"audio": {
+				"type": "object",
+				"if": {"properties": {"codec": {"const": "aac"}}},
+				"then": {"properties": {"bitrate": {"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "min"}}}},
+				"else": {"properties": {"channels": {"type": "integer", "x-kfs-merge": {"strategy": "keepBase"}}}}
+			},
+			"upload": {
+				"type": "object",
+				"dependentSchemas": {
+					"bucket": {"properties": {"acl": {"type": "string", "x-kfs-merge": {"strategy": "keepBase"}}}}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "inline anyOf branch with null",
+			a:        `{"output": {"tags": ["a"]}}`,
+			b:        `{"output": {"tags": ["b"]}}`,
+			expected: `{"output": {"tags": ["b", "a"]}}`,
+		},
+		{
+			name:     "allOf inline rule",
+			a:        `{"encoder": {"preset": "fast"}}`,
+			b:        `{"encoder": {"preset": "slow"}}`,
+			expected: `{"encoder": {"preset": "slow"}}`,
+		},
+		{
+			name:     "allOf referenced definition rule",
+			a:        `{"encoder": {"retry": {"attempts": 2}}}`,
+			b:        `{"encoder": {"retry": {"attempts": 5}}}`,
+			expected: `{"encoder": {"retry": {"attempts": 5}}}`,
+		},
+		{
+			name:     "then rule",
+			a:        `{"audio": {"codec": "aac", "bitrate": 256}}`,
+			b:        `{"audio": {"codec": "aac", "bitrate": 128}}`,
+			expected: `{"audio": {"codec": "aac", "bitrate": 128}}`,
+		},
+		{
+			name:     "else rule",
+			a:        `{"audio": {"codec": "pcm", "channels": 2}}`,
+			b:        `{"audio": {"codec": "pcm", "channels": 6}}`,
+			expected: `{"audio": {"codec": "pcm", "channels": 6}}`,
+		},
+		{
+			name:     "dependentSchemas rule",
+			a:        `{"upload": {"bucket": "b", "acl": "public"}}`,
+			b:        `{"upload": {"bucket": "b", "acl": "private"}}`,
+			expected: `{"upload": {"bucket": "b", "acl": "private"}}`,
+		},
+	}
+
+	s, err := LoadSchema([]byte(schemaJSON))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
+
+// TestMergeCompositionRulePrecedence tests which rule wins when several
+// subschemas declare one for the same path.
+func TestMergeCompositionRulePrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    string
+		expected string
+	}{
+		{
+			name: "own rule beats composition",
+			field: `{
+				"x-kfs-merge": {"strategy": "keepRequest"},
+				"allOf": [{"x-kfs-merge": {"strategy": "keepBase"}}]
+			}`,
+			expected: `{"value": "request"}`,
+		},
+		{
+			name:     "earlier allOf branch wins",
+			field:    `{"allOf": [{"x-kfs-merge": {"strategy": "keepBase"}}, {"x-kfs-merge": {"strategy": "keepRequest"}}]}`,
+			expected: `{"value": "base"}`,
+		},
+		{
+			name: "allOf beats then",
+			field: `{
+				"if": {"type": "string"},
+				"then": {"x-kfs-merge": {"strategy": "keepRequest"}},
+				"allOf": [{"x-kfs-merge": {"strategy": "keepBase"}}]
+			}`,
+			expected: `{"value": "base"}`,
+		},
+		{
+			name:     "own $ref definition beats composition",
+			field:    `{"$ref": "#/$defs/Pinned", "anyOf": [{"x-kfs-merge": {"strategy": "keepRequest"}}, {"type": "null"}]}`,
+			expected: `{"value": "base"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadSchema([]byte(`{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"type": "object",
+				"$defs": {
+					"Pinned": {"type": "string", "x-kfs-merge": {"strategy": "keepBase"}}
+				},
+				"properties": {
+					"value": ` + tt.field + `
+				}
+			}`))
+			if err != nil {
+				t.Fatalf("LoadSchema failed: %v", err)
+			}
+
+			result, err := s.Merge([]byte(`{"value": "request"}`), []byte(`{"value": "base"}`))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
+
+// TestMergeRulesInsideDefComposition tests that composition keywords inside
+// $defs definitions are walked as well.
+func TestMergeRulesInsideDefComposition(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"$defs": {
+			"Output": {
+				"allOf": [
+					{"properties": {"paths": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat", "unique": true}}}}
+				]
+			}
+		},
+		"properties": {
+			"output": {"$ref": "#/$defs/Output"}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	result, err := s.Merge([]byte(`{"output": {"paths": ["/b", "/c"]}}`), []byte(`{"output": {"paths": ["/a", "/b"]}}`))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"output": {"paths": ["/a", "/b", "/c"]}}`)
+}
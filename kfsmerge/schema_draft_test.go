@@ -0,0 +1,235 @@
+package kfsmerge
+
+import (
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// Draft-07 and OpenAPI Tests
+// =============================================================================
+
+// TestLoadSchemaDraft07Definitions tests a pydantic v1 style schema using definitions.
+func TestLoadSchemaDraft07Definitions(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"title": "Job",
+		"type": "object",
+		"properties": {
+			"output": {"$ref": "#/definitions/Output"},
+			"labels": {"title": "Labels", "allOf": [{"$ref": "#/definitions/Labels"}]},
+			"region": {"$ref": "#region"}
+		},
+		"definitions": {
+			"Output": {
+				"title": "Output",
+				"type": "object",
+				"properties": {
+					"formats": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat", "unique": true}},
+					"bitrate": {"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "max"}}
+				}
+			},
+			"Labels": {"type": "object", "additionalProperties": {"type": "string"}, "x-kfs-merge": {"strategy": "keepBase"}},
+			"Region": {"$id": "#region", "type": "string", "x-kfs-merge": {"strategy": "keepBase"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+	if s.Draft() != Draft7 {
+		t.Errorf("Draft() = %q, want %q", s.Draft(), Draft7)
+	}
+
+	result, err := s.Merge(
+		[]byte(`{"output": {"formats": ["hls"], "bitrate": 4000}, "labels": {"team": "a"}, "region": "eu"}`),
+		[]byte(`{"output": {"formats": ["dash", "hls"], "bitrate": 2000}, "labels": {"team": "b"}, "region": "us"}`),
+	)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"output": {"formats": ["dash", "hls"], "bitrate": 4000}, "labels": {"team": "b"}, "region": "us"}`)
+}
+
+// TestLoadSchemaDefsShadowDefinitions tests that $defs wins over definitions of the same name.
+func TestLoadSchemaDefsShadowDefinitions(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"type": "object",
+		"properties": {
+			"a": {"$ref": "#/$defs/Tags"},
+			"b": {"$ref": "#/definitions/Tags"}
+		},
+		"$defs": {"Tags": {"type": "array", "x-kfs-merge": {"strategy": "concat"}}},
+		"definitions": {"Tags": {"type": "array", "x-kfs-merge": {"strategy": "keepBase"}}}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	result, err := s.Merge([]byte(`{"a": [1], "b": [1]}`), []byte(`{"a": [2], "b": [2]}`))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"a": [2, 1], "b": [2]}`)
+}
+
+// TestLoadSchemaWithDraft tests the draft option and $schema detection.
+func TestLoadSchemaWithDraft(t *testing.T) {
+	// Array-form items is a draft-07 tuple but invalid in 2020-12.
+	tuple := `{"type": "object", "properties": {"size": {"type": "array", "items": [{"type": "integer"}, {"type": "integer"}]}}}`
+
+	tests := []struct {
+		name      string
+		schema    string
+		opts      []LoadOption
+		wantDraft Draft
+		wantErr   string
+	}{
+		{name: "default draft", schema: `{"type": "object"}`, wantDraft: Draft2020},
+		{name: "draft option", schema: tuple, opts: []LoadOption{WithDraft(Draft7)}, wantDraft: Draft7},
+		{name: "tuple items without draft option", schema: tuple, wantErr: "failed to compile schema"},
+		{
+			name:      "$schema overrides draft option",
+			schema:    `{"$schema": "https://json-schema.org/draft/2019-09/schema", "type": "object"}`,
+			opts:      []LoadOption{WithDraft(Draft7)},
+			wantDraft: Draft2019,
+		},
+		{name: "unsupported draft", schema: `{}`, opts: []LoadOption{WithDraft("draft-03")}, wantErr: `unsupported JSON Schema draft "draft-03"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadSchema([]byte(tt.schema), tt.opts...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSchema failed: %v", err)
+			}
+			if s.Draft() != tt.wantDraft {
+				t.Errorf("Draft() = %q, want %q", s.Draft(), tt.wantDraft)
+			}
+		})
+	}
+}
+
+// TestBundleDraft07 tests that draft-07 schemas are bundled into definitions.
+func TestBundleDraft07(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"job.json": `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"type": "object",
+			"properties": {"tags": {"$ref": "common.json#/definitions/Tags"}}
+		}`,
+		"common.json": `{
+			"definitions": {"Tags": {"type": "array", "x-kfs-merge": {"strategy": "concat"}}}
+		}`,
+	})
+
+	s, err := LoadSchemaFromFile(dir + "/job.json")
+	if err != nil {
+		t.Fatalf("LoadSchemaFromFile failed: %v", err)
+	}
+	bundled, err := s.Bundle()
+	if err != nil {
+		t.Fatalf("Bundle failed: %v", err)
+	}
+	if !strings.Contains(string(bundled), `"$ref": "#/definitions/Tags"`) {
+		t.Errorf("bundled schema does not reference definitions/Tags:\n%s", bundled)
+	}
+}
+
+const openAPIDocument = `{
+	"openapi": "3.0.3",
+	"info": {"title": "Jobs", "version": "1.0.0"},
+	"paths": {},
+	"components": {
+		"schemas": {
+			"Job": {
+				"type": "object",
+				"x-kfs-merge": {"arrayStrategy": "concat"},
+				"properties": {
+					"output": {"$ref": "#/components/schemas/Output"},
+					"priority": {"type": "integer", "minimum": 0, "exclusiveMinimum": true},
+					"note": {"type": "string", "nullable": true},
+					"steps": {"type": "array", "items": {"type": "string"}},
+					"parent": {"$ref": "#/components/schemas/Job"}
+				}
+			},
+			"Output": {
+				"type": "object",
+				"properties": {
+					"bitrate": {"$ref": "#/components/schemas/Bitrate"},
+					"preset": {"type": "string", "x-kfs-merge": {"strategy": "keepBase"}}
+				}
+			},
+			"Bitrate": {"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "min"}},
+			"Unused": {"type": "string"}
+		}
+	}
+}`
+
+// TestLoadSchemaFromOpenAPI tests merge rules embedded in OpenAPI component schemas.
+func TestLoadSchemaFromOpenAPI(t *testing.T) {
+	s, err := LoadSchemaFromOpenAPI([]byte(openAPIDocument), "Job")
+	if err != nil {
+		t.Fatalf("LoadSchemaFromOpenAPI failed: %v", err)
+	}
+	if s.GlobalConfig().ArrayStrategy != StrategyConcat {
+		t.Errorf("ArrayStrategy = %q, want %q", s.GlobalConfig().ArrayStrategy, StrategyConcat)
+	}
+
+	result, err := s.Merge(
+		[]byte(`{"output": {"bitrate": 4000, "preset": "fast"}, "steps": ["a"], "note": null, "parent": {"output": {"preset": "slow"}}}`),
+		[]byte(`{"output": {"bitrate": 2000, "preset": "slow"}, "steps": ["b"], "priority": 1, "parent": {"output": {"preset": "fast"}}}`),
+	)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{
+		"output": {"bitrate": 2000, "preset": "slow"},
+		"steps": ["b", "a"],
+		"priority": 1,
+		"note": null,
+		"parent": {"output": {"preset": "fast"}}
+	}`)
+
+	// The OpenAPI 3.0 exclusiveMinimum applies.
+	if _, err := s.Merge([]byte(`{"priority": 0}`), []byte(`{}`)); err == nil {
+		t.Error("expected validation error for priority 0 with exclusive minimum, got nil")
+	}
+
+	if _, ok := s.raw["$defs"].(map[string]any)["Unused"]; ok {
+		t.Error("unreferenced component schema was copied into $defs")
+	}
+}
+
+// TestLoadSchemaFromOpenAPIErrors tests invalid OpenAPI inputs.
+func TestLoadSchemaFromOpenAPIErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		doc       string
+		component string
+		wantErr   string
+	}{
+		{name: "missing component", doc: openAPIDocument, component: "Missing", wantErr: `component schema "Missing" not found`},
+		{name: "swagger 2", doc: `{"swagger": "2.0"}`, component: "Job", wantErr: "unsupported OpenAPI version"},
+		{
+			name:      "dangling component ref",
+			doc:       `{"openapi": "3.1.0", "components": {"schemas": {"Job": {"properties": {"a": {"$ref": "#/components/schemas/Gone"}}}}}}`,
+			component: "Job",
+			wantErr:   `component schema "Gone" not found`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadSchemaFromOpenAPI([]byte(tt.doc), tt.component)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package kfsmerge
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// =============================================================================
+// x-kfs-merge Validation Tests
+// =============================================================================
+
+// TestLoadSchemaValidatesMergeRules tests that invalid x-kfs-merge annotations are load errors.
+func TestLoadSchemaValidatesMergeRules(t *testing.T) {
+	// schemaWith returns a schema with one property declared by prop.
+	schemaWith := func(prop string) string {
+		return `{"type": "object", "properties": {"field": ` + prop + `}, "$defs": {"Text": {"type": "string"}}}`
+	}
+
+	tests := []struct {
+		name    string
+		schema  string
+		opts    []LoadOption
+		wantErr string
+	}{
+		{
+			name:    "unknown key",
+			schema:  schemaWith(`{"type": "array", "x-kfs-merge": {"strategy": "concat", "mergeKey": "name"}}`),
+			wantErr: `#/properties/field/x-kfs-merge: unknown key "mergeKey"`,
+		},
+		{
+			name:    "unknown strategy",
+			schema:  schemaWith(`{"type": "object", "x-kfs-merge": {"strategy": "overlay"}}`),
+			wantErr: `#/properties/field/x-kfs-merge: unknown strategy "overlay"`,
+		},
+		{
+			name:    "wrongly typed option",
+			schema:  schemaWith(`{"type": "array", "x-kfs-merge": {"strategy": "concat", "unique": "yes"}}`),
+			wantErr: "unique must be a boolean, got string",
+		},
+		{
+			name:    "fractional depth",
+			schema:  schemaWith(`{"type": "object", "x-kfs-merge": {"strategy": "shallowMerge", "depth": 1.5}}`),
+			wantErr: "depth must be an integer, got number",
+		},
+		{
+			name:    "unknown nullHandling",
+			schema:  schemaWith(`{"x-kfs-merge": {"nullHandling": "ignore"}}`),
+			wantErr: `unknown nullHandling "ignore"`,
+		},
+		{
+			name:    "discriminatorField on object",
+			schema:  schemaWith(`{"type": "object", "x-kfs-merge": {"discriminatorField": "type"}}`),
+			wantErr: "discriminatorField requires an array or oneOf/anyOf schema, got object",
+		},
+		{
+			name:    "numeric on string",
+			schema:  schemaWith(`{"type": "string", "x-kfs-merge": {"strategy": "numeric"}}`),
+			wantErr: `strategy "numeric" requires a number schema, got string`,
+		},
+		{
+			name:    "numeric on referenced string",
+			schema:  schemaWith(`{"$ref": "#/$defs/Text", "x-kfs-merge": {"strategy": "numeric"}}`),
+			wantErr: `strategy "numeric" requires a number schema, got string`,
+		},
+		{
+			name:    "unknown operation",
+			schema:  schemaWith(`{"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "median"}}`),
+			wantErr: `unknown numeric operation "median", want one of sum, max, min, avg, product, clamp`,
+		},
+		{
+			name:    "clamp without bounds",
+			schema:  schemaWith(`{"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "clamp"}}`),
+			wantErr: `operation "clamp" requires minimum or maximum in the schema`,
+		},
+		{
+			name:    "roundTo without multipleOf",
+			schema:  schemaWith(`{"type": "integer", "x-kfs-merge": {"strategy": "numeric", "roundTo": "up"}}`),
+			wantErr: "roundTo requires multipleOf in the rule or the schema",
+		},
+		{
+			name:    "unknown roundTo",
+			schema:  schemaWith(`{"type": "integer", "x-kfs-merge": {"strategy": "numeric", "multipleOf": 2, "roundTo": "even"}}`),
+			wantErr: `unknown roundTo mode "even"`,
+		},
+		{
+			name:    "non-positive multipleOf",
+			schema:  schemaWith(`{"type": "integer", "x-kfs-merge": {"strategy": "numeric", "multipleOf": 0}}`),
+			wantErr: "multipleOf must be positive, got 0",
+		},
+		{
+			name:    "multipleOf without numeric strategy",
+			schema:  schemaWith(`{"type": "integer", "x-kfs-merge": {"strategy": "replace", "multipleOf": 2}}`),
+			wantErr: `multipleOf and roundTo require strategy "numeric"`,
+		},
+		{
+			name:    "semver on number",
+			schema:  schemaWith(`{"type": "integer", "x-kfs-merge": {"strategy": "semver"}}`),
+			wantErr: `strategy "semver" requires a string or object schema, got integer`,
+		},
+		{
+			name:    "invalid semver constraint",
+			schema:  schemaWith(`{"type": "string", "x-kfs-merge": {"strategy": "semver", "constraint": "^two"}}`),
+			wantErr: `invalid semver constraint "^two": "two" is not a version`,
+		},
+		{
+			name:    "satisfies without constraint",
+			schema:  schemaWith(`{"type": "string", "x-kfs-merge": {"strategy": "semver", "operation": "satisfies"}}`),
+			wantErr: `operation "satisfies" requires a constraint`,
+		},
+		{
+			name:    "constraint without semver strategy",
+			schema:  schemaWith(`{"type": "string", "x-kfs-merge": {"strategy": "replace", "constraint": "^1.0.0"}}`),
+			wantErr: `constraint and versionField require strategy "semver"`,
+		},
+		{
+			name:    "mapKeys without deepMerge strategy",
+			schema:  schemaWith(`{"type": "object", "x-kfs-merge": {"strategy": "shallowMerge", "mapKeys": "replace"}}`),
+			wantErr: `mapKeys requires strategy "deepMerge"`,
+		},
+		{
+			name:    "temporal without format",
+			schema:  schemaWith(`{"type": "string", "x-kfs-merge": {"strategy": "temporal"}}`),
+			wantErr: `strategy "temporal" requires format "date-time" or "duration", got ""`,
+		},
+		{
+			name:    "temporal operation unsupported by format",
+			schema:  schemaWith(`{"type": "string", "format": "date-time", "x-kfs-merge": {"strategy": "temporal", "operation": "sum"}}`),
+			wantErr: `operation "sum" is not supported for format "date-time", want one of max, min, earliest, latest`,
+		},
+		{
+			name:    "temporal on boolean",
+			schema:  schemaWith(`{"type": "boolean", "x-kfs-merge": {"strategy": "temporal"}}`),
+			wantErr: `strategy "temporal" requires a string or number schema, got boolean`,
+		},
+		{
+			name:    "temporal number without format",
+			schema:  schemaWith(`{"type": "number", "x-kfs-merge": {"strategy": "temporal", "operation": "sum"}}`),
+			wantErr: `strategy "temporal" requires format "date-time" or "duration", got ""`,
+		},
+		{
+			name:    "temporal seconds with date-time operation",
+			schema:  schemaWith(`{"type": "number", "format": "duration", "x-kfs-merge": {"strategy": "temporal", "operation": "earliest"}}`),
+			wantErr: `operation "earliest" is not supported for format "duration", want one of max, min, sum`,
+		},
+		{
+			name:    "quantity without unit",
+			schema:  schemaWith(`{"type": "string", "x-kfs-merge": {"strategy": "quantity"}}`),
+			wantErr: `strategy "quantity" requires unit`,
+		},
+		{
+			name:    "quantity with unknown canonical unit",
+			schema:  schemaWith(`{"type": "string", "x-kfs-merge": {"strategy": "quantity", "unit": "bitrate", "canonicalUnit": "MB"}}`),
+			wantErr: `unknown bitrate unit "MB"`,
+		},
+		{
+			name:    "quantity on object",
+			schema:  schemaWith(`{"type": "object", "x-kfs-merge": {"strategy": "quantity", "unit": "bytes"}}`),
+			wantErr: `strategy "quantity" requires a string or number schema, got object`,
+		},
+		{
+			name:    "unit without quantity strategy",
+			schema:  schemaWith(`{"type": "string", "x-kfs-merge": {"strategy": "replace", "unit": "bytes"}}`),
+			wantErr: `unit and canonicalUnit require strategy "quantity"`,
+		},
+		{
+			name:    "stringJoin on array",
+			schema:  schemaWith(`{"type": "array", "x-kfs-merge": {"strategy": "stringJoin"}}`),
+			wantErr: `strategy "stringJoin" requires a string schema, got array`,
+		},
+		{
+			name:    "separator without stringJoin strategy",
+			schema:  schemaWith(`{"type": "string", "x-kfs-merge": {"strategy": "replace", "separator": ","}}`),
+			wantErr: `separator, order and mode require strategy "stringJoin"`,
+		},
+		{
+			name:    "order in prefix mode",
+			schema:  schemaWith(`{"type": "string", "x-kfs-merge": {"strategy": "stringJoin", "mode": "prefix", "order": "requestFirst"}}`),
+			wantErr: `order is not supported in mode "prefix"`,
+		},
+		{
+			name:    "unique without separator",
+			schema:  schemaWith(`{"type": "string", "x-kfs-merge": {"strategy": "stringJoin", "separator": "", "unique": true}}`),
+			wantErr: `unique requires a non-empty separator`,
+		},
+		{
+			name:    "operation without numeric strategy",
+			schema:  schemaWith(`{"type": "array", "x-kfs-merge": {"strategy": "concat", "operation": "sum"}}`),
+			wantErr: `operation is not supported by strategy "concat"`,
+		},
+		{
+			name:    "concat on object",
+			schema:  schemaWith(`{"type": "object", "x-kfs-merge": {"strategy": "concat"}}`),
+			wantErr: `strategy "concat" requires an array schema, got object`,
+		},
+		{
+			name:    "when clause checked against the field",
+			schema:  schemaWith(`{"type": "string", "x-kfs-merge": {"when": [{"if": {"exists": {"path": "/x"}}, "then": {"strategy": "numeric"}}]}}`),
+			wantErr: `when[0].then: strategy "numeric" requires a number schema`,
+		},
+		{
+			name: "byDiscriminator rule checked against items",
+			schema: schemaWith(`{"type": "array", "items": {"type": "object"}, "x-kfs-merge": {
+				"strategy": "mergeByDiscriminator", "discriminatorField": "kind",
+				"byDiscriminator": {"crop": {"strategy": "concat"}}
+			}}`),
+			wantErr: `byDiscriminator "crop": strategy "concat" requires an array schema`,
+		},
+		{
+			name:    "annotation in $defs",
+			schema:  `{"type": "object", "$defs": {"Tags": {"type": "object", "x-kfs-merge": {"strategy": "concat"}}}}`,
+			wantErr: `#/$defs/Tags/x-kfs-merge: strategy "concat"`,
+		},
+		{
+			name:    "annotation in referenced document",
+			schema:  schemaWith(`{"$ref": "common.json#/$defs/Count"}`),
+			opts:    []LoadOption{WithResource("common.json", []byte(`{"$defs": {"Count": {"type": "integer", "x-kfs-merge": {"strategy": "concat"}}}}`))},
+			wantErr: `common.json#/$defs/Count/x-kfs-merge: strategy "concat" requires an array schema, got integer`,
+		},
+		{
+			name:    "unknown global key",
+			schema:  `{"type": "object", "x-kfs-merge": {"strategy": "concat"}}`,
+			wantErr: `#/x-kfs-merge: unknown key "strategy"`,
+		},
+		{
+			name:    "unknown global strategy",
+			schema:  `{"type": "object", "x-kfs-merge": {"arrayStrategy": "append"}}`,
+			wantErr: `#/x-kfs-merge: unknown arrayStrategy "append"`,
+		},
+		{
+			name:   "numeric on nullable number",
+			schema: schemaWith(`{"anyOf": [{"type": "number"}, {"type": "null"}], "x-kfs-merge": {"strategy": "numeric", "operation": "max"}}`),
+		},
+		{
+			name: "discriminatorField on union",
+			schema: schemaWith(`{"x-kfs-merge": {"discriminatorField": "kind"}, "oneOf": [
+				{"type": "object", "properties": {"kind": {"const": "s3"}}},
+				{"type": "object", "properties": {"kind": {"const": "gcs"}}}
+			]}`),
+		},
+		{
+			name: "discriminatorField on typed union",
+			schema: schemaWith(`{"type": "object", "x-kfs-merge": {"discriminatorField": "kind"}, "anyOf": [
+				{"properties": {"kind": {"const": "s3"}}},
+				{"properties": {"kind": {"const": "gcs"}}}
+			]}`),
+		},
+		{
+			name:   "untyped field is not checked",
+			schema: schemaWith(`{"x-kfs-merge": {"strategy": "concat"}}`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadSchema([]byte(tt.schema), tt.opts...)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadSchema failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestLoadSchemaUnionDiscriminatorField tests that the union example of the
+// README loads and merges by its declared discriminatorField.
+func TestLoadSchemaUnionDiscriminatorField(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"properties": {
+			"storage": {
+				"type": "object",
+				"x-kfs-merge": {"discriminatorField": "kind"},
+				"oneOf": [
+					{"type": "object", "properties": {"kind": {"const": "s3"}, "bucket": {"type": "string"}}},
+					{"type": "object", "properties": {"kind": {"const": "gcs"}, "project": {"type": "string"}}}
+				]
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	result, err := s.Merge([]byte(`{"storage": {"kind": "gcs", "project": "p"}}`), []byte(`{"storage": {"kind": "s3", "bucket": "b"}}`))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"storage": {"kind": "gcs", "project": "p"}}`)
+}
+
+// compileMetaSchema compiles the x-kfs-merge meta-schema.
+func compileMetaSchema(t *testing.T) *jsonschema.Schema {
+	t.Helper()
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(MetaSchema()))
+	if err != nil {
+		t.Fatalf("failed to parse meta-schema: %v", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("x-kfs-merge.schema.json", doc); err != nil {
+		t.Fatalf("failed to add meta-schema: %v", err)
+	}
+	compiled, err := compiler.Compile("x-kfs-merge.schema.json")
+	if err != nil {
+		t.Fatalf("failed to compile meta-schema: %v", err)
+	}
+	return compiled
+}
+
+// TestMetaSchema tests the meta-schema against annotated schemas.
+func TestMetaSchema(t *testing.T) {
+	meta := compileMetaSchema(t)
+
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr bool
+	}{
+		{
+			name: "valid rules",
+			schema: `{
+				"type": "object",
+				"x-kfs-merge": {"arrayStrategy": "concat"},
+				"properties": {
+					"filters": {"type": "array", "x-kfs-merge": {
+						"strategy": "mergeByDiscriminator", "discriminatorField": "type",
+						"byDiscriminator": {"crop": {"strategy": "replace"}}
+					}},
+					"retries": {"x-kfs-merge": {"strategy": "numeric", "operation": "max", "when": [
+						{"if": {"equals": {"path": "/mode", "doc": "a", "value": "fast"}}, "then": {"strategy": "keepRequest"}}
+					]}}
+				},
+				"$defs": {"Tags": {"items": {"x-kfs-merge": {"nullHandling": "asAbsent"}}}}
+			}`,
+		},
+		{name: "unknown strategy", schema: `{"properties": {"a": {"x-kfs-merge": {"strategy": "overlay"}}}}`, wantErr: true},
+		{name: "unknown key in $defs", schema: `{"$defs": {"A": {"x-kfs-merge": {"mergeKey": "id"}}}}`, wantErr: true},
+		{name: "operation without numeric", schema: `{"properties": {"a": {"x-kfs-merge": {"operation": "sum"}}}}`, wantErr: true},
+		{name: "nested when", schema: `{"properties": {"a": {"x-kfs-merge": {"when": [{"if": {"exists": {"path": "/a"}}, "then": {"when": []}}]}}}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := jsonschema.UnmarshalJSON(strings.NewReader(tt.schema))
+			if err != nil {
+				t.Fatalf("failed to parse schema: %v", err)
+			}
+			err = meta.Validate(doc)
+			if tt.wantErr && err == nil {
+				t.Fatal("expected meta-schema validation error, got nil")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("meta-schema validation failed: %v", err)
+			}
+		})
+	}
+
+	for _, path := range []string{"../examples/schema.json", "../examples/kfs_media_schema.json"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", path, err)
+		}
+		if err := meta.Validate(doc); err != nil {
+			t.Errorf("%s does not validate against the meta-schema: %v", path, err)
+		}
+	}
+}
+
+// TestMetaSchemaMatchesStrategies tests that the meta-schema lists the strategies and operations LoadSchema accepts.
+func TestMetaSchemaMatchesStrategies(t *testing.T) {
+	var meta struct {
+		Defs struct {
+			Strategy struct {
+				Enum []string `json:"enum"`
+			} `json:"strategy"`
+			FieldRule struct {
+				Properties struct {
+					Operation struct {
+						Enum []string `json:"enum"`
+					} `json:"operation"`
+				} `json:"properties"`
+			} `json:"fieldRule"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(MetaSchema(), &meta); err != nil {
+		t.Fatalf("failed to parse meta-schema: %v", err)
+	}
+
+	var known []string
+	for strategy := range strategies {
+		known = append(known, string(strategy))
+	}
+	var operations []string
+	for _, ops := range strategyOperations {
+		operations = append(operations, ops...)
+	}
+
+	for _, pair := range []struct {
+		name      string
+		got, want []string
+	}{
+		{"strategies", meta.Defs.Strategy.Enum, known},
+		{"operations", meta.Defs.FieldRule.Properties.Operation.Enum, operations},
+	} {
+		got, want := uniqueSorted(pair.got), uniqueSorted(pair.want)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("meta-schema %s = %v, want %v", pair.name, got, want)
+		}
+	}
+}
+
+// uniqueSorted returns the distinct values in order.
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,165 @@
+package kfsmerge
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// External and Cross-File $ref Tests
+// =============================================================================
+
+// writeSchemaFiles writes schema documents into a temporary directory and
+// returns the directory.
+func writeSchemaFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+// TestLoadSchemaFromFileRelativeRefs tests a schema split into several files.
+func TestLoadSchemaFromFileRelativeRefs(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"job.json": `{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"type": "object",
+			"x-kfs-merge": {"applyDefaults": true},
+			"properties": {
+				"audio": {"$ref": "media/audio.json"},
+				"video": {"$ref": "media/video.json#/$defs/Video"}
+			}
+		}`,
+		"media/audio.json": `{
+			"type": "object",
+			"properties": {
+				"codec": {"type": "string", "default": "aac"},
+				"tracks": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat", "unique": true}}
+			}
+		}`,
+		"media/video.json": `{
+			"$defs": {
+				"Video": {
+					"type": "object",
+					"properties": {
+						"bitrate": {"$ref": "../common.json#/$defs/Limit"},
+						"preset": {"type": "string", "x-kfs-merge": {"strategy": "keepBase"}}
+					}
+				}
+			}
+		}`,
+		"common.json": `{
+			"$defs": {
+				"Limit": {"type": "integer", "minimum": 0, "x-kfs-merge": {"strategy": "numeric", "operation": "min"}}
+			}
+		}`,
+	})
+
+	s, err := LoadSchemaFromFile(filepath.Join(dir, "job.json"))
+	if err != nil {
+		t.Fatalf("LoadSchemaFromFile failed: %v", err)
+	}
+
+	a := []byte(`{"audio": {"tracks": ["en", "fr"]}, "video": {"bitrate": 8000, "preset": "fast"}}`)
+	b := []byte(`{"audio": {"tracks": ["en"]}, "video": {"bitrate": 5000, "preset": "slow"}}`)
+
+	result, err := s.Merge(a, b)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{
+		"audio": {"codec": "aac", "tracks": ["en", "fr"]},
+		"video": {"bitrate": 5000, "preset": "slow"}
+	}`)
+
+	// Validation follows the referenced files as well.
+	if _, err := s.Merge([]byte(`{"video": {"bitrate": -1}}`), []byte(`{}`)); err == nil {
+		t.Error("expected validation error for bitrate below the referenced minimum, got nil")
+	}
+}
+
+// TestLoadSchemaIDRefs tests references to documents identified by $id.
+func TestLoadSchemaIDRefs(t *testing.T) {
+	common := []byte(`{
+		"$id": "https://schemas.example.com/kfs/common.json",
+		"$defs": {
+			"Tags": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat"}},
+			"Region": {"$anchor": "region", "type": "string", "x-kfs-merge": {"strategy": "keepBase"}}
+		}
+	}`)
+
+	s, err := LoadSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id": "https://schemas.example.com/kfs/job.json",
+		"type": "object",
+		"properties": {
+			"tags": {"$ref": "common.json#/$defs/Tags"},
+			"region": {"$ref": "https://schemas.example.com/kfs/common.json#region"}
+		}
+	}`), WithResource("bundle/common.json", common))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	result, err := s.Merge([]byte(`{"tags": ["a"], "region": "eu"}`), []byte(`{"tags": ["b"], "region": "us"}`))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"tags": ["b", "a"], "region": "us"}`)
+}
+
+// TestLoadSchemaPointerRefs tests JSON-pointer references to locations outside $defs.
+func TestLoadSchemaPointerRefs(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"primary": {
+				"type": "object",
+				"properties": {
+					"hosts": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat", "unique": true}},
+					"port": {"type": "integer", "x-kfs-merge": {"strategy": "keepBase"}}
+				}
+			},
+			"secondary": {"$ref": "#/properties/primary"},
+			"ports": {"type": "array", "items": {"$ref": "#/properties/primary/properties/port"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	result, err := s.Merge(
+		[]byte(`{"secondary": {"hosts": ["b", "c"], "port": 9090}}`),
+		[]byte(`{"secondary": {"hosts": ["a", "b"], "port": 8080}}`),
+	)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"secondary": {"hosts": ["a", "b", "c"], "port": 8080}}`)
+}
+
+// TestLoadSchemaUnresolvedRef tests that missing referenced documents are load errors.
+func TestLoadSchemaUnresolvedRef(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"job.json": `{"type": "object", "properties": {"audio": {"$ref": "missing.json"}}}`,
+	})
+
+	_, err := LoadSchemaFromFile(filepath.Join(dir, "job.json"))
+	if err == nil {
+		t.Fatal("expected error for missing referenced schema, got nil")
+	}
+	if !strings.Contains(err.Error(), "missing.json") {
+		t.Errorf("error = %q, want it to name missing.json", err.Error())
+	}
+}
@@ -0,0 +1,155 @@
+package kfsmerge
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// Lint Tests
+// =============================================================================
+
+// TestSchemaLint tests the warnings Lint reports for each check.
+func TestSchemaLint(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   []string // "pointer code"
+	}{
+		{
+			name: "array of identified objects without discriminator",
+			schema: `{
+				"type": "object",
+				"properties": {
+					"outputs": {"type": "array", "items": {"type": "object", "properties": {"name": {"type": "string"}}}},
+					"merged": {
+						"type": "array",
+						"items": {"type": "object", "properties": {"id": {"type": "string"}}},
+						"x-kfs-merge": {"strategy": "mergeByDiscriminator", "discriminatorField": "id"}
+					},
+					"tags": {"type": "array", "items": {"type": "string"}}
+				}
+			}`,
+			want: []string{"#/properties/outputs missing-discriminator"},
+		},
+		{
+			name: "keepRequest on required field with default",
+			schema: `{
+				"type": "object",
+				"required": ["mode"],
+				"properties": {
+					"mode": {"type": "string", "default": "fast", "x-kfs-merge": {"strategy": "keepRequest"}},
+					"level": {"type": "integer", "default": 1, "x-kfs-merge": {"strategy": "keepRequest"}}
+				}
+			}`,
+			want: []string{"#/properties/mode keeprequest-required-default"},
+		},
+		{
+			name: "nullHandling on field that cannot be null",
+			schema: `{
+				"type": "object",
+				"properties": {
+					"name": {"type": "string", "x-kfs-merge": {"nullHandling": "asAbsent"}},
+					"note": {"type": ["string", "null"], "x-kfs-merge": {"nullHandling": "asAbsent"}},
+					"any": {"x-kfs-merge": {"nullHandling": "preserve"}}
+				}
+			}`,
+			want: []string{"#/properties/name nullhandling-not-nullable"},
+		},
+		{
+			name: "rules in unreferenced definition",
+			schema: `{
+				"type": "object",
+				"properties": {"used": {"$ref": "#/$defs/Used"}},
+				"$defs": {
+					"Used": {"type": "array", "x-kfs-merge": {"strategy": "concat"}},
+					"Unused": {"type": "array", "x-kfs-merge": {"strategy": "concat"}},
+					"Plain": {"type": "string"}
+				}
+			}`,
+			want: []string{"#/$defs/Unused unused-def-rules"},
+		},
+		{
+			name: "field rule shadowed by definition rule",
+			schema: `{
+				"type": "object",
+				"properties": {
+					"tags": {"allOf": [
+						{"$ref": "#/$defs/Tags"},
+						{"x-kfs-merge": {"strategy": "replace"}}
+					]}
+				},
+				"$defs": {"Tags": {"type": "array", "x-kfs-merge": {"strategy": "concat"}}}
+			}`,
+			want: []string{"#/properties/tags/allOf/1 shadowed-rule"},
+		},
+		{
+			name: "clean schema",
+			schema: `{
+				"type": "object",
+				"properties": {
+					"name": {"type": "string"},
+					"tags": {"$ref": "#/$defs/Tags", "x-kfs-merge": {"strategy": "replace"}}
+				},
+				"$defs": {"Tags": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat"}}}
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("LoadSchema failed: %v", err)
+			}
+			var got []string
+			for _, w := range s.Lint() {
+				got = append(got, w.Pointer+" "+w.Code)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLintFixRules tests that suggested fixes applied as rules clear the warnings.
+func TestLintFixRules(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"properties": {
+			"filters": {"type": "array", "items": {"$ref": "#/$defs/Filter"}}
+		},
+		"$defs": {
+			"Filter": {
+				"type": "object",
+				"properties": {"type": {"type": "string"}, "name": {"type": "string"}}
+			}
+		}
+	}`)
+
+	s, err := LoadSchema(schema)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+	warnings := s.Lint()
+	if len(warnings) != 1 || !strings.Contains(warnings[0].String(), `"name" property`) {
+		t.Fatalf("Lint() = %v, want one missing-discriminator warning for name", warnings)
+	}
+
+	rules, err := json.Marshal(LintFixRules(warnings))
+	if err != nil {
+		t.Fatalf("failed to encode rules: %v", err)
+	}
+	assertJSONEqualString(t, rules, `{"#/properties/filters": {"strategy": "mergeByDiscriminator", "discriminatorField": "name"}}`)
+
+	fixed, err := LoadSchema(schema, WithRules(rules))
+	if err != nil {
+		t.Fatalf("LoadSchema with fixes failed: %v", err)
+	}
+	if warnings := fixed.Lint(); len(warnings) != 0 {
+		t.Errorf("Lint() after fix = %v, want none", warnings)
+	}
+}
@@ -0,0 +1,302 @@
+package kfsmerge
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// =============================================================================
+// Schema Loader Tests
+// =============================================================================
+
+const loaderJobSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"properties": {
+		"tags": {"$ref": "common.json#/$defs/Tags"}
+	}
+}`
+
+const loaderCommonSchema = `{
+	"$defs": {
+		"Tags": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat"}}
+	}
+}`
+
+// assertLoaderSchemaMerges checks that the concat rule from common.json applies.
+func assertLoaderSchemaMerges(t *testing.T, s *Schema) {
+	t.Helper()
+	result, err := s.Merge([]byte(`{"tags": ["a"]}`), []byte(`{"tags": ["b"]}`))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"tags": ["b", "a"]}`)
+}
+
+// TestLoadSchemaWithLoader tests loading a schema and its references through each built-in loader.
+func TestLoadSchemaWithLoader(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"schemas/job.json":    loaderJobSchema,
+		"schemas/common.json": loaderCommonSchema,
+	})
+
+	tests := []struct {
+		name   string
+		uri    string
+		loader Loader
+	}{
+		{
+			name:   "map",
+			uri:    "job.json",
+			loader: MapLoader{"job.json": []byte(loaderJobSchema), "common.json": []byte(loaderCommonSchema)},
+		},
+		{
+			name: "fs.FS",
+			uri:  "schemas/job.json",
+			loader: NewFSLoader(fstest.MapFS{
+				"schemas/job.json":    {Data: []byte(loaderJobSchema)},
+				"schemas/common.json": {Data: []byte(loaderCommonSchema)},
+			}),
+		},
+		{
+			name:   "directory",
+			uri:    "job.json",
+			loader: NewDirLoader(dir + "/schemas"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadSchemaWithLoader(context.Background(), tt.uri, tt.loader)
+			if err != nil {
+				t.Fatalf("LoadSchemaWithLoader failed: %v", err)
+			}
+			assertLoaderSchemaMerges(t, s)
+		})
+	}
+}
+
+// TestDirLoaderRejectsEscapes tests that references cannot leave the loader's directory.
+func TestDirLoaderRejectsEscapes(t *testing.T) {
+	dir := writeSchemaFiles(t, map[string]string{
+		"common.json":      loaderCommonSchema,
+		"schemas/job.json": strings.Replace(loaderJobSchema, "common.json", "../common.json", 1),
+	})
+
+	if _, err := LoadSchemaWithLoader(context.Background(), "job.json", NewDirLoader(dir+"/schemas")); err == nil {
+		t.Fatal("expected error for reference outside the directory, got nil")
+	}
+}
+
+// TestHTTPLoader tests fetching schemas over HTTP with references, caching and limits.
+func TestHTTPLoader(t *testing.T) {
+	var requests, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/schemas/job.json":
+			w.Header().Set("ETag", `"job-v1"`)
+			if r.Header.Get("If-None-Match") == `"job-v1"` {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte(loaderJobSchema))
+		case "/schemas/common.json":
+			w.Write([]byte(loaderCommonSchema))
+		case "/large.json":
+			w.Write([]byte(`{"description": "` + strings.Repeat("x", 1024) + `"}`))
+		case "/slow.json":
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`{}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse server URL: %v", err)
+	}
+	host := serverURL.Hostname()
+	ctx := context.Background()
+
+	t.Run("references and ETag cache", func(t *testing.T) {
+		loader := &HTTPLoader{AllowedHosts: []string{host}, CacheDir: t.TempDir()}
+		for i := 0; i < 2; i++ {
+			s, err := LoadSchemaWithLoader(ctx, server.URL+"/schemas/job.json", loader)
+			if err != nil {
+				t.Fatalf("LoadSchemaWithLoader failed: %v", err)
+			}
+			assertLoaderSchemaMerges(t, s)
+		}
+		if notModified.Load() != 1 {
+			t.Errorf("revalidated requests = %d, want 1", notModified.Load())
+		}
+	})
+
+	t.Run("host not allowed", func(t *testing.T) {
+		loader := &HTTPLoader{AllowedHosts: []string{"schemas.example.com"}}
+		before := requests.Load()
+		_, err := loader.Load(ctx, server.URL+"/schemas/job.json")
+		if err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Fatalf("error = %v, want host not allowed", err)
+		}
+		if requests.Load() != before {
+			t.Error("request was sent to a host that is not allowed")
+		}
+	})
+
+	t.Run("redirect to host not allowed", func(t *testing.T) {
+		var redirected atomic.Int32
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			redirected.Add(1)
+			w.Write([]byte(loaderCommonSchema))
+		}))
+		defer target.Close()
+		targetURL := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+		redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, targetURL+r.URL.Path, http.StatusFound)
+		}))
+		defer redirector.Close()
+
+		clients := map[string]*http.Client{"default client": nil, "caller client": {Timeout: time.Second}}
+		for name, client := range clients {
+			loader := &HTTPLoader{Client: client, AllowedHosts: []string{host}}
+			_, err := loader.Load(ctx, redirector.URL+"/common.json")
+			if err == nil || !strings.Contains(err.Error(), `redirect to host "localhost" is not allowed`) {
+				t.Errorf("%s: error = %v, want redirect not allowed", name, err)
+			}
+		}
+		if redirected.Load() != 0 {
+			t.Error("redirect was followed to a host that is not allowed")
+		}
+
+		loader := &HTTPLoader{AllowedHosts: []string{host, "localhost"}}
+		if _, err := loader.Load(ctx, redirector.URL+"/common.json"); err != nil {
+			t.Errorf("Load through allowed redirect failed: %v", err)
+		}
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		loader := &HTTPLoader{MaxBodyBytes: 512}
+		_, err := loader.Load(ctx, server.URL+"/large.json")
+		if err == nil || !strings.Contains(err.Error(), "exceeds 512 bytes") {
+			t.Fatalf("error = %v, want size limit error", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		loader := &HTTPLoader{Timeout: 20 * time.Millisecond}
+		if _, err := loader.Load(ctx, server.URL+"/slow.json"); err == nil {
+			t.Fatal("expected timeout error, got nil")
+		}
+	})
+}
+
+// TestHTTPLoaderOfflineCache tests that cached documents are used when the
+// server cannot be reached, whether or not they were served with an ETag.
+func TestHTTPLoaderOfflineCache(t *testing.T) {
+	for name, etag := range map[string]string{"with ETag": `"common-v1"`, "without ETag": ""} {
+		t.Run(name, func(t *testing.T) {
+			var revalidated atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("If-None-Match") != "" {
+					revalidated.Add(1)
+				}
+				if etag != "" {
+					w.Header().Set("ETag", etag)
+				}
+				w.Write([]byte(loaderCommonSchema))
+			}))
+			uri := server.URL + "/common.json"
+			ctx := context.Background()
+
+			loader := &HTTPLoader{CacheDir: t.TempDir()}
+			for i := 0; i < 2; i++ {
+				if _, err := loader.Load(ctx, uri); err != nil {
+					t.Fatalf("Load failed: %v", err)
+				}
+			}
+			if want := map[bool]int32{true: 1, false: 0}[etag != ""]; revalidated.Load() != want {
+				t.Errorf("revalidated requests = %d, want %d", revalidated.Load(), want)
+			}
+			server.Close()
+
+			data, err := loader.Load(ctx, uri)
+			if err != nil {
+				t.Fatalf("Load from cache failed: %v", err)
+			}
+			if string(data) != loaderCommonSchema {
+				t.Errorf("Load = %s, want the cached document", data)
+			}
+
+			uncached := &HTTPLoader{CacheDir: t.TempDir()}
+			if _, err := uncached.Load(ctx, uri); err == nil || !strings.Contains(err.Error(), "failed to fetch schema from URL") {
+				t.Errorf("Load error = %v, want fetch failure", err)
+			}
+		})
+	}
+}
+
+// TestLoadSchemaOffline tests that LoadSchema only fetches documents through an explicit loader.
+func TestLoadSchemaOffline(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(loaderCommonSchema))
+	}))
+	defer server.Close()
+
+	dir := writeSchemaFiles(t, map[string]string{"common.json": loaderCommonSchema})
+	fileSchema := strings.Replace(loaderJobSchema, "common.json", fileURI(filepath.ToSlash(dir))+"/common.json", 1)
+	httpSchema := strings.Replace(loaderJobSchema, "common.json", server.URL+"/common.json", 1)
+
+	for name, schema := range map[string]string{"file": fileSchema, "http": httpSchema} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadSchema([]byte(schema)); err == nil || !strings.Contains(err.Error(), "WithLoader") {
+				t.Errorf("LoadSchema error = %v, want external reference error", err)
+			}
+		})
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("server received %d requests, want 0", n)
+	}
+
+	t.Run("file source", func(t *testing.T) {
+		path := writeSchemaFiles(t, map[string]string{"job.json": httpSchema})
+		if _, err := LoadSchemaFromFile(filepath.Join(path, "job.json")); err == nil {
+			t.Error("LoadSchemaFromFile followed an http reference without a loader")
+		}
+		s, err := LoadSchemaFromFile(filepath.Join(path, "job.json"), WithLoader(&HTTPLoader{}))
+		if err != nil {
+			t.Fatalf("LoadSchemaFromFile failed: %v", err)
+		}
+		assertLoaderSchemaMerges(t, s)
+	})
+
+	t.Run("with loader", func(t *testing.T) {
+		s, err := LoadSchema([]byte(httpSchema), WithLoader(&HTTPLoader{}))
+		if err != nil {
+			t.Fatalf("LoadSchema failed: %v", err)
+		}
+		assertLoaderSchemaMerges(t, s)
+	})
+
+	t.Run("with resource", func(t *testing.T) {
+		s, err := LoadSchema([]byte(loaderJobSchema), WithResource("common.json", []byte(loaderCommonSchema)))
+		if err != nil {
+			t.Fatalf("LoadSchema failed: %v", err)
+		}
+		assertLoaderSchemaMerges(t, s)
+	})
+}
@@ -0,0 +1,226 @@
+package kfsmerge
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// Recursive Schema Tests ($ref, $dynamicRef, $anchor)
+// =============================================================================
+
+// TestMergeRecursiveSchemas tests that rules of self-referential definitions
+// apply at every depth, however the recursion is referenced.
+func TestMergeRecursiveSchemas(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		atRoot bool // the recursive object is the document itself
+	}{
+		{
+			name: "$ref to $defs",
+			schema: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"type": "object",
+				"$defs": {
+					"FilterChain": {
+						"type": "object",
+						"properties": {
+							"filters": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat", "unique": true}},
+							"child": {"$ref": "#/$defs/FilterChain"}
+						}
+					}
+				},
+				"properties": {"chain": {"$ref": "#/$defs/FilterChain"}}
+			}`,
+		},
+		{
+			name: "$ref to $anchor",
+			schema: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"type": "object",
+				"$defs": {
+					"FilterChain": {
+						"$anchor": "chain",
+						"type": "object",
+						"properties": {
+							"filters": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat", "unique": true}},
+							"child": {"$ref": "#chain"}
+						}
+					}
+				},
+				"properties": {"chain": {"$ref": "#chain"}}
+			}`,
+		},
+		{
+			name: "$dynamicRef to $dynamicAnchor",
+			schema: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"type": "object",
+				"$defs": {
+					"FilterChain": {
+						"$dynamicAnchor": "chain",
+						"type": "object",
+						"properties": {
+							"filters": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat", "unique": true}},
+							"child": {"$dynamicRef": "#chain"}
+						}
+					}
+				},
+				"properties": {"chain": {"$ref": "#/$defs/FilterChain"}}
+			}`,
+		},
+		{
+			name: "$ref to the root",
+			schema: `{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"type": "object",
+				"properties": {
+					"filters": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat", "unique": true}},
+					"child": {"$ref": "#"}
+				}
+			}`,
+			atRoot: true,
+		},
+	}
+
+	a := `{"filters": ["scale"], "child": {"filters": ["crop"], "child": {"filters": ["pad", "fps"]}}}`
+	b := `{"filters": ["scale"], "child": {"filters": ["deint"], "child": {"filters": ["pad"]}}}`
+	expected := `{"filters": ["scale"], "child": {"filters": ["deint", "crop"], "child": {"filters": ["pad", "fps"]}}}`
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadSchema([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("LoadSchema failed: %v", err)
+			}
+
+			a, b, expected := a, b, expected
+			if !tt.atRoot {
+				a, b, expected = `{"chain": `+a+`}`, `{"chain": `+b+`}`, `{"chain": `+expected+`}`
+			}
+
+			result, err := s.Merge([]byte(a), []byte(b))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, expected)
+		})
+	}
+}
+
+// TestExtractDefaultsRecursiveSchema tests that default extraction terminates
+// on recursive schemas.
+func TestExtractDefaultsRecursiveSchema(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"x-kfs-merge": {"applyDefaults": true},
+		"$defs": {
+			"FilterChain": {
+				"type": "object",
+				"properties": {
+					"name": {"type": "string", "default": "main"},
+					"child": {"$ref": "#/$defs/FilterChain"}
+				}
+			}
+		},
+		"properties": {
+			"chain": {"$ref": "#/$defs/FilterChain"},
+			"again": {"$ref": "#"}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	result, err := s.Merge([]byte(`{}`), []byte(`{}`))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"chain": {"name": "main"}}`)
+}
+
+// TestFieldConfigRecursivePlan tests rule lookups at any depth of a recursive
+// schema, through chained $refs and map-like objects.
+func TestFieldConfigRecursivePlan(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"type": "object",
+		"$defs": {
+			"Node": {
+				"type": "object",
+				"properties": {
+					"name": {"type": "string", "x-kfs-merge": {"strategy": "keepBase", "nullHandling": "asAbsent"}},
+					"next": {"$ref": "#/$defs/Alias"},
+					"children": {"type": "object", "additionalProperties": {"$ref": "#/$defs/Node"}}
+				}
+			},
+			"Alias": {"$ref": "#/$defs/Node"}
+		},
+		"properties": {
+			"root": {"$ref": "#/$defs/Node"},
+			"name": {"type": "string", "x-kfs-merge": {"nullHandling": "asAbsent"}}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	deep := "/root" + strings.Repeat("/next/children/key", 20) + "/name"
+	tests := []struct {
+		path string
+		want MergeStrategy
+		ok   bool
+	}{
+		{"/root/name", StrategyKeepBase, true},
+		{deep, StrategyKeepBase, true},
+		{"/root/children/{additionalProperties}/name", StrategyKeepBase, true},
+		{"/root/children/name", "", false},
+		{"/name", "", true},
+		{"/other/name", "", false},
+	}
+	for _, tt := range tests {
+		config, ok := s.FieldConfig(tt.path)
+		if ok != tt.ok || config.Strategy != tt.want {
+			t.Errorf("FieldConfig(%q) = %+v, %v; want strategy %q, %v", tt.path, config, ok, tt.want, tt.ok)
+		}
+	}
+
+	if got := s.NullHandlingFor("/name"); got != NullAsAbsent {
+		t.Errorf("NullHandlingFor(/name) = %q, want %q", got, NullAsAbsent)
+	}
+}
+
+// TestMergeMaxDepth tests that merging beyond the maximum depth returns a MaxDepthError.
+func TestMergeMaxDepth(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$defs": {
+			"Node": {"type": "object", "properties": {"child": {"$ref": "#/$defs/Node"}}}
+		},
+		"$ref": "#/$defs/Node"
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	doc := `{"child": {"child": {"child": {"child": {"value": 1}}}}}`
+
+	t.Run("within limit", func(t *testing.T) {
+		if _, err := s.MergeWithOptions([]byte(doc), []byte(doc), MergeOptions{MaxDepth: 5}); err != nil {
+			t.Fatalf("Merge failed: %v", err)
+		}
+	})
+
+	t.Run("exceeds limit", func(t *testing.T) {
+		_, err := s.MergeWithOptions([]byte(doc), []byte(doc), MergeOptions{MaxDepth: 3})
+		var depthErr MaxDepthError
+		if !errors.As(err, &depthErr) {
+			t.Fatalf("expected MaxDepthError, got %v", err)
+		}
+		if depthErr.MaxDepth != 3 || !strings.HasPrefix(depthErr.Path, "/child/child/child/child") {
+			t.Errorf("MaxDepthError = %+v, want depth 3 below /child/child/child/child", depthErr)
+		}
+	})
+}
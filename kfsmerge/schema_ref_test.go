@@ -12,7 +12,7 @@ func TestMergeWithRefAndDefs(t *testing.T) {
 		"$defs": {
 			"ServerConfig": {
 				"type": "object",
-				"x-kfs-merge": {"strategy": "overlay"},
+				"x-kfs-merge": {"strategy": "deepMerge"},
 				"properties": {
 					"host": {"type": "string"},
 					"port": {"type": "integer"},
@@ -51,7 +51,7 @@ func TestMergeWithRefAndDefs(t *testing.T) {
 	}
 
 	primary := got["primary"].(map[string]any)
-	// overlay: A's port applied, B's host and timeout preserved
+	// deepMerge: A's port applied, B's host and timeout preserved
 	if primary["host"] != "primary.local" {
 		t.Errorf("primary.host = %v, want 'primary.local'", primary["host"])
 	}
@@ -194,3 +194,89 @@ func TestMergeWithAnyOfRef(t *testing.T) {
 	}
 }
 
+// TestMergeWithTransitiveRefConfig tests that rules declared on a definition
+// apply through any number of $ref hops between definitions.
+func TestMergeWithTransitiveRefConfig(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"$defs": {
+			"JobRequest": {
+				"type": "object",
+				"properties": {
+					"profile": {"$ref": "#/$defs/ProfileConfiguration"}
+				}
+			},
+			"ProfileConfiguration": {
+				"type": "object",
+				"properties": {
+					"rating": {"$ref": "#/$defs/RatingConfig"},
+					"limits": {"$ref": "#/$defs/Limits"}
+				}
+			},
+			"RatingConfig": {
+				"type": "object",
+				"properties": {
+					"systems": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat", "unique": true}}
+				}
+			},
+			"Limits": {"$ref": "#/$defs/PinnedLimits"},
+			"PinnedLimits": {
+				"type": "object",
+				"x-kfs-merge": {"strategy": "keepBase"}
+			}
+		},
+		"properties": {
+			"job": {"$ref": "#/$defs/JobRequest"}
+		}
+	}`)
+
+	s, err := LoadSchema(schemaJSON)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	a := []byte(`{"job": {"profile": {"rating": {"systems": ["mpaa", "bbfc"]}, "limits": {"max": 8}}}}`)
+	b := []byte(`{"job": {"profile": {"rating": {"systems": ["mpaa"]}, "limits": {"max": 4}}}}`)
+
+	result, err := s.Merge(a, b)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"job": {"profile": {"rating": {"systems": ["mpaa", "bbfc"]}, "limits": {"max": 4}}}}`)
+}
+
+// TestMergeWithSelfReferencingDef tests that rule resolution terminates on
+// definitions that reference themselves.
+func TestMergeWithSelfReferencingDef(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"$defs": {
+			"Node": {
+				"type": "object",
+				"properties": {
+					"tags": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat"}},
+					"child": {"$ref": "#/$defs/Node"}
+				}
+			}
+		},
+		"properties": {
+			"tree": {"$ref": "#/$defs/Node"}
+		}
+	}`)
+
+	s, err := LoadSchema(schemaJSON)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	a := []byte(`{"tree": {"child": {"child": {"tags": ["a"], "name": "request"}}}}`)
+	b := []byte(`{"tree": {"child": {"child": {"tags": ["b"], "name": "base"}}}}`)
+
+	result, err := s.Merge(a, b)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"tree": {"child": {"child": {"tags": ["b", "a"], "name": "request"}}}}`)
+}
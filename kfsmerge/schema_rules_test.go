@@ -0,0 +1,97 @@
+package kfsmerge
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// Rules Document Tests
+// =============================================================================
+
+// TestLoadSchemaWithRulesGenerated tests rules applied to the generated media schema.
+func TestLoadSchemaWithRulesGenerated(t *testing.T) {
+	data, err := os.ReadFile("../examples/kfs_media_schema.json")
+	if err != nil {
+		t.Fatalf("failed to read schema: %v", err)
+	}
+
+	s, err := LoadSchema(data, WithRules([]byte(`{
+		"#": {"arrayStrategy": "concat"},
+		"#/properties/job_vars": {"strategy": "keepBase"},
+		"ForcedKeyframesSettings": {"strategy": "replace"},
+		"/$defs/ForcedKeyframesSettings/properties/strategy": {"strategy": "keepBase"}
+	}`)))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	if s.GlobalConfig().ArrayStrategy != StrategyConcat {
+		t.Errorf("ArrayStrategy = %q, want %q", s.GlobalConfig().ArrayStrategy, StrategyConcat)
+	}
+	tests := []struct {
+		path string
+		want MergeStrategy
+	}{
+		{"/job_vars", StrategyKeepBase},
+		{"/forced_keyframes", StrategyReplace},
+		{"/forced_keyframes/strategy", StrategyKeepBase},
+	}
+	for _, tt := range tests {
+		config, ok := s.FieldConfig(tt.path)
+		if !ok || config.Strategy != tt.want {
+			t.Errorf("FieldConfig(%q) = %+v, %v; want strategy %q", tt.path, config, ok, tt.want)
+		}
+	}
+}
+
+// TestLoadSchemaWithRulesPrecedence tests that rules override inline annotations key by key.
+func TestLoadSchemaWithRulesPrecedence(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"type": "object",
+		"properties": {
+			"tags": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "replace", "unique": true}}
+		}
+	}`), WithRules([]byte(`{"/properties/tags": {"strategy": "concat"}}`)))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	result, err := s.Merge([]byte(`{"tags": ["a", "b"]}`), []byte(`{"tags": ["b", "c"]}`))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"tags": ["b", "c", "a"]}`)
+}
+
+// TestLoadSchemaWithRulesErrors tests that invalid rules documents are load errors.
+func TestLoadSchemaWithRulesErrors(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"properties": {"name": {"type": "string"}},
+		"$defs": {"Tag": {"type": "string"}}
+	}`)
+
+	tests := []struct {
+		name    string
+		rules   string
+		wantErr string
+	}{
+		{name: "invalid JSON", rules: `{`, wantErr: "failed to parse rules JSON"},
+		{name: "unknown pointer", rules: `{"#/properties/missing": {"strategy": "replace"}}`, wantErr: `rule target "#/properties/missing" is not a subschema`},
+		{name: "pointer to keyword", rules: `{"/properties": {"strategy": "replace"}}`, wantErr: `rule target "/properties" is not a subschema`},
+		{name: "unknown definition", rules: `{"Missing": {"strategy": "replace"}}`, wantErr: `rule target "Missing" is not a $defs entry`},
+		{name: "rule not an object", rules: `{"Tag": "keepBase"}`, wantErr: `rule for "Tag" must be an object`},
+		{name: "invalid rule", rules: `{"Tag": {"when": "always"}}`, wantErr: `rule for "Tag"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadSchema(schema, WithRules([]byte(tt.rules)))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
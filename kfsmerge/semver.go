@@ -0,0 +1,366 @@
+package kfsmerge
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version (https://semver.org). Build metadata
+// does not take part in comparisons.
+type semver struct {
+	major, minor, patch uint64
+	prerelease          []string
+}
+
+// parseSemver parses a semantic version, with an optional "v" prefix.
+func parseSemver(s string) (semver, error) {
+	var v semver
+	rest := strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		if !validIdentifiers(rest[i+1:], false) {
+			return v, fmt.Errorf("invalid build metadata in %q", s)
+		}
+		rest = rest[:i]
+	}
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		if !validIdentifiers(rest[i+1:], true) {
+			return v, fmt.Errorf("invalid prerelease in %q", s)
+		}
+		v.prerelease = strings.Split(rest[i+1:], ".")
+		rest = rest[:i]
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("%q is not a semantic version", s)
+	}
+	for i, field := range []*uint64{&v.major, &v.minor, &v.patch} {
+		n, ok := parseVersionNumber(parts[i])
+		if !ok {
+			return v, fmt.Errorf("%q is not a semantic version", s)
+		}
+		*field = n
+	}
+	return v, nil
+}
+
+// parseVersionNumber parses a numeric version field without leading zeros.
+func parseVersionNumber(s string) (uint64, bool) {
+	if s == "" || len(s) > 1 && s[0] == '0' {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	return n, err == nil
+}
+
+// validIdentifiers reports whether s is a dot-separated list of prerelease
+// or build identifiers. Numeric prerelease identifiers have no leading zeros.
+func validIdentifiers(s string, prerelease bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		numeric := true
+		for _, r := range id {
+			switch {
+			case r >= '0' && r <= '9':
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '-':
+				numeric = false
+			default:
+				return false
+			}
+		}
+		if prerelease && numeric && len(id) > 1 && id[0] == '0' {
+			return false
+		}
+	}
+	return true
+}
+
+// compare returns -1, 0 or 1 as v is lower than, equal to or higher than w
+// in semver precedence.
+func (v semver) compare(w semver) int {
+	for _, pair := range [][2]uint64{{v.major, w.major}, {v.minor, w.minor}, {v.patch, w.patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(v.prerelease) == 0 && len(w.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(w.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.prerelease) && i < len(w.prerelease); i++ {
+		if c := compareIdentifiers(v.prerelease[i], w.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.prerelease) < len(w.prerelease):
+		return -1
+	case len(v.prerelease) > len(w.prerelease):
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifiers compares prerelease identifiers: numeric identifiers
+// numerically and below alphanumeric ones, which compare in ASCII order.
+func compareIdentifiers(a, b string) int {
+	aNum, aErr := strconv.ParseUint(a, 10, 64)
+	bNum, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		switch {
+		case aNum < bNum:
+			return -1
+		case aNum > bNum:
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// semverConstraint is a version range: alternatives separated by "||", each
+// a list of comparisons that must all hold.
+type semverConstraint [][]semverComparison
+
+// semverComparison compares a version with a bound using op ("=", "<",
+// "<=", ">" or ">=").
+type semverComparison struct {
+	op    string
+	bound semver
+}
+
+// parseSemverConstraint parses a version range such as "^2.0.0",
+// "~1.4", ">=1.2.0 <2.0.0", "1.x" or "^1.0.0 || ^2.0.0". Caret and tilde
+// ranges follow npm: "^" allows changes that keep the leftmost non-zero
+// field, "~" allows patch changes (minor changes when only a major is given).
+// Ranges only allow prereleases they name, see semverConstraint.allows.
+func parseSemverConstraint(s string) (semverConstraint, error) {
+	var constraint semverConstraint
+	for _, alt := range strings.Split(s, "||") {
+		fields := strings.Fields(alt)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("invalid semver constraint %q: empty range", s)
+		}
+		var comparisons []semverComparison
+		for _, field := range fields {
+			parsed, err := parseSemverRange(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid semver constraint %q: %w", s, err)
+			}
+			comparisons = append(comparisons, parsed...)
+		}
+		constraint = append(constraint, comparisons)
+	}
+	return constraint, nil
+}
+
+// parseSemverRange parses one range term into comparisons.
+func parseSemverRange(term string) ([]semverComparison, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, prefix) {
+			op, term = prefix, term[len(prefix):]
+			break
+		}
+	}
+
+	// A partial version: missing or wildcard fields are free.
+	version := strings.TrimPrefix(term, "v")
+	var suffix string
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version, suffix = version[:i], version[i:]
+	}
+	var fields []uint64
+	for _, part := range strings.Split(version, ".") {
+		if part == "x" || part == "X" || part == "*" {
+			break
+		}
+		n, ok := parseVersionNumber(part)
+		if !ok {
+			return nil, fmt.Errorf("%q is not a version", term)
+		}
+		fields = append(fields, n)
+	}
+	if len(fields) > 3 || len(fields) < 3 && suffix != "" {
+		return nil, fmt.Errorf("%q is not a version", term)
+	}
+	if len(fields) == 0 {
+		if op == "<" || op == ">" {
+			return nil, fmt.Errorf("%q matches no version", op+term)
+		}
+		return nil, nil
+	}
+	lower := semver{major: fields[0]}
+	if len(fields) > 1 {
+		lower.minor = fields[1]
+	}
+	if len(fields) > 2 {
+		lower.patch = fields[2]
+	}
+	if suffix != "" {
+		v, err := parseSemver(version + suffix)
+		if err != nil {
+			return nil, err
+		}
+		lower = v
+	}
+
+	// next is the lowest version above a partial version's range: its lowest
+	// prerelease sorts below every other version with the same fields.
+	next := semver{major: lower.major + 1, prerelease: []string{"0"}}
+	if len(fields) == 2 {
+		next = semver{major: lower.major, minor: lower.minor + 1, prerelease: []string{"0"}}
+	}
+
+	switch op {
+	case "^":
+		upper := semver{patch: lower.patch + 1}
+		switch {
+		case lower.major > 0 || len(fields) == 1:
+			upper = semver{major: lower.major + 1}
+		case lower.minor > 0 || len(fields) == 2:
+			upper = semver{minor: lower.minor + 1}
+		}
+		upper.prerelease = []string{"0"}
+		return []semverComparison{{">=", lower}, {"<", upper}}, nil
+	case "~":
+		upper := next
+		if len(fields) == 3 {
+			upper = semver{major: lower.major, minor: lower.minor + 1, prerelease: []string{"0"}}
+		}
+		return []semverComparison{{">=", lower}, {"<", upper}}, nil
+	case ">=":
+		return []semverComparison{{">=", lower}}, nil
+	case "<":
+		return []semverComparison{{"<", lower}}, nil
+	case ">":
+		if len(fields) < 3 {
+			// Prereleases of next are outside the range, see allows.
+			return []semverComparison{{">=", semver{major: next.major, minor: next.minor}}}, nil
+		}
+		return []semverComparison{{">", lower}}, nil
+	case "<=":
+		if len(fields) < 3 {
+			return []semverComparison{{"<", next}}, nil
+		}
+		return []semverComparison{{"<=", lower}}, nil
+	}
+	if len(fields) < 3 {
+		return []semverComparison{{">=", lower}, {"<", next}}, nil
+	}
+	return []semverComparison{{"=", lower}}, nil
+}
+
+// allows reports whether version v is in the range. As in npm, a prerelease
+// is only in a range whose comparisons name a prerelease of the same major,
+// minor and patch version, so "^1.2.0" does not allow "1.3.0-beta".
+func (c semverConstraint) allows(v semver) bool {
+	for _, alt := range c {
+		ok := len(v.prerelease) == 0
+		for _, comparison := range alt {
+			if !comparison.holds(v) {
+				ok = false
+				break
+			}
+			bound := comparison.bound
+			if len(bound.prerelease) > 0 && bound.major == v.major && bound.minor == v.minor && bound.patch == v.patch {
+				ok = true
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// holds reports whether version v satisfies the comparison.
+func (c semverComparison) holds(v semver) bool {
+	cmp := v.compare(c.bound)
+	switch c.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return cmp == 0
+}
+
+// semverOperation resolves two versions: the higher (max) or lower (min)
+// of those within the constraint, or the first of A and B that satisfies it
+// (satisfies). Values are version strings, or objects such as array items
+// whose versionField holds the version.
+func (m *Merger) semverOperation(a, b any, path string, config FieldMergeConfig) (any, error) {
+	if a == nil && b == nil {
+		return nil, nil
+	}
+	constraint := config.constraint
+	if constraint == nil && config.Constraint != "" {
+		// A configuration not parsed from a schema.
+		var err error
+		if constraint, err = parseSemverConstraint(config.Constraint); err != nil {
+			return nil, fmt.Errorf("semver at %s: %w", path, err)
+		}
+	}
+
+	operation := config.OperationOrDefault()
+	var best any
+	var bestVersion semver
+	for _, value := range []any{a, b} {
+		if value == nil {
+			continue
+		}
+		v, err := versionOf(value, config.VersionFieldOrDefault())
+		if err != nil {
+			return nil, fmt.Errorf("semver at %s: %w", path, err)
+		}
+		if constraint != nil && !constraint.allows(v) {
+			continue
+		}
+		switch {
+		case best == nil,
+			operation == "max" && v.compare(bestVersion) > 0,
+			operation == "min" && v.compare(bestVersion) < 0:
+			best, bestVersion = value, v
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("semver at %s: no version satisfies %q", path, config.Constraint)
+	}
+	return best, nil
+}
+
+// versionOf returns the semantic version of a version string, or of the
+// field of an object that holds it.
+func versionOf(value any, field string) (semver, error) {
+	if obj, ok := value.(map[string]any); ok {
+		version, ok := obj[field].(string)
+		if !ok {
+			return semver{}, fmt.Errorf("object has no %q version string", field)
+		}
+		value = version
+	}
+	s, ok := value.(string)
+	if !ok {
+		return semver{}, fmt.Errorf("semver strategy requires version strings, got %s", jsonType(value))
+	}
+	return parseSemver(s)
+}
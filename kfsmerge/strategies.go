@@ -1,6 +1,13 @@
 package kfsmerge
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
 
 // concatArrays concatenates two arrays. If unique is true, removes duplicate primitive values.
 func (m *Merger) concatArrays(a, b any, unique bool) (any, error) {
@@ -40,8 +47,9 @@ func (m *Merger) deduplicateArray(arr []any) []any {
 	result := make([]any, 0, len(arr))
 	for _, item := range arr {
 		if isPrimitive(item) {
-			if !seen[item] {
-				seen[item] = true
+			key := numberKey(item)
+			if !seen[key] {
+				seen[key] = true
 				result = append(result, item)
 			}
 		} else {
@@ -52,69 +60,217 @@ func (m *Merger) deduplicateArray(arr []any) []any {
 	return result
 }
 
-// numericOperation performs numeric operations (sum, max, min) on two values.
-func (m *Merger) numericOperation(a, b any, operation string) (any, error) {
-	aNum, aOk := toFloat64(a)
-	bNum, bOk := toFloat64(b)
+// joinStrings joins two strings with the configured separator, skipping empty
+// ones. In prefix and suffix modes, A is placed at the start or end of B
+// unless B already has it there. If unique is set, repeated tokens are
+// dropped, keeping the first. A null in A wins like in any other conflict,
+// unless nullHandling treats it as absent.
+func (m *Merger) joinStrings(a, b any, path string, at planCursor, config FieldMergeConfig) (any, error) {
+	if a == nil {
+		return m.requestWins(a, b, at), nil
+	}
+	aStr, aOk := a.(string)
+	bStr, bOk := b.(string)
+	if !aOk || (!bOk && b != nil) {
+		return nil, fmt.Errorf("stringJoin at %s: stringJoin strategy requires strings", path)
+	}
+
+	separator := config.SeparatorOrDefault()
+	parts := []string{bStr, aStr}
+	switch config.ModeOrDefault() {
+	case JoinModePrefix:
+		parts = []string{aStr, bStr}
+		if bStr == aStr || strings.HasPrefix(bStr, aStr+separator) {
+			parts = []string{bStr}
+		}
+	case JoinModeSuffix:
+		if bStr == aStr || strings.HasSuffix(bStr, separator+aStr) {
+			parts = []string{bStr}
+		}
+	default:
+		if config.OrderOrDefault() == JoinRequestFirst {
+			parts = []string{aStr, bStr}
+		}
+	}
+
+	if config.UniqueOrDefault() {
+		var tokens []string
+		seen := make(map[string]bool)
+		for _, part := range parts {
+			for _, token := range strings.Split(part, separator) {
+				if token != "" && !seen[token] {
+					seen[token] = true
+					tokens = append(tokens, token)
+				}
+			}
+		}
+		return strings.Join(tokens, separator), nil
+	}
+	return strings.Join(slices.DeleteFunc(parts, func(part string) bool { return part == "" }), separator), nil
+}
+
+// numericOperation performs numeric operations (sum, max, min, avg, product,
+// clamp) on two values, then aligns the result to a multiple, or to a whole
+// number for integer fields, and, for clamp, bounds it by the schema's range
+// keywords. Integers stay integers: sums and products of two integers are
+// exact, and an int64 overflow is an error.
+func (m *Merger) numericOperation(a, b any, path string, config FieldMergeConfig) (any, error) {
+	_, aOk := toFloat64(a)
+	_, bOk := toFloat64(b)
 
 	if !aOk && !bOk {
 		return nil, fmt.Errorf("numeric strategy requires numbers")
 	}
-	if !aOk {
-		return b, nil
+
+	operation := config.OperationOrDefault()
+	var result any
+	switch {
+	case !aOk:
+		result = b
+	case !bOk:
+		result = a
+	default:
+		var err error
+		if result, err = combineNumbers(a, b, operation); err != nil {
+			return nil, fmt.Errorf("numeric %s at %s: %w", operation, path, err)
+		}
 	}
-	if !bOk {
-		return a, nil
+
+	step := 0.0
+	if config.MultipleOf != nil {
+		step = *config.MultipleOf
+	} else if config.RoundTo != "" && config.bounds != nil {
+		step = config.bounds.multipleOf
 	}
+	if step == 0 && config.bounds != nil && config.bounds.integer {
+		// Results of integer fields stay integers, e.g. the avg of 3 and 4.
+		step = 1
+	}
+	if step > 0 {
+		result = alignNumber(result, step, config.RoundToOrDefault())
+	}
+	if operation == "clamp" && config.bounds != nil {
+		result = clampNumber(result, config.bounds, step)
+	}
+	return result, nil
+}
+
+// combineNumbers applies a numeric operation to two numbers.
+func combineNumbers(a, b any, operation string) (any, error) {
+	aNum, _ := toFloat64(a)
+	bNum, _ := toFloat64(b)
+	aInt, aIsInt := integerOf(a)
+	bInt, bIsInt := integerOf(b)
+	integers := aIsInt && bIsInt
 
 	switch operation {
 	case "sum":
-		return aNum + bNum, nil
+		if integers {
+			sum := aInt + bInt
+			if (sum > aInt) != (bInt > 0) {
+				return nil, fmt.Errorf("int64 overflow: %v + %v", a, b)
+			}
+			return integerResult(sum, a, b), nil
+		}
+		if sum := aNum + bNum; !math.IsInf(sum, 0) {
+			return floatResult(sum, a, b), nil
+		}
+		return nil, fmt.Errorf("float64 overflow: %v + %v", a, b)
+	case "product":
+		if integers {
+			product := aInt * bInt
+			if aInt != 0 && (product/aInt != bInt || aInt == -1 && bInt == math.MinInt64) {
+				return nil, fmt.Errorf("int64 overflow: %v * %v", a, b)
+			}
+			return integerResult(product, a, b), nil
+		}
+		if product := aNum * bNum; !math.IsInf(product, 0) {
+			return floatResult(product, a, b), nil
+		}
+		return nil, fmt.Errorf("float64 overflow: %v * %v", a, b)
+	case "avg":
+		if sum := aInt + bInt; integers && (sum > aInt) == (bInt > 0) && sum%2 == 0 {
+			return integerResult(sum/2, a, b), nil
+		}
+		return floatResult(aNum/2+bNum/2, a, b), nil
 	case "max":
-		if aNum > bNum {
+		if compareNumbers(a, b) > 0 {
 			return a, nil
 		}
 		return b, nil
 	case "min":
-		if aNum < bNum {
+		if compareNumbers(a, b) < 0 {
 			return a, nil
 		}
 		return b, nil
+	case "clamp":
+		return a, nil
 	default:
-		return nil, fmt.Errorf("unknown numeric operation: %s", operation)
-	}
-}
-
-// toFloat64 converts a value to float64 if it's a number.
-func toFloat64(v any) (float64, bool) {
-	switch n := v.(type) {
-	case float64:
-		return n, true
-	case float32:
-		return float64(n), true
-	case int:
-		return float64(n), true
-	case int64:
-		return float64(n), true
-	case int32:
-		return float64(n), true
-	default:
-		return 0, false
+		return nil, fmt.Errorf("unknown operation")
 	}
 }
 
 // isPrimitive returns true if the value is a primitive type (can be a map key).
 func isPrimitive(v any) bool {
 	switch v.(type) {
-	case string, int, int64, int32, float64, float32, bool:
+	case string, json.Number, int, int64, int32, float64, float32, bool:
 		return true
 	default:
 		return false
 	}
 }
 
+// itemConfigFor returns the merge configuration for matched array items with the
+// given discriminator value. A byDiscriminator rule that sets a strategy without
+// replaceOnMatch merges matches with that strategy; otherwise matches follow the
+// array's replaceOnMatch setting and are deep merged.
+func (c FieldMergeConfig) itemConfigFor(discValue any) FieldMergeConfig {
+	itemConfig := FieldMergeConfig{
+		Strategy:       StrategyDeepMerge,
+		ReplaceOnMatch: c.ReplaceOnMatch,
+	}
+	if c.ReplaceOnMatch == nil {
+		replaceOnMatch := c.ReplaceOnMatchOrDefault()
+		itemConfig.ReplaceOnMatch = &replaceOnMatch
+	}
+
+	rule, ok := c.ByDiscriminator[fmt.Sprint(discValue)]
+	if !ok {
+		return itemConfig
+	}
+
+	replaceOnMatch := *itemConfig.ReplaceOnMatch
+	if rule.ReplaceOnMatch != nil {
+		replaceOnMatch = *rule.ReplaceOnMatch
+	} else if rule.Strategy != "" {
+		replaceOnMatch = false
+	}
+	if rule.Strategy == "" {
+		rule.Strategy = StrategyDeepMerge
+	}
+	rule.ReplaceOnMatch = &replaceOnMatch
+	return rule
+}
+
+// itemConfig returns the merge configuration for matched array items with the
+// given discriminator value, after resolving the when clauses of its
+// byDiscriminator rule.
+func (m *Merger) itemConfig(config FieldMergeConfig, discValue any, path string) (FieldMergeConfig, error) {
+	key := fmt.Sprint(discValue)
+	if rule, ok := config.ByDiscriminator[key]; ok && len(rule.When) > 0 {
+		resolved, err := m.resolveWhen(rule, path)
+		if err != nil {
+			return FieldMergeConfig{}, err
+		}
+		config.ByDiscriminator = map[string]FieldMergeConfig{key: resolved}
+	}
+	return config.itemConfigFor(discValue), nil
+}
+
 // mergeByDiscriminator merges two arrays of objects by a discriminator field.
-func (m *Merger) mergeByDiscriminator(a, b any, discriminatorField string, replaceOnMatch bool, path string) (any, error) {
+// Matched items follow the byDiscriminator rule for their discriminator value,
+// falling back to the array's replaceOnMatch setting.
+func (m *Merger) mergeByDiscriminator(a, b any, config FieldMergeConfig, path string, at planCursor) (any, error) {
 	aArr, aIsArr := a.([]any)
 	bArr, bIsArr := b.([]any)
 
@@ -129,6 +285,7 @@ func (m *Merger) mergeByDiscriminator(a, b any, discriminatorField string, repla
 		return bArr, nil
 	}
 
+	discriminatorField := config.DiscriminatorField
 	if discriminatorField == "" {
 		discriminatorField = "type"
 	}
@@ -137,8 +294,9 @@ func (m *Merger) mergeByDiscriminator(a, b any, discriminatorField string, repla
 	for i, item := range bArr {
 		if obj, ok := item.(map[string]any); ok {
 			if discValue, exists := obj[discriminatorField]; exists {
-				if _, alreadyExists := bIndex[discValue]; !alreadyExists {
-					bIndex[discValue] = i
+				key := numberKey(discValue)
+				if _, alreadyExists := bIndex[key]; !alreadyExists {
+					bIndex[key] = i
 				}
 			}
 		}
@@ -160,18 +318,24 @@ func (m *Merger) mergeByDiscriminator(a, b any, discriminatorField string, repla
 			continue
 		}
 
-		bIdx, bHasDisc := bIndex[aDiscValue]
+		bIdx, bHasDisc := bIndex[numberKey(aDiscValue)]
 		if !bHasDisc {
 			result = append(result, aItem)
 			continue
 		}
 
-		if replaceOnMatch {
+		index := strconv.Itoa(i)
+		itemConfig, err := m.itemConfig(config, aDiscValue, childPath(path, index))
+		if err != nil {
+			return nil, err
+		}
+		if itemConfig.ReplaceOnMatchOrDefault() {
 			result = append(result, aItem)
 		} else {
 			bItem := bArr[bIdx]
-			itemPath := fmt.Sprintf("%s/%d", path, i)
-			merged, err := m.deepMerge(aItem, bItem, itemPath)
+			m.layers.matchItem(childPath(path, index), discriminatorField, aDiscValue)
+			// The fields of an item follow the rules of the items schema.
+			merged, err := m.applyStrategy(aItem, bItem, childPath(path, index), at.child("items"), itemConfig)
 			if err != nil {
 				return nil, err
 			}
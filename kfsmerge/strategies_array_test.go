@@ -277,6 +277,49 @@ func TestMergeByDiscriminatorDeepMergeWhenDisabled(t *testing.T) {
 	}
 }
 
+// TestMergeByDiscriminatorItemFieldRules tests that rules declared in the
+// items schema apply to the fields of matched items.
+func TestMergeByDiscriminatorItemFieldRules(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"outputs": {
+				"type": "array",
+				"items": {
+					"type": "object",
+					"properties": {
+						"kind": {"type": "string"},
+						"bitrate": {"type": "integer", "x-kfs-merge": {"strategy": "keepBase"}},
+						"tags": {"type": "array", "items": {"type": "string"}, "x-kfs-merge": {"strategy": "concat"}}
+					}
+				},
+				"x-kfs-merge": {"strategy": "mergeByDiscriminator", "discriminatorField": "kind", "replaceOnMatch": false}
+			}
+		}
+	}`)
+
+	s, err := LoadSchema(schemaJSON)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	a := []byte(`{"outputs": [{"kind": "dash", "bitrate": 9000, "tags": ["request"]}]}`)
+	b := []byte(`{"outputs": [
+		{"kind": "hls", "bitrate": 1000},
+		{"kind": "dash", "bitrate": 2000, "tags": ["template"]}
+	]}`)
+
+	result, err := s.Merge(a, b)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"outputs": [
+		{"kind": "dash", "bitrate": 2000, "tags": ["template", "request"]},
+		{"kind": "hls", "bitrate": 1000}
+	]}`)
+}
+
 // =============================================================================
 // Empty Array Handling Tests (Priority 5)
 // =============================================================================
@@ -782,3 +825,96 @@ func TestDefaultArrayStrategyIsReplace(t *testing.T) {
 		t.Errorf("tags[0] = %v, want 'new1'", tags[0])
 	}
 }
+
+// =============================================================================
+// Per-Discriminator-Value Rule Tests
+// =============================================================================
+
+// TestMergeByDiscriminatorPerValueRules tests that byDiscriminator rules apply per matched item.
+func TestMergeByDiscriminatorPerValueRules(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"outputs": {
+				"type": "array",
+				"items": {"type": "object"},
+				"x-kfs-merge": {
+					"strategy": "mergeByDiscriminator",
+					"discriminatorField": "kind",
+					"byDiscriminator": {
+						"video": {"replaceOnMatch": false},
+						"caption": {"replaceOnMatch": true},
+						"audio": {"strategy": "keepBase"}
+					}
+				}
+			}
+		}
+	}`)
+
+	s, err := LoadSchema(schemaJSON)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	a := []byte(`{"outputs": [
+		{"kind": "video", "bitrate": 5000},
+		{"kind": "caption", "lang": "fr"},
+		{"kind": "audio", "codec": "opus"},
+		{"kind": "thumbnail", "width": 320}
+	]}`)
+	b := []byte(`{"outputs": [
+		{"kind": "video", "bitrate": 3000, "codec": "h264"},
+		{"kind": "caption", "lang": "en", "format": "vtt"},
+		{"kind": "audio", "codec": "aac", "channels": 2},
+		{"kind": "thumbnail", "width": 160, "height": 90}
+	]}`)
+
+	result, err := s.Merge(a, b)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	assertJSONEqualString(t, result, `{"outputs": [
+		{"kind": "video", "bitrate": 5000, "codec": "h264"},
+		{"kind": "caption", "lang": "fr"},
+		{"kind": "audio", "codec": "aac", "channels": 2},
+		{"kind": "thumbnail", "width": 320}
+	]}`)
+}
+
+// TestFieldMergeConfigItemConfigFor tests resolution of per-item rules.
+func TestFieldMergeConfigItemConfigFor(t *testing.T) {
+	f, tr := false, true
+	config := FieldMergeConfig{
+		Strategy:       StrategyMergeByDiscriminator,
+		ReplaceOnMatch: &f,
+		ByDiscriminator: map[string]FieldMergeConfig{
+			"1":       {Strategy: StrategyShallowMerge},
+			"caption": {ReplaceOnMatch: &tr},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		discValue    any
+		wantStrategy MergeStrategy
+		wantReplace  bool
+	}{
+		{"no rule uses array setting", "video", StrategyDeepMerge, false},
+		{"rule replaceOnMatch overrides array setting", "caption", StrategyDeepMerge, true},
+		{"numeric discriminator value matches string key", float64(1), StrategyShallowMerge, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := config.itemConfigFor(tt.discValue)
+			if got.Strategy != tt.wantStrategy {
+				t.Errorf("Strategy = %q, want %q", got.Strategy, tt.wantStrategy)
+			}
+			if got.ReplaceOnMatchOrDefault() != tt.wantReplace {
+				t.Errorf("ReplaceOnMatch = %v, want %v", got.ReplaceOnMatchOrDefault(), tt.wantReplace)
+			}
+		})
+	}
+}
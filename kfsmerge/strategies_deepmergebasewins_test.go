@@ -0,0 +1,131 @@
+package kfsmerge
+
+import "testing"
+
+// =============================================================================
+// deepMergeBaseWins Strategy Tests
+// =============================================================================
+
+// TestMergeDeepMergeBaseWins tests that B wins on conflict while A fills gaps.
+func TestMergeDeepMergeBaseWins(t *testing.T) {
+	schemaJSON := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"running_options": {
+				"type": "object",
+				"x-kfs-merge": {"strategy": "deepMergeBaseWins"},
+				"properties": {
+					"threads": {"type": "integer"},
+					"preset": {"type": "string"},
+					"flags": {"type": "array", "items": {"type": "string"}},
+					"limits": {
+						"type": "object",
+						"properties": {
+							"cpu": {"type": "integer"},
+							"memory": {"type": "integer"}
+						}
+					},
+					"label": {
+						"type": "string",
+						"x-kfs-merge": {"strategy": "keepRequest"}
+					}
+				}
+			},
+			"name": {"type": "string"}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "base wins on scalar conflict",
+			a:        `{"running_options": {"threads": 16, "preset": "fast"}, "name": "request"}`,
+			b:        `{"running_options": {"threads": 4}, "name": "template"}`,
+			expected: `{"running_options": {"threads": 4, "preset": "fast"}, "name": "request"}`,
+		},
+		{
+			name:     "nested objects inherit base-wins",
+			a:        `{"running_options": {"limits": {"cpu": 8, "memory": 4096}}}`,
+			b:        `{"running_options": {"limits": {"cpu": 2}}}`,
+			expected: `{"running_options": {"limits": {"cpu": 2, "memory": 4096}}}`,
+		},
+		{
+			name:     "base array wins",
+			a:        `{"running_options": {"flags": ["-a"]}}`,
+			b:        `{"running_options": {"flags": ["-b"]}}`,
+			expected: `{"running_options": {"flags": ["-b"]}}`,
+		},
+		{
+			name:     "nested field config is honoured",
+			a:        `{"running_options": {"label": "from-request", "threads": 16}}`,
+			b:        `{"running_options": {"label": "from-template", "threads": 4}}`,
+			expected: `{"running_options": {"label": "from-request", "threads": 4}}`,
+		},
+		{
+			name:     "request fills missing section",
+			a:        `{"running_options": {"threads": 16}}`,
+			b:        `{}`,
+			expected: `{"running_options": {"threads": 16}}`,
+		},
+	}
+
+	s, err := LoadSchema([]byte(schemaJSON))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
+
+// TestMergeDeepMergeBaseWinsNullHandling tests null handling for base-wins merges.
+func TestMergeDeepMergeBaseWinsNullHandling(t *testing.T) {
+	tests := []struct {
+		name         string
+		nullHandling string
+		expected     string
+	}{
+		{"asValue keeps null from base", "asValue", `{"opts": {"preset": null}}`},
+		{"asAbsent fills null from request", "asAbsent", `{"opts": {"preset": "fast"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadSchema([]byte(`{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"type": "object",
+				"x-kfs-merge": {"nullHandling": "` + tt.nullHandling + `"},
+				"properties": {
+					"opts": {
+						"type": "object",
+						"x-kfs-merge": {"strategy": "deepMergeBaseWins"},
+						"properties": {
+							"preset": {"type": ["string", "null"]}
+						}
+					}
+				}
+			}`))
+			if err != nil {
+				t.Fatalf("LoadSchema failed: %v", err)
+			}
+
+			result, err := s.Merge([]byte(`{"opts": {"preset": "fast"}}`), []byte(`{"opts": {"preset": null}}`))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
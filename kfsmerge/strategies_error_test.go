@@ -93,7 +93,7 @@ func TestNumericStrategyErrorOnNonNumbers(t *testing.T) {
 	}
 }
 
-// TestNumericStrategyInvalidOperation tests that numeric strategy returns error for unknown operation.
+// TestNumericStrategyInvalidOperation tests that an unknown numeric operation is a load error.
 func TestNumericStrategyInvalidOperation(t *testing.T) {
 	schemaJSON := []byte(`{
 		"$schema": "https://json-schema.org/draft/2020-12/schema",
@@ -106,16 +106,7 @@ func TestNumericStrategyInvalidOperation(t *testing.T) {
 		}
 	}`)
 
-	s, err := LoadSchema(schemaJSON)
-	if err != nil {
-		t.Fatalf("LoadSchema failed: %v", err)
-	}
-
-	a := []byte(`{"count": 10}`)
-	b := []byte(`{"count": 5}`)
-
-	_, err = s.Merge(a, b)
-	if err == nil {
+	if _, err := LoadSchema(schemaJSON); err == nil {
 		t.Fatal("expected error for invalid numeric operation, got nil")
 	}
 }
@@ -0,0 +1,195 @@
+package kfsmerge
+
+import "testing"
+
+// =============================================================================
+// Map-Like Object Tests (additionalProperties / patternProperties)
+// =============================================================================
+
+// TestMergeMapRules tests that rules inside additionalProperties and
+// patternProperties apply to dynamic keys.
+func TestMergeMapRules(t *testing.T) {
+	schemaJSON := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"$defs": {
+			"Limit": {
+				"type": "object",
+				"properties": {
+					"max": {"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "min"}},
+					"note": {"type": "string"}
+				}
+			},
+			"Scoped": {
+				"type": "object",
+				"additionalProperties": {
+					"type": "array",
+					"items": {"type": "string"},
+					"x-kfs-merge": {"strategy": "concat"}
+				}
+			}
+		},
+		"properties": {
+			"job_vars": {
+				"type": "object",
+				"properties": {
+					"owner": {"type": "string"}
+				},
+				"patternProperties": {
+					"^x-": {"type": "string", "x-kfs-merge": {"strategy": "keepBase"}}
+				},
+				"additionalProperties": {
+					"type": "array",
+					"items": {"type": "string"},
+					"x-kfs-merge": {"strategy": "concat", "unique": true}
+				}
+			},
+			"limits": {
+				"type": "object",
+				"additionalProperties": {"$ref": "#/$defs/Limit"}
+			},
+			"scoped": {"$ref": "#/$defs/Scoped"}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "additionalProperties rule applies to dynamic keys",
+			a:        `{"job_vars": {"paths": ["/b", "/c"], "envs": ["prod"]}}`,
+			b:        `{"job_vars": {"paths": ["/a", "/b"]}}`,
+			expected: `{"job_vars": {"paths": ["/a", "/b", "/c"], "envs": ["prod"]}}`,
+		},
+		{
+			name:     "patternProperties rule takes precedence over additionalProperties",
+			a:        `{"job_vars": {"x-trace": "request"}}`,
+			b:        `{"job_vars": {"x-trace": "template"}}`,
+			expected: `{"job_vars": {"x-trace": "template"}}`,
+		},
+		{
+			name:     "declared properties keep their own rules",
+			a:        `{"job_vars": {"owner": "request"}}`,
+			b:        `{"job_vars": {"owner": "template"}}`,
+			expected: `{"job_vars": {"owner": "request"}}`,
+		},
+		{
+			name:     "referenced definition rules apply below dynamic keys",
+			a:        `{"limits": {"cpu": {"max": 8, "note": "request"}}}`,
+			b:        `{"limits": {"cpu": {"max": 4, "note": "template"}}}`,
+			expected: `{"limits": {"cpu": {"max": 4, "note": "request"}}}`,
+		},
+		{
+			name:     "map rules inside definitions",
+			a:        `{"scoped": {"tags": ["a"]}}`,
+			b:        `{"scoped": {"tags": ["b"]}}`,
+			expected: `{"scoped": {"tags": ["b", "a"]}}`,
+		},
+	}
+
+	s, err := LoadSchema([]byte(schemaJSON))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
+
+// TestMergeMapKeys tests how keys of two objects combine.
+func TestMergeMapKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapKeys  string
+		expected string
+	}{
+		{"mergeKeys keeps keys from both sides", "mergeKeys", `{"vars": {"a": {"x": 1, "y": 2}, "b": {"z": 3}, "c": {"w": 4}}}`},
+		{"replace keeps only request keys", "replace", `{"vars": {"a": {"x": 1, "y": 2}, "c": {"w": 4}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := LoadSchema([]byte(`{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"type": "object",
+				"properties": {
+					"vars": {
+						"type": "object",
+						"additionalProperties": {"type": "object"},
+						"x-kfs-merge": {"mapKeys": "` + tt.mapKeys + `"}
+					}
+				}
+			}`))
+			if err != nil {
+				t.Fatalf("LoadSchema failed: %v", err)
+			}
+
+			a := []byte(`{"vars": {"a": {"x": 1}, "c": {"w": 4}}}`)
+			b := []byte(`{"vars": {"a": {"y": 2}, "b": {"z": 3}}}`)
+
+			result, err := s.Merge(a, b)
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
+
+// TestMergeMapKeysWithSlashes tests that keys containing "/" or "~" are one
+// path segment: they keep their rules and count as one level of depth.
+func TestMergeMapKeysWithSlashes(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"m": {
+				"type": "object",
+				"properties": {"x/y": {"type": "string", "x-kfs-merge": {"strategy": "keepBase"}}},
+				"patternProperties": {"^p/": {"type": "string", "x-kfs-merge": {"strategy": "keepBase"}}},
+				"additionalProperties": {"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "sum"}}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	a := []byte(`{"m": {"a/b": 1, "c~d": 1, "x/y": "request", "p/q": "request"}}`)
+	b := []byte(`{"m": {"a/b": 2, "c~d": 2, "x/y": "template", "p/q": "template"}}`)
+	result, err := s.MergeWithOptions(a, b, MergeOptions{MaxDepth: 2})
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"m": {"a/b": 3, "c~d": 3, "x/y": "template", "p/q": "template"}}`)
+
+	if config, ok := s.FieldConfig("/m/a~1b"); !ok || config.Strategy != StrategyNumeric {
+		t.Errorf("FieldConfig(/m/a~1b) = %+v, %v, want the numeric rule", config, ok)
+	}
+}
+
+// TestLoadSchemaRejectsInvalidPatternProperties tests that invalid patterns are load errors.
+func TestLoadSchemaRejectsInvalidPatternProperties(t *testing.T) {
+	_, err := LoadSchema([]byte(`{
+		"type": "object",
+		"properties": {
+			"vars": {
+				"type": "object",
+				"patternProperties": {"([": {"type": "string"}}
+			}
+		}
+	}`))
+	if err == nil {
+		t.Fatal("expected error for invalid pattern, got nil")
+	}
+}
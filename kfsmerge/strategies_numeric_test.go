@@ -2,6 +2,7 @@ package kfsmerge
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -299,3 +300,245 @@ func TestMergeNumericOneMissing(t *testing.T) {
 		t.Errorf("countB = %v, want 20", got["countB"])
 	}
 }
+
+// TestMergeNumericLossless tests that numbers keep their precision and
+// literal form, and that integer sums stay integers.
+func TestMergeNumericLossless(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"id": {"type": "integer"},
+			"frames": {"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "sum"}},
+			"scale": {"type": "number", "x-kfs-merge": {"strategy": "numeric", "operation": "sum"}},
+			"peak": {"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "max"}}
+		}
+	}`)
+
+	s, err := LoadSchema(schemaJSON)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		a, b    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "large integer kept exactly",
+			a:    `{"id": 9007199254740993}`,
+			b:    `{"id": 1}`,
+			want: `{"id":9007199254740993}`,
+		},
+		{
+			name: "integer sum above 2^53",
+			a:    `{"frames": 9007199254740993}`,
+			b:    `{"frames": 2}`,
+			want: `{"frames":9007199254740995}`,
+		},
+		{
+			name: "max of close large integers",
+			a:    `{"peak": 9007199254740992}`,
+			b:    `{"peak": 9007199254740993}`,
+			want: `{"peak":9007199254740993}`,
+		},
+		{
+			name: "float sum",
+			a:    `{"scale": 1.5}`,
+			b:    `{"scale": 2}`,
+			want: `{"scale":3.5}`,
+		},
+		{
+			name: "large float sum without exponent",
+			a:    `{"scale": 1e21}`,
+			b:    `{"scale": 1e21}`,
+			want: `{"scale":2000000000000000000000}`,
+		},
+		{
+			name:    "integer overflow",
+			a:       `{"frames": 9223372036854775807}`,
+			b:       `{"frames": 1}`,
+			wantErr: "numeric sum at /frames: int64 overflow",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Merge error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			if string(result) != tt.want {
+				t.Errorf("Merge = %s, want %s", result, tt.want)
+			}
+		})
+	}
+}
+
+// TestMergeNumericOperations tests avg, product and clamp, and aligning
+// results to multiples.
+func TestMergeNumericOperations(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"avg": {"type": "number", "x-kfs-merge": {"strategy": "numeric", "operation": "avg"}},
+			"workers": {"type": "integer", "x-kfs-merge": {"strategy": "numeric", "operation": "avg"}},
+			"scale": {"type": "number", "x-kfs-merge": {"strategy": "numeric", "operation": "product"}},
+			"bitrate": {
+				"type": "integer", "minimum": 100, "maximum": 8000,
+				"x-kfs-merge": {"strategy": "numeric", "operation": "clamp"}
+			},
+			"quality": {
+				"type": "number", "exclusiveMinimum": 0, "exclusiveMaximum": 1,
+				"x-kfs-merge": {"strategy": "numeric", "operation": "clamp"}
+			},
+			"level": {"$ref": "#/$defs/Level", "x-kfs-merge": {"strategy": "numeric", "operation": "clamp"}},
+			"chunk_frames": {
+				"type": "integer", "maximum": 1000,
+				"x-kfs-merge": {"strategy": "numeric", "operation": "clamp", "multipleOf": 48}
+			},
+			"gop": {
+				"type": "integer", "multipleOf": 24,
+				"x-kfs-merge": {"strategy": "numeric", "operation": "sum", "roundTo": "up"}
+			},
+			"fps": {
+				"type": "number",
+				"x-kfs-merge": {"strategy": "numeric", "operation": "max", "multipleOf": 0.5, "roundTo": "down"}
+			}
+		},
+		"$defs": {"Level": {"type": "integer", "minimum": 1, "maximum": 5}}
+	}`)
+
+	s, err := LoadSchema(schemaJSON)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		a, b    string
+		want    string
+		wantErr string
+	}{
+		{name: "avg of integers", a: `{"avg": 10}`, b: `{"avg": 20}`, want: `{"avg":15}`},
+		{name: "avg with fraction", a: `{"avg": 10}`, b: `{"avg": 15}`, want: `{"avg":12.5}`},
+		{name: "avg of integer field rounds", a: `{"workers": 3}`, b: `{"workers": 4}`, want: `{"workers":4}`},
+		{name: "product", a: `{"scale": 1.5}`, b: `{"scale": 4}`, want: `{"scale":6}`},
+		{name: "product of integers", a: `{"scale": 3}`, b: `{"scale": 7}`, want: `{"scale":21}`},
+		{
+			name:    "product overflow",
+			a:       `{"scale": 4611686018427387904}`,
+			b:       `{"scale": 2}`,
+			wantErr: "numeric product at /scale: int64 overflow",
+		},
+		{name: "clamp to maximum", a: `{"bitrate": 12000}`, b: `{"bitrate": 5000}`, want: `{"bitrate":8000}`},
+		{name: "clamp to minimum", a: `{"bitrate": 50}`, b: `{"bitrate": 5000}`, want: `{"bitrate":100}`},
+		{name: "clamp within range", a: `{"bitrate": 6000}`, b: `{"bitrate": 5000}`, want: `{"bitrate":6000}`},
+		{name: "clamp to exclusive maximum", a: `{"quality": 1}`, b: `{"quality": 0.5}`, want: `{"quality":0.9999999999999999}`},
+		{name: "clamp to referenced bounds", a: `{"level": 9}`, b: `{"level": 2}`, want: `{"level":5}`},
+		{name: "clamp aligned", a: `{"chunk_frames": 1200}`, b: `{"chunk_frames": 480}`, want: `{"chunk_frames":960}`},
+		{name: "align to nearest", a: `{"chunk_frames": 500}`, b: `{"chunk_frames": 480}`, want: `{"chunk_frames":480}`},
+		{name: "align up to schema multipleOf", a: `{"gop": 30}`, b: `{"gop": 24}`, want: `{"gop":72}`},
+		{name: "align down", a: `{"fps": 29.97}`, b: `{"fps": 25}`, want: `{"fps":29.5}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.MergeWithOptions([]byte(tt.a), []byte(tt.b), MergeOptions{SkipValidateA: true})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Merge error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			if string(result) != tt.want {
+				t.Errorf("Merge = %s, want %s", result, tt.want)
+			}
+		})
+	}
+}
+
+// TestMergeNumericClampValidation tests that clamp fields accept requests
+// outside their range with the default merge options.
+func TestMergeNumericClampValidation(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"bitrate": {
+				"type": "integer", "maximum": 5000,
+				"x-kfs-merge": {"strategy": "numeric", "operation": "clamp"}
+			},
+			"height": {"type": "integer", "maximum": 2160}
+		}
+	}`)
+
+	s, err := LoadSchema(schemaJSON)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	result, err := s.Merge([]byte(`{"bitrate": 8000}`), []byte(`{"bitrate": 3000}`))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if want := `{"bitrate":5000}`; string(result) != want {
+		t.Errorf("Merge = %s, want %s", result, want)
+	}
+
+	_, err = s.Merge([]byte(`{"bitrate": 8000, "height": 4320}`), []byte(`{"bitrate": 3000}`))
+	if err == nil || !strings.Contains(err.Error(), "instance A validation failed") {
+		t.Errorf("Merge error = %v, want instance A validation failure", err)
+	}
+	_, err = s.Merge([]byte(`{"bitrate": 3000}`), []byte(`{"bitrate": 8000}`))
+	if err == nil || !strings.Contains(err.Error(), "instance B validation failed") {
+		t.Errorf("Merge error = %v, want instance B validation failure", err)
+	}
+}
+
+// TestMergeNumericLosslessDefaults tests that schema defaults keep their
+// precision, including those of referenced documents.
+func TestMergeNumericLosslessDefaults(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"x-kfs-merge": {"applyDefaults": true},
+		"properties": {
+			"id": {"type": "integer", "default": 9007199254740993},
+			"limits": {"$ref": "limits.json"}
+		}
+	}`)
+	limitsJSON := []byte(`{
+		"type": "object",
+		"properties": {"max_frames": {"type": "integer", "default": 18014398509481985}}
+	}`)
+
+	s, err := LoadSchema(schemaJSON, WithResource("limits.json", limitsJSON))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+	if got := s.ExtractDefaults()["id"]; got != json.Number("9007199254740993") {
+		t.Errorf("default id = %#v, want json.Number(\"9007199254740993\")", got)
+	}
+
+	result, err := s.Merge([]byte(`{}`), []byte(`{}`))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	want := `{"id":9007199254740993,"limits":{"max_frames":18014398509481985}}`
+	if string(result) != want {
+		t.Errorf("Merge = %s, want %s", result, want)
+	}
+}
@@ -0,0 +1,107 @@
+package kfsmerge
+
+import (
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// Quantity Strategy Tests
+// =============================================================================
+
+// TestMergeQuantityStrategy tests resolving quantities with unit suffixes.
+func TestMergeQuantityStrategy(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"bitrate": {"type": "string", "x-kfs-merge": {"strategy": "quantity", "unit": "bitrate"}},
+			"maxrate": {"type": ["string", "integer"], "x-kfs-merge": {"strategy": "quantity", "unit": "bitrate", "operation": "min", "canonicalUnit": "k"}},
+			"buffer": {"type": ["string", "integer"], "x-kfs-merge": {"strategy": "quantity", "unit": "bytes", "operation": "sum"}},
+			"segment": {"type": "string", "x-kfs-merge": {"strategy": "quantity", "unit": "time", "operation": "sum", "canonicalUnit": "s"}}
+		}
+	}`)
+
+	s, err := LoadSchema(schemaJSON)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		a, b    string
+		want    string
+		wantErr string
+	}{
+		{name: "max keeps value as written", a: `{"bitrate": "800k"}`, b: `{"bitrate": "4.5Mbps"}`, want: `{"bitrate":"4.5Mbps"}`},
+		{name: "equal quantities keep request", a: `{"bitrate": "5000k"}`, b: `{"bitrate": "5M"}`, want: `{"bitrate":"5000k"}`},
+		{name: "max with missing base", a: `{"bitrate": "5M"}`, b: `{}`, want: `{"bitrate":"5M"}`},
+		{name: "min in canonical unit", a: `{"maxrate": "5M"}`, b: `{"maxrate": "4500kbps"}`, want: `{"maxrate":"4500k"}`},
+		{name: "plain numbers are base units", a: `{"maxrate": "1M"}`, b: `{"maxrate": 750000}`, want: `{"maxrate":"750k"}`},
+		{name: "sum in request unit", a: `{"buffer": "1.5MiB"}`, b: `{"buffer": "512KiB"}`, want: `{"buffer":"2MiB"}`},
+		{name: "sum of numbers stays a number", a: `{"buffer": 1024}`, b: `{"buffer": 2048}`, want: `{"buffer":3072}`},
+		{name: "sum of large byte counts", a: `{"buffer": 1099511627776}`, b: `{"buffer": 1}`, want: `{"buffer":1099511627777}`},
+		{name: "sum of large byte strings", a: `{"buffer": "1099511627776B"}`, b: `{"buffer": "1B"}`, want: `{"buffer":"1099511627777B"}`},
+		{name: "sum exact in larger unit", a: `{"buffer": "1TiB"}`, b: `{"buffer": "1073741824KiB"}`, want: `{"buffer":"2TiB"}`},
+		{name: "sum without float noise", a: `{"buffer": "0.1M"}`, b: `{"buffer": "0.2M"}`, want: `{"buffer":"0.3M"}`},
+		{name: "sum in canonical unit", a: `{"segment": "1m"}`, b: `{"segment": "500ms"}`, want: `{"segment":"60.5s"}`},
+		{name: "space before unit", a: `{"segment": "30 s"}`, b: `{"segment": "2s"}`, want: `{"segment":"32s"}`},
+		{
+			name:    "unknown unit",
+			a:       `{"bitrate": "5Xbps"}`,
+			b:       `{"bitrate": "5M"}`,
+			wantErr: `quantity at /bitrate: unknown bitrate unit "Xbps" in "5Xbps"`,
+		},
+		{
+			name:    "not a quantity",
+			a:       `{"bitrate": "fast"}`,
+			b:       `{"bitrate": "5M"}`,
+			wantErr: `quantity at /bitrate: "fast" is not a bitrate quantity`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Merge error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			if string(result) != tt.want {
+				t.Errorf("Merge = %s, want %s", result, tt.want)
+			}
+		})
+	}
+}
+
+// TestMergeQuantityUnitSystem tests unit systems registered with WithUnitSystem.
+func TestMergeQuantityUnitSystem(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"height": {"type": "string", "x-kfs-merge": {"strategy": "quantity", "unit": "lines", "canonicalUnit": "p"}}
+		}
+	}`)
+
+	if _, err := LoadSchema(schemaJSON); err == nil || !strings.Contains(err.Error(), `unknown unit system "lines"`) {
+		t.Fatalf("LoadSchema error = %v, want unknown unit system", err)
+	}
+
+	s, err := LoadSchema(schemaJSON, WithUnitSystem("lines", UnitSystem{"": 1, "p": 1, "K": 540}))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+	result, err := s.Merge([]byte(`{"height": "720p"}`), []byte(`{"height": "4K"}`))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if want := `{"height":"2160p"}`; string(result) != want {
+		t.Errorf("Merge = %s, want %s", result, want)
+	}
+}
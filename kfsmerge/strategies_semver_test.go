@@ -0,0 +1,192 @@
+package kfsmerge
+
+import (
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// Semver Strategy Tests
+// =============================================================================
+
+// TestMergeSemverStrategy tests resolving version strings.
+func TestMergeSemverStrategy(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"max": {"type": "string", "x-kfs-merge": {"strategy": "semver"}},
+			"min": {"type": "string", "x-kfs-merge": {"strategy": "semver", "operation": "min"}},
+			"capped": {"type": "string", "x-kfs-merge": {"strategy": "semver", "operation": "max", "constraint": "^2.0.0"}},
+			"pinned": {"type": "string", "x-kfs-merge": {"strategy": "semver", "operation": "satisfies", "constraint": ">=1.4 <1.6 || 3.x"}},
+			"untyped": {"x-kfs-merge": {"strategy": "semver"}}
+		}
+	}`)
+
+	s, err := LoadSchema(schemaJSON)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		a, b    string
+		want    string
+		wantErr string
+	}{
+		{name: "max by precedence", a: `{"max": "1.10.0"}`, b: `{"max": "1.9.3"}`, want: `{"max":"1.10.0"}`},
+		{name: "max keeps formatting", a: `{"max": "v2.0.0"}`, b: `{"max": "1.0.0"}`, want: `{"max":"v2.0.0"}`},
+		{name: "release above prerelease", a: `{"max": "2.0.0-rc.1"}`, b: `{"max": "2.0.0"}`, want: `{"max":"2.0.0"}`},
+		{name: "prerelease identifiers", a: `{"max": "2.0.0-alpha.10"}`, b: `{"max": "2.0.0-alpha.9"}`, want: `{"max":"2.0.0-alpha.10"}`},
+		{name: "equal versions keep request", a: `{"max": "1.0.0+build.2"}`, b: `{"max": "1.0.0+build.1"}`, want: `{"max":"1.0.0+build.2"}`},
+		{name: "min", a: `{"min": "3.0.0"}`, b: `{"min": "2.5.1"}`, want: `{"min":"2.5.1"}`},
+		{name: "max within constraint", a: `{"capped": "3.1.0"}`, b: `{"capped": "2.4.0"}`, want: `{"capped":"2.4.0"}`},
+		{name: "satisfies prefers request", a: `{"pinned": "1.5.2"}`, b: `{"pinned": "3.0.0"}`, want: `{"pinned":"1.5.2"}`},
+		{name: "satisfies falls back to base", a: `{"pinned": "1.6.0"}`, b: `{"pinned": "3.2.1"}`, want: `{"pinned":"3.2.1"}`},
+		{
+			name:    "no version satisfies",
+			a:       `{"capped": "3.0.0"}`,
+			b:       `{"capped": "1.9.9"}`,
+			wantErr: `semver at /capped: no version satisfies "^2.0.0"`,
+		},
+		{
+			name:    "not a semantic version",
+			a:       `{"max": "latest"}`,
+			b:       `{"max": "1.0.0"}`,
+			wantErr: `semver at /max: "latest" is not a semantic version`,
+		},
+		{
+			name:    "number",
+			a:       `{"untyped": 2}`,
+			b:       `{"untyped": "1.0.0"}`,
+			wantErr: `semver at /untyped: semver strategy requires version strings, got number`,
+		},
+		{
+			name:    "leading zero",
+			a:       `{"max": "1.02.0"}`,
+			b:       `{"max": "1.0.0"}`,
+			wantErr: `"1.02.0" is not a semantic version`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Merge error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			if string(result) != tt.want {
+				t.Errorf("Merge = %s, want %s", result, tt.want)
+			}
+		})
+	}
+}
+
+// TestMergeSemverByDiscriminator tests semver as the per-item rule of a
+// mergeByDiscriminator array: the item with the resolved version wins whole.
+func TestMergeSemverByDiscriminator(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"dependencies": {
+				"type": "array",
+				"items": {"type": "object", "properties": {"name": {"type": "string"}, "version": {"type": "string"}}},
+				"x-kfs-merge": {
+					"strategy": "mergeByDiscriminator",
+					"discriminatorField": "name",
+					"byDiscriminator": {
+						"logger": {"strategy": "semver", "operation": "max"},
+						"auth": {"strategy": "semver", "operation": "satisfies", "constraint": "~1.2.0"}
+					}
+				}
+			}
+		}
+	}`)
+
+	s, err := LoadSchema(schemaJSON)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	a := []byte(`{"dependencies": [
+		{"name": "logger", "version": "2.9.0", "source": "request"},
+		{"name": "auth", "version": "1.3.0", "source": "request"}
+	]}`)
+	b := []byte(`{"dependencies": [
+		{"name": "logger", "version": "2.10.0", "source": "template"},
+		{"name": "auth", "version": "1.2.7", "source": "template"},
+		{"name": "metrics", "version": "1.5.0"}
+	]}`)
+
+	result, err := s.Merge(a, b)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"dependencies": [
+		{"name": "logger", "version": "2.10.0", "source": "template"},
+		{"name": "auth", "version": "1.2.7", "source": "template"},
+		{"name": "metrics", "version": "1.5.0"}
+	]}`)
+
+	_, err = s.Merge([]byte(`{"dependencies": [{"name": "logger"}]}`), b)
+	if err == nil || !strings.Contains(err.Error(), `semver at /dependencies/0: object has no "version" version string`) {
+		t.Errorf("Merge error = %v, want missing version error", err)
+	}
+}
+
+// TestSemverConstraint tests version range matching.
+func TestSemverConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		allowed    []string
+		denied     []string
+	}{
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0", "2.0.0-rc.1"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.2.2"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.3.0"}},
+		{"~1", []string{"1.0.0", "1.9.9"}, []string{"2.0.0"}},
+		{"1.x", []string{"1.0.0", "1.99.0"}, []string{"0.9.0", "2.0.0"}},
+		{"*", []string{"0.0.1", "10.0.0"}, nil},
+		{">1.2", []string{"1.3.0"}, []string{"1.2.9"}},
+		{"<=1.2", []string{"1.2.9"}, []string{"1.3.0"}},
+		{">=1.0.0 <1.5.0", []string{"1.0.0", "1.4.9"}, []string{"1.5.0", "0.9.9"}},
+		{"=2.0.0 || ^3.1.0", []string{"2.0.0", "3.4.0"}, []string{"2.0.1", "3.0.0"}},
+		{">=2.0.0-beta.2", []string{"2.0.0-beta.10", "2.0.0"}, []string{"2.0.0-beta.1", "2.0.0-alpha", "2.1.0-beta"}},
+		{"^1.2.0", []string{"1.2.0", "1.3.0"}, []string{"1.3.0-beta", "1.2.0-rc.1"}},
+		{"^1.2.0-beta.1", []string{"1.2.0-beta.2", "1.5.0"}, []string{"1.3.0-beta"}},
+		{">1.2", []string{"1.3.0"}, []string{"1.3.0-beta"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			c, err := parseSemverConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("parseSemverConstraint failed: %v", err)
+			}
+			for _, version := range tt.allowed {
+				if v, err := parseSemver(version); err != nil || !c.allows(v) {
+					t.Errorf("%s does not allow %s (err %v)", tt.constraint, version, err)
+				}
+			}
+			for _, version := range tt.denied {
+				if v, err := parseSemver(version); err != nil || c.allows(v) {
+					t.Errorf("%s allows %s (err %v)", tt.constraint, version, err)
+				}
+			}
+		})
+	}
+
+	for _, bad := range []string{"", "^a.b", "1.2.3.4", ">*", "1.2-rc", "^1.0.0 ||"} {
+		if _, err := parseSemverConstraint(bad); err == nil {
+			t.Errorf("parseSemverConstraint(%q) succeeded, want error", bad)
+		}
+	}
+}
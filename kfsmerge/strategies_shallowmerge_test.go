@@ -0,0 +1,184 @@
+package kfsmerge
+
+import "testing"
+
+// =============================================================================
+// shallowMerge Strategy Tests
+// =============================================================================
+
+// TestMergeShallowMerge tests that nested objects are replaced whole below the merge depth.
+func TestMergeShallowMerge(t *testing.T) {
+	schemaJSON := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"settings": {
+				"type": "object",
+				"x-kfs-merge": {"strategy": "shallowMerge"},
+				"properties": {
+					"name": {"type": "string"},
+					"backend": {"type": "object"},
+					"tags": {
+						"type": "array",
+						"items": {"type": "string"},
+						"x-kfs-merge": {"strategy": "concat"}
+					}
+				}
+			},
+			"nested": {
+				"type": "object",
+				"x-kfs-merge": {"strategy": "shallowMerge", "depth": 2},
+				"properties": {
+					"outer": {
+						"type": "object",
+						"properties": {
+							"backend": {"type": "object"},
+							"region": {"type": "string"}
+						}
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "top-level keys merged",
+			a:        `{"settings": {"name": "request"}}`,
+			b:        `{"settings": {"name": "template", "backend": {"type": "s3", "bucket": "b"}}}`,
+			expected: `{"settings": {"name": "request", "backend": {"type": "s3", "bucket": "b"}}}`,
+		},
+		{
+			name:     "nested object taken whole from request",
+			a:        `{"settings": {"backend": {"type": "gcs", "project": "p"}}}`,
+			b:        `{"settings": {"backend": {"type": "s3", "bucket": "b"}}}`,
+			expected: `{"settings": {"backend": {"type": "gcs", "project": "p"}}}`,
+		},
+		{
+			name:     "nested field config is honoured",
+			a:        `{"settings": {"tags": ["a"]}}`,
+			b:        `{"settings": {"tags": ["b"]}}`,
+			expected: `{"settings": {"tags": ["b", "a"]}}`,
+		},
+		{
+			name:     "depth 2 merges one more level",
+			a:        `{"nested": {"outer": {"backend": {"type": "gcs"}}}}`,
+			b:        `{"nested": {"outer": {"backend": {"type": "s3", "bucket": "b"}, "region": "eu"}}}`,
+			expected: `{"nested": {"outer": {"backend": {"type": "gcs"}, "region": "eu"}}}`,
+		},
+	}
+
+	s, err := LoadSchema([]byte(schemaJSON))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
+
+// TestMergeShallowMergeNestedRules tests that fields inside a shallowMerge
+// keep null handling and union branch resolution.
+func TestMergeShallowMergeNestedRules(t *testing.T) {
+	schemaJSON := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"encoder": {
+				"type": "object",
+				"x-kfs-merge": {"strategy": "shallowMerge", "depth": 2},
+				"properties": {
+					"note": {"type": ["string", "null"], "x-kfs-merge": {"nullHandling": "asAbsent"}},
+					"codec": {
+						"oneOf": [
+							{
+								"type": "object",
+								"properties": {"kind": {"const": "x264"}, "preset": {"type": "string"}},
+								"required": ["kind"]
+							},
+							{
+								"type": "object",
+								"properties": {"kind": {"const": "x265"}, "crf": {"type": "integer"}},
+								"required": ["kind"]
+							}
+						]
+					}
+				}
+			}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "null treated as absent",
+			a:        `{"encoder": {"note": null}}`,
+			b:        `{"encoder": {"note": "keep"}}`,
+			expected: `{"encoder": {"note": "keep"}}`,
+		},
+		{
+			name:     "different union branches not blended",
+			a:        `{"encoder": {"codec": {"kind": "x265", "crf": 20}}}`,
+			b:        `{"encoder": {"codec": {"kind": "x264", "preset": "slow"}}}`,
+			expected: `{"encoder": {"codec": {"kind": "x265", "crf": 20}}}`,
+		},
+		{
+			name:     "same union branch merged within depth",
+			a:        `{"encoder": {"codec": {"kind": "x264"}}}`,
+			b:        `{"encoder": {"codec": {"kind": "x264", "preset": "slow"}}}`,
+			expected: `{"encoder": {"codec": {"kind": "x264", "preset": "slow"}}}`,
+		},
+	}
+
+	s, err := LoadSchema([]byte(schemaJSON))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
+
+// TestFieldMergeConfigDepthOrDefault tests the shallowMerge depth default.
+func TestFieldMergeConfigDepthOrDefault(t *testing.T) {
+	two := 2
+	tests := []struct {
+		name     string
+		config   FieldMergeConfig
+		expected int
+	}{
+		{"unset defaults to 1", FieldMergeConfig{}, 1},
+		{"explicit depth", FieldMergeConfig{Depth: &two}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.DepthOrDefault(); got != tt.expected {
+				t.Errorf("DepthOrDefault() = %d, want %d", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package kfsmerge
+
+import (
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// String Join Strategy Tests
+// =============================================================================
+
+// TestMergeStringJoinStrategy tests joining strings in order, as prefix or
+// suffix, and with token deduplication.
+func TestMergeStringJoinStrategy(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"description": {"type": "string", "x-kfs-merge": {"strategy": "stringJoin"}},
+			"filters": {"type": "string", "x-kfs-merge": {"strategy": "stringJoin", "separator": ",", "order": "requestFirst", "unique": true}},
+			"args": {"type": "string", "x-kfs-merge": {"strategy": "stringJoin", "unique": true}},
+			"title": {"type": "string", "x-kfs-merge": {"strategy": "stringJoin", "separator": ": ", "mode": "prefix"}},
+			"suffix": {"type": "string", "x-kfs-merge": {"strategy": "stringJoin", "separator": "-", "mode": "suffix"}},
+			"count": {"x-kfs-merge": {"strategy": "stringJoin"}},
+			"notes": {"type": ["string", "null"], "x-kfs-merge": {"strategy": "stringJoin", "nullHandling": "asAbsent"}},
+			"label": {"type": ["string", "null"], "x-kfs-merge": {"strategy": "stringJoin"}}
+		}
+	}`)
+
+	s, err := LoadSchema(schemaJSON)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		a, b    string
+		want    string
+		wantErr string
+	}{
+		{name: "base first by default", a: `{"description": "request"}`, b: `{"description": "template"}`, want: `{"description":"template request"}`},
+		{name: "missing base", a: `{"description": "request"}`, b: `{}`, want: `{"description":"request"}`},
+		{name: "empty request", a: `{"description": ""}`, b: `{"description": "template"}`, want: `{"description":"template"}`},
+		{
+			name: "request first with unique tokens",
+			a:    `{"filters": "scale=1280:720,fps=30"}`,
+			b:    `{"filters": "fps=30,format=yuv420p"}`,
+			want: `{"filters":"scale=1280:720,fps=30,format=yuv420p"}`,
+		},
+		{name: "unique drops empty tokens", a: `{"args": "-y  -an"}`, b: `{"args": "-y -hide_banner"}`, want: `{"args":"-y -hide_banner -an"}`},
+		{name: "prefix", a: `{"title": "Draft"}`, b: `{"title": "Episode 1"}`, want: `{"title":"Draft: Episode 1"}`},
+		{name: "prefix already present", a: `{"title": "Draft"}`, b: `{"title": "Draft: Episode 1"}`, want: `{"title":"Draft: Episode 1"}`},
+		{name: "suffix", a: `{"suffix": "hd"}`, b: `{"suffix": "output"}`, want: `{"suffix":"output-hd"}`},
+		{name: "suffix already present", a: `{"suffix": "hd"}`, b: `{"suffix": "output-hd"}`, want: `{"suffix":"output-hd"}`},
+		{name: "suffix of empty base", a: `{"suffix": "hd"}`, b: `{"suffix": ""}`, want: `{"suffix":"hd"}`},
+		{name: "null request is a value", a: `{"label": null}`, b: `{"label": "template"}`, want: `{"label":null}`},
+		{name: "null base is a value", a: `{"label": "request"}`, b: `{"label": null}`, want: `{"label":"request"}`},
+		{name: "null request as absent", a: `{"notes": null}`, b: `{"notes": "template"}`, want: `{"notes":"template"}`},
+		{name: "null base as absent", a: `{"notes": "request"}`, b: `{"notes": null}`, want: `{"notes":"request"}`},
+		{
+			name:    "non-string value",
+			a:       `{"count": 1}`,
+			b:       `{"count": "one"}`,
+			wantErr: "stringJoin at /count: stringJoin strategy requires strings",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Merge error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			if string(result) != tt.want {
+				t.Errorf("Merge = %s, want %s", result, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package kfsmerge
+
+import (
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// Temporal Strategy Tests
+// =============================================================================
+
+// TestMergeTemporalStrategy tests resolving timestamps and durations by
+// schema format.
+func TestMergeTemporalStrategy(t *testing.T) {
+	schemaJSON := []byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"deadline": {"type": "string", "format": "date-time", "x-kfs-merge": {"strategy": "temporal", "operation": "earliest"}},
+			"updated_at": {"type": "string", "format": "date-time", "x-kfs-merge": {"strategy": "temporal"}},
+			"offset": {"$ref": "#/$defs/Offset", "x-kfs-merge": {"strategy": "temporal", "operation": "sum"}},
+			"timeout": {"type": "string", "format": "duration", "x-kfs-merge": {"strategy": "temporal", "operation": "max"}},
+			"grace": {"type": "string", "format": "duration", "x-kfs-merge": {"strategy": "temporal", "operation": "min"}},
+			"start_encoding_at_seconds": {"type": "number", "format": "duration", "x-kfs-merge": {"strategy": "temporal", "operation": "sum"}},
+			"delay": {"type": ["string", "number"], "format": "duration", "x-kfs-merge": {"strategy": "temporal", "operation": "sum"}},
+			"stall_seconds": {"type": "integer", "format": "duration", "x-kfs-merge": {"strategy": "temporal"}}
+		},
+		"$defs": {"Offset": {"type": "string", "format": "duration"}}
+	}`)
+
+	s, err := LoadSchema(schemaJSON)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		a, b    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "earliest across offsets",
+			a:    `{"deadline": "2024-05-01T12:00:00+02:00"}`,
+			b:    `{"deadline": "2024-05-01T11:30:00Z"}`,
+			want: `{"deadline":"2024-05-01T12:00:00+02:00"}`,
+		},
+		{
+			name: "latest by default keeps formatting",
+			a:    `{"updated_at": "2024-05-01T10:00:00Z"}`,
+			b:    `{"updated_at": "2024-05-01T10:00:00.250Z"}`,
+			want: `{"updated_at":"2024-05-01T10:00:00.250Z"}`,
+		},
+		{
+			name: "equal instants keep request",
+			a:    `{"updated_at": "2024-05-01T12:00:00+02:00"}`,
+			b:    `{"updated_at": "2024-05-01T10:00:00Z"}`,
+			want: `{"updated_at":"2024-05-01T12:00:00+02:00"}`,
+		},
+		{name: "sum carries seconds into minutes", a: `{"offset": "PT90S"}`, b: `{"offset": "PT1M30S"}`, want: `{"offset":"PT3M"}`},
+		{name: "sum carries minutes into hours", a: `{"offset": "PT45M"}`, b: `{"offset": "PT30M15S"}`, want: `{"offset":"PT1H15M15S"}`},
+		{name: "sum of fractional hours", a: `{"offset": "PT1.5H"}`, b: `{"offset": "PT30M"}`, want: `{"offset":"PT2H"}`},
+		{name: "sum carries months into years", a: `{"offset": "P10M"}`, b: `{"offset": "P3M"}`, want: `{"offset":"P1Y1M"}`},
+		{name: "sum keeps days apart from months", a: `{"offset": "P1M"}`, b: `{"offset": "P30D"}`, want: `{"offset":"P1M30D"}`},
+		{name: "sum of zero durations", a: `{"offset": "PT0M"}`, b: `{"offset": "PT0S"}`, want: `{"offset":"PT0S"}`},
+		{name: "sum of dates and times", a: `{"offset": "P1D"}`, b: `{"offset": "PT12H"}`, want: `{"offset":"P1DT12H"}`},
+		{name: "sum keeps decimals", a: `{"offset": "PT1.10S"}`, b: `{"offset": "PT2.2S"}`, want: `{"offset":"PT3.30S"}`},
+		{name: "sum of weeks and days", a: `{"offset": "P1W"}`, b: `{"offset": "P2D"}`, want: `{"offset":"P9D"}`},
+		{name: "max by length", a: `{"timeout": "PT90M"}`, b: `{"timeout": "PT1H"}`, want: `{"timeout":"PT90M"}`},
+		{name: "min by length", a: `{"grace": "P1D"}`, b: `{"grace": "PT25H"}`, want: `{"grace":"P1D"}`},
+		{
+			name: "sum of seconds",
+			a:    `{"start_encoding_at_seconds": 9007199254740993}`,
+			b:    `{"start_encoding_at_seconds": 2}`,
+			want: `{"start_encoding_at_seconds":9007199254740995}`,
+		},
+		{name: "sum of fractional seconds", a: `{"start_encoding_at_seconds": 1.5}`, b: `{"start_encoding_at_seconds": 0.25}`, want: `{"start_encoding_at_seconds":1.75}`},
+		{name: "sum of seconds and duration", a: `{"delay": 30}`, b: `{"delay": "PT1M"}`, want: `{"delay":"PT1M30S"}`},
+		{name: "sum of seconds carries", a: `{"delay": 3600}`, b: `{"delay": "PT0.5S"}`, want: `{"delay":"PT1H0.5S"}`},
+		{name: "sum of duration and seconds", a: `{"delay": "PT1.5S"}`, b: `{"delay": 2.25}`, want: `{"delay":"PT3.75S"}`},
+		{name: "max of seconds", a: `{"stall_seconds": 30}`, b: `{"stall_seconds": 45}`, want: `{"stall_seconds":45}`},
+		{
+			name:    "invalid timestamp",
+			a:       `{"deadline": "tomorrow"}`,
+			b:       `{"deadline": "2024-05-01T11:30:00Z"}`,
+			wantErr: `temporal at /deadline: "tomorrow" is not an RFC 3339 date-time`,
+		},
+		{
+			name:    "invalid duration",
+			a:       `{"timeout": "PT1H30"}`,
+			b:       `{"timeout": "PT1H"}`,
+			wantErr: `temporal at /timeout: "PT1H30" is not an ISO 8601 duration`,
+		},
+		{
+			name:    "fraction before last field",
+			a:       `{"offset": "P1.5D"}`,
+			b:       `{"offset": "PT1H"}`,
+			wantErr: `temporal at /offset: the sum of P1.5D and PT1H would have a fraction before its last field`,
+		},
+		{
+			name:    "fields out of order",
+			a:       `{"timeout": "PT30M1H"}`,
+			b:       `{"timeout": "PT1H"}`,
+			wantErr: `"PT30M1H" is not an ISO 8601 duration`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Merge error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			if string(result) != tt.want {
+				t.Errorf("Merge = %s, want %s", result, tt.want)
+			}
+		})
+	}
+}
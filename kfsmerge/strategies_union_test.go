@@ -0,0 +1,377 @@
+package kfsmerge
+
+import "testing"
+
+// =============================================================================
+// oneOf/anyOf Branch-Aware Merge Tests
+// =============================================================================
+
+// TestMergeUnionWithDiscriminator tests that differing branches are replaced and
+// matching branches are merged with the branch's own rules.
+func TestMergeUnionWithDiscriminator(t *testing.T) {
+	schemaJSON := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"$defs": {
+			"S3Backend": {
+				"type": "object",
+				"properties": {
+					"kind": {"const": "s3"},
+					"bucket": {"type": "string"},
+					"tags": {
+						"type": "array",
+						"items": {"type": "string"},
+						"x-kfs-merge": {"strategy": "concat"}
+					}
+				},
+				"required": ["kind"],
+				"additionalProperties": false
+			},
+			"GCSBackend": {
+				"type": "object",
+				"properties": {
+					"kind": {"const": "gcs"},
+					"project": {"type": "string"},
+					"tags": {"type": "array", "items": {"type": "string"}}
+				},
+				"required": ["kind"],
+				"additionalProperties": false
+			}
+		},
+		"properties": {
+			"backend": {
+				"anyOf": [
+					{
+						"oneOf": [{"$ref": "#/$defs/S3Backend"}, {"$ref": "#/$defs/GCSBackend"}],
+						"discriminator": {"propertyName": "kind"}
+					},
+					{"type": "null"}
+				]
+			}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "different branches replaced by request",
+			a:        `{"backend": {"kind": "gcs", "project": "p"}}`,
+			b:        `{"backend": {"kind": "s3", "bucket": "b"}}`,
+			expected: `{"backend": {"kind": "gcs", "project": "p"}}`,
+		},
+		{
+			name:     "same branch deep merged",
+			a:        `{"backend": {"kind": "s3", "bucket": "request"}}`,
+			b:        `{"backend": {"kind": "s3", "bucket": "template", "tags": ["t"]}}`,
+			expected: `{"backend": {"kind": "s3", "bucket": "request", "tags": ["t"]}}`,
+		},
+		{
+			name:     "matched branch rules applied",
+			a:        `{"backend": {"kind": "s3", "tags": ["a"]}}`,
+			b:        `{"backend": {"kind": "s3", "tags": ["b"]}}`,
+			expected: `{"backend": {"kind": "s3", "tags": ["b", "a"]}}`,
+		},
+		{
+			name:     "other branch rules not applied",
+			a:        `{"backend": {"kind": "gcs", "tags": ["a"]}}`,
+			b:        `{"backend": {"kind": "gcs", "tags": ["b"]}}`,
+			expected: `{"backend": {"kind": "gcs", "tags": ["a"]}}`,
+		},
+	}
+
+	s, err := LoadSchema([]byte(schemaJSON))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
+
+// TestMergeUnionByValidation tests branch selection by validating against each branch.
+func TestMergeUnionByValidation(t *testing.T) {
+	schemaJSON := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"deinterlace": {
+				"oneOf": [
+					{
+						"type": "object",
+						"properties": {
+							"yadif_mode": {"type": "integer"},
+							"parity": {"type": "integer"}
+						},
+						"required": ["yadif_mode"],
+						"additionalProperties": false
+					},
+					{
+						"type": "object",
+						"x-kfs-merge": {"strategy": "keepBase"},
+						"properties": {
+							"bwdif_mode": {"type": "integer"},
+							"parity": {"type": "integer"}
+						},
+						"required": ["bwdif_mode"],
+						"additionalProperties": false
+					}
+				]
+			}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "different branches are not blended",
+			a:        `{"deinterlace": {"bwdif_mode": 1}}`,
+			b:        `{"deinterlace": {"yadif_mode": 0, "parity": -1}}`,
+			expected: `{"deinterlace": {"bwdif_mode": 1}}`,
+		},
+		{
+			name:     "same branch deep merged",
+			a:        `{"deinterlace": {"yadif_mode": 1}}`,
+			b:        `{"deinterlace": {"yadif_mode": 0, "parity": -1}}`,
+			expected: `{"deinterlace": {"yadif_mode": 1, "parity": -1}}`,
+		},
+		{
+			name:     "branch-level rule applied",
+			a:        `{"deinterlace": {"bwdif_mode": 1}}`,
+			b:        `{"deinterlace": {"bwdif_mode": 0, "parity": 1}}`,
+			expected: `{"deinterlace": {"bwdif_mode": 0, "parity": 1}}`,
+		},
+	}
+
+	s, err := LoadSchema([]byte(schemaJSON))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
+
+// TestLoadSchemaDetectsUnionDiscriminator tests that a const property shared by all branches is detected.
+func TestLoadSchemaDetectsUnionDiscriminator(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"segmenter": {
+				"oneOf": [
+					{"type": "object", "properties": {"type": {"const": "fixed"}, "seconds": {"type": "number"}}},
+					{"type": "object", "properties": {"type": {"enum": ["scene"]}, "threshold": {"type": "number"}}}
+				]
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	union, ok := s.unions["/segmenter"]
+	if !ok {
+		t.Fatal("expected union at /segmenter")
+	}
+	if union.discriminator != "type" {
+		t.Errorf("discriminator = %q, want %q", union.discriminator, "type")
+	}
+	if len(union.branches) != 2 {
+		t.Errorf("branches = %d, want 2", len(union.branches))
+	}
+}
+
+// TestMergeUnionInWrappersAndMaps tests that unions inside allOf wrappers and
+// map values are detected, so their branches are not blended.
+func TestMergeUnionInWrappersAndMaps(t *testing.T) {
+	schemaJSON := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"$defs": {
+			"Shape": {
+				"oneOf": [
+					{
+						"type": "object",
+						"properties": {"kind": {"const": "a"}, "x": {"type": "integer"}},
+						"required": ["kind"]
+					},
+					{
+						"type": "object",
+						"properties": {"kind": {"const": "b"}, "y": {"type": "integer"}},
+						"required": ["kind"]
+					}
+				]
+			}
+		},
+		"properties": {
+			"wrapped": {"allOf": [{"$ref": "#/$defs/Shape"}], "description": "pydantic v1 field"},
+			"shapes": {"type": "object", "additionalProperties": {"$ref": "#/$defs/Shape"}},
+			"patterned": {"type": "object", "patternProperties": {"^s": {"$ref": "#/$defs/Shape"}}}
+		}
+	}`
+
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "allOf wrapper",
+			a:        `{"wrapped": {"kind": "b", "y": 1}}`,
+			b:        `{"wrapped": {"kind": "a", "x": 2}}`,
+			expected: `{"wrapped": {"kind": "b", "y": 1}}`,
+		},
+		{
+			name:     "additionalProperties",
+			a:        `{"shapes": {"main": {"kind": "b", "y": 1}}}`,
+			b:        `{"shapes": {"main": {"kind": "a", "x": 2}}}`,
+			expected: `{"shapes": {"main": {"kind": "b", "y": 1}}}`,
+		},
+		{
+			name:     "patternProperties",
+			a:        `{"patterned": {"s1": {"kind": "b", "y": 1}}}`,
+			b:        `{"patterned": {"s1": {"kind": "a", "x": 2}}}`,
+			expected: `{"patterned": {"s1": {"kind": "b", "y": 1}}}`,
+		},
+		{
+			name:     "same branch in map deep merged",
+			a:        `{"shapes": {"main": {"kind": "a"}}}`,
+			b:        `{"shapes": {"main": {"kind": "a", "x": 2}}}`,
+			expected: `{"shapes": {"main": {"kind": "a", "x": 2}}}`,
+		},
+	}
+
+	s, err := LoadSchema([]byte(schemaJSON))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
+
+// TestMergeUnionConflictStrategies tests that a union field's own strategy
+// applies when A and B match different branches.
+func TestMergeUnionConflictStrategies(t *testing.T) {
+	// branches is a union of two object branches told apart by "kind".
+	branches := `"oneOf": [
+		{"type": "object", "properties": {"kind": {"const": "s3"}, "bucket": {"type": "string"}}},
+		{"type": "object", "properties": {"kind": {"const": "gcs"}, "project": {"type": "string"}}}
+	]`
+	schemaJSON := `{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"merged": {` + branches + `},
+			"kept": {"x-kfs-merge": {"strategy": "keepBase"}, ` + branches + `},
+			"requested": {"x-kfs-merge": {"strategy": "keepRequest"}, ` + branches + `},
+			"replaced": {"x-kfs-merge": {"strategy": "replace"}, ` + branches + `},
+			"baseWins": {"x-kfs-merge": {"strategy": "deepMergeBaseWins"}, ` + branches + `},
+			"layered": {"x-kfs-merge": {"keepLayer": "org"}, ` + branches + `}
+		}
+	}`
+
+	s, err := LoadSchema([]byte(schemaJSON))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	tests := []struct {
+		field    string
+		expected string
+	}{
+		{field: "merged", expected: `{"kind": "gcs", "project": "p"}`},
+		{field: "kept", expected: `{"kind": "s3", "bucket": "b"}`},
+		{field: "requested", expected: `{"kind": "gcs", "project": "p"}`},
+		{field: "replaced", expected: `{"kind": "gcs", "project": "p"}`},
+		{field: "baseWins", expected: `{"kind": "s3", "bucket": "b"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			a := `{"` + tt.field + `": {"kind": "gcs", "project": "p"}}`
+			b := `{"` + tt.field + `": {"kind": "s3", "bucket": "b"}}`
+			result, err := s.Merge([]byte(a), []byte(b))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, `{"`+tt.field+`": `+tt.expected+`}`)
+		})
+	}
+
+	t.Run("keepLayer", func(t *testing.T) {
+		result, err := s.MergeLayers(
+			Layer{Name: "org", JSON: []byte(`{"layered": {"kind": "s3", "bucket": "org"}}`)},
+			Layer{Name: "request", JSON: []byte(`{"layered": {"kind": "gcs", "project": "p"}}`)},
+		)
+		if err != nil {
+			t.Fatalf("MergeLayers failed: %v", err)
+		}
+		assertJSONEqualString(t, result, `{"layered": {"kind": "s3", "bucket": "org"}}`)
+	})
+}
+
+// TestMergeUnionDeclaredDiscriminator tests that a discriminatorField declared
+// on the union identifies the branches. Without it, the shared const "group"
+// would be detected and both values would fall in the first branch.
+func TestMergeUnionDeclaredDiscriminator(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"storage": {
+				"x-kfs-merge": {"discriminatorField": "kind"},
+				"oneOf": [
+					{"type": "object", "properties": {"group": {"const": "storage"}, "kind": {"const": "s3"}, "bucket": {"type": "string"}}},
+					{"type": "object", "properties": {"group": {"const": "storage"}, "kind": {"const": "gcs"}, "project": {"type": "string"}}}
+				]
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	if got := s.unions["/storage"].discriminator; got != "kind" {
+		t.Errorf("discriminator = %q, want %q", got, "kind")
+	}
+
+	result, err := s.Merge(
+		[]byte(`{"storage": {"group": "storage", "kind": "gcs", "project": "p"}}`),
+		[]byte(`{"storage": {"group": "storage", "kind": "s3", "bucket": "b"}}`),
+	)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	assertJSONEqualString(t, result, `{"storage": {"group": "storage", "kind": "gcs", "project": "p"}}`)
+}
@@ -0,0 +1,256 @@
+package kfsmerge
+
+import (
+	"strings"
+	"testing"
+)
+
+// =============================================================================
+// Conditional (when) Rule Tests
+// =============================================================================
+
+const whenTestSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"properties": {
+		"job_type": {"type": "string", "enum": ["preview", "full", "proxy"]},
+		"priority": {"type": "integer"},
+		"frames_to_encode": {
+			"type": "integer",
+			"x-kfs-merge": {
+				"strategy": "keepRequest",
+				"when": [
+					{"if": {"equals": {"path": "/job_type", "value": "preview"}}, "then": {"strategy": "keepBase"}}
+				]
+			}
+		},
+		"preset": {
+			"type": "string",
+			"x-kfs-merge": {
+				"when": [
+					{
+						"if": {"and": [
+							{"in": {"path": "/job_type", "values": ["full", "proxy"], "doc": "b"}},
+							{"not": {"exists": {"path": "/priority", "doc": "a"}}}
+						]},
+						"then": {"strategy": "keepBase"}
+					}
+				]
+			}
+		}
+	}
+}`
+
+// TestMergeWhenPredicates tests that when clauses select the field configuration.
+func TestMergeWhenPredicates(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "equals on merged document selects alternative",
+			a:        `{"frames_to_encode": 100}`,
+			b:        `{"job_type": "preview", "frames_to_encode": 250}`,
+			expected: `{"job_type": "preview", "frames_to_encode": 250}`,
+		},
+		{
+			name:     "request overrides merged job_type",
+			a:        `{"job_type": "full", "frames_to_encode": 100}`,
+			b:        `{"job_type": "preview", "frames_to_encode": 250}`,
+			expected: `{"job_type": "full", "frames_to_encode": 100}`,
+		},
+		{
+			name:     "and of in and not exists holds",
+			a:        `{"preset": "fast"}`,
+			b:        `{"job_type": "proxy", "preset": "slow"}`,
+			expected: `{"job_type": "proxy", "preset": "slow"}`,
+		},
+		{
+			name:     "and fails when request sets priority",
+			a:        `{"preset": "fast", "priority": 1}`,
+			b:        `{"job_type": "proxy", "preset": "slow"}`,
+			expected: `{"job_type": "proxy", "preset": "fast", "priority": 1}`,
+		},
+		{
+			name:     "in is evaluated against base only",
+			a:        `{"job_type": "full", "preset": "fast"}`,
+			b:        `{"job_type": "preview", "preset": "slow"}`,
+			expected: `{"job_type": "full", "preset": "fast"}`,
+		},
+	}
+
+	s, err := LoadSchema([]byte(whenTestSchema))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
+
+// TestLoadSchemaRejectsInvalidWhen tests that predicates are parsed and type-checked at load time.
+func TestLoadSchemaRejectsInvalidWhen(t *testing.T) {
+	tests := []struct {
+		name    string
+		when    string
+		wantErr string
+	}{
+		{
+			name:    "unknown operator",
+			when:    `[{"if": {"matches": {"path": "/job_type"}}, "then": {}}]`,
+			wantErr: "unknown predicate operator",
+		},
+		{
+			name:    "several operators",
+			when:    `[{"if": {"exists": {"path": "/job_type"}, "not": {"exists": {"path": "/priority"}}}, "then": {}}]`,
+			wantErr: "exactly one operator",
+		},
+		{
+			name:    "unknown path",
+			when:    `[{"if": {"exists": {"path": "/missing"}}, "then": {}}]`,
+			wantErr: "does not exist in the schema",
+		},
+		{
+			name:    "wrong value type",
+			when:    `[{"if": {"equals": {"path": "/priority", "value": "high"}}, "then": {}}]`,
+			wantErr: "not allowed by the schema",
+		},
+		{
+			name:    "value outside enum",
+			when:    `[{"if": {"in": {"path": "/job_type", "values": ["preview", "draft"]}}, "then": {}}]`,
+			wantErr: "not allowed by the schema",
+		},
+		{
+			name:    "invalid doc",
+			when:    `[{"if": {"exists": {"path": "/priority", "doc": "c"}}, "then": {}}]`,
+			wantErr: "doc must be one of",
+		},
+		{
+			name:    "missing then",
+			when:    `[{"if": {"exists": {"path": "/priority"}}}]`,
+			wantErr: "then must be an object",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadSchema([]byte(`{
+				"$schema": "https://json-schema.org/draft/2020-12/schema",
+				"type": "object",
+				"properties": {
+					"job_type": {"type": "string", "enum": ["preview", "full"]},
+					"priority": {"type": "integer"},
+					"value": {"type": "string", "x-kfs-merge": {"when": ` + tt.when + `}}
+				}
+			}`))
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to contain %q", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestMergeWhenSelfReferenceFails tests that a predicate on the field's own merged value is an error.
+func TestMergeWhenSelfReferenceFails(t *testing.T) {
+	s, err := LoadSchema([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"properties": {
+			"mode": {
+				"type": "string",
+				"x-kfs-merge": {
+					"when": [{"if": {"equals": {"path": "/mode", "value": "x"}}, "then": {"strategy": "keepBase"}}]
+				}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	_, err = s.Merge([]byte(`{"mode": "y"}`), []byte(`{"mode": "x"}`))
+	if err == nil {
+		t.Fatal("expected error for self-referencing predicate, got nil")
+	}
+	if !strings.Contains(err.Error(), "depends on its own merged value") {
+		t.Errorf("error = %q, want self-reference error", err.Error())
+	}
+}
+
+// TestMergeWhenInByDiscriminator tests that when clauses of byDiscriminator
+// item rules are evaluated and checked at load time.
+func TestMergeWhenInByDiscriminator(t *testing.T) {
+	schemaFor := func(path string) []byte {
+		return []byte(`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"type": "object",
+			"properties": {
+				"job_type": {"type": "string"},
+				"outputs": {
+					"type": "array",
+					"items": {"type": "object"},
+					"x-kfs-merge": {
+						"strategy": "mergeByDiscriminator",
+						"byDiscriminator": {
+							"video": {
+								"strategy": "deepMerge",
+								"when": [{"if": {"equals": {"path": "` + path + `", "value": "preview"}}, "then": {"replaceOnMatch": true}}]
+							}
+						}
+					}
+				}
+			}
+		}`)
+	}
+
+	if _, err := LoadSchema(schemaFor("/missing")); err == nil || !strings.Contains(err.Error(), "does not exist in the schema") {
+		t.Fatalf("LoadSchema error = %v, want unknown predicate path", err)
+	}
+
+	s, err := LoadSchema(schemaFor("/job_type"))
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected string
+	}{
+		{
+			name:     "clause holds",
+			a:        `{"outputs": [{"type": "video", "codec": "h265"}]}`,
+			b:        `{"job_type": "preview", "outputs": [{"type": "video", "codec": "h264", "crf": 23}]}`,
+			expected: `{"job_type": "preview", "outputs": [{"type": "video", "codec": "h265"}]}`,
+		},
+		{
+			name:     "clause does not hold",
+			a:        `{"outputs": [{"type": "video", "codec": "h265"}]}`,
+			b:        `{"job_type": "full", "outputs": [{"type": "video", "codec": "h264", "crf": 23}]}`,
+			expected: `{"job_type": "full", "outputs": [{"type": "video", "codec": "h265", "crf": 23}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Merge([]byte(tt.a), []byte(tt.b))
+			if err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			assertJSONEqualString(t, result, tt.expected)
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package kfsmerge
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema formats the temporal strategy understands.
+const (
+	formatDateTime = "date-time"
+	formatDuration = "duration"
+)
+
+// temporalOperations lists the temporal operations each format supports.
+// For timestamps, max and min are latest and earliest.
+var temporalOperations = map[string][]string{
+	formatDateTime: {"max", "min", "earliest", "latest"},
+	formatDuration: {"max", "min", "sum"},
+}
+
+// schemaFormat returns the format keyword of a schema node, including that
+// of its $ref and allOf subschemas.
+func (s *Schema) schemaFormat(node map[string]any, visiting map[string]bool) string {
+	if format, ok := node["format"].(string); ok {
+		return format
+	}
+	if ref, ok := schemaRef(node); ok {
+		if defName, ok := s.resolveRef(ref); ok && !visiting[defName] {
+			if defNode, ok := s.defNode(defName); ok {
+				visiting[defName] = true
+				defer delete(visiting, defName)
+				if format := s.schemaFormat(defNode, visiting); format != "" {
+					return format
+				}
+			}
+		}
+	}
+	if parts, ok := node["allOf"].([]any); ok {
+		for _, part := range parts {
+			if partMap, ok := part.(map[string]any); ok {
+				if format := s.schemaFormat(partMap, visiting); format != "" {
+					return format
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// checkTemporalFormat reports a temporal configuration on a schema node
+// whose format it cannot handle.
+func (s *Schema) checkTemporalFormat(node map[string]any, config FieldMergeConfig) error {
+	if config.Strategy != StrategyTemporal {
+		return nil
+	}
+	format := s.schemaFormat(node, make(map[string]bool))
+	operations, ok := temporalOperations[format]
+	if !ok {
+		return fmt.Errorf("strategy %q requires format %q or %q, got %q", config.Strategy, formatDateTime, formatDuration, format)
+	}
+	if operation := config.OperationOrDefault(); !slices.Contains(operations, operation) {
+		return fmt.Errorf("operation %q is not supported for format %q, want one of %s", operation, format, strings.Join(operations, ", "))
+	}
+	return nil
+}
+
+// temporalOperation resolves two timestamps or durations according to the
+// schema format. Durations are ISO 8601 strings or numbers of seconds. Values
+// picked by max, min, earliest and latest are returned as written; sums of
+// durations are written in normal form (see isoDuration.add), and sums of two
+// numbers are numbers.
+func (m *Merger) temporalOperation(a, b any, path string, config FieldMergeConfig) (any, error) {
+	if a == nil {
+		return b, nil
+	}
+	if b == nil {
+		return a, nil
+	}
+
+	operation := config.OperationOrDefault()
+	switch config.format {
+	case formatDateTime:
+		aStr, aOk := a.(string)
+		bStr, bOk := b.(string)
+		if !aOk || !bOk {
+			return nil, fmt.Errorf("temporal at %s: date-time values must be strings", path)
+		}
+		aTime, err := parseDateTime(aStr)
+		if err != nil {
+			return nil, fmt.Errorf("temporal at %s: %w", path, err)
+		}
+		bTime, err := parseDateTime(bStr)
+		if err != nil {
+			return nil, fmt.Errorf("temporal at %s: %w", path, err)
+		}
+		switch operation {
+		case "max", "latest":
+			if bTime.After(aTime) {
+				return b, nil
+			}
+			return a, nil
+		case "min", "earliest":
+			if bTime.Before(aTime) {
+				return b, nil
+			}
+			return a, nil
+		}
+	case formatDuration:
+		aDur, err := durationOf(a)
+		if err != nil {
+			return nil, fmt.Errorf("temporal at %s: %w", path, err)
+		}
+		bDur, err := durationOf(b)
+		if err != nil {
+			return nil, fmt.Errorf("temporal at %s: %w", path, err)
+		}
+		switch operation {
+		case "sum":
+			if _, isString := a.(string); !isString {
+				if _, isString := b.(string); !isString {
+					return combineNumbers(a, b, "sum")
+				}
+			}
+			sum, err := aDur.add(bDur)
+			if err != nil {
+				return nil, fmt.Errorf("temporal at %s: %w", path, err)
+			}
+			return sum.String(), nil
+		case "max":
+			if bDur.seconds() > aDur.seconds() {
+				return b, nil
+			}
+			return a, nil
+		case "min":
+			if bDur.seconds() < aDur.seconds() {
+				return b, nil
+			}
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("temporal at %s: operation %q is not supported for format %q", path, operation, config.format)
+}
+
+// durationOf returns the duration of an ISO 8601 duration string, or of a
+// number of seconds.
+func durationOf(value any) (isoDuration, error) {
+	if str, ok := value.(string); ok {
+		return parseISODuration(str)
+	}
+	seconds, ok := toFloat64(value)
+	if !ok {
+		return isoDuration{}, fmt.Errorf("durations must be strings or numbers, got %s", jsonType(value))
+	}
+	const secondsField = len(isoDesignators) - 1
+	var d isoDuration
+	d.fields[secondsField], d.used[secondsField] = seconds, true
+	if literal, ok := value.(json.Number); ok {
+		if i := strings.IndexByte(string(literal), '.'); i >= 0 && !strings.ContainsAny(string(literal), "eE") {
+			d.decimals[secondsField] = len(literal) - i - 1
+		}
+	}
+	return d, nil
+}
+
+// parseDateTime parses an RFC 3339 timestamp.
+func parseDateTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, strings.ToUpper(s))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not an RFC 3339 date-time", s)
+	}
+	return t, nil
+}
+
+// isoDuration is an ISO 8601 duration such as "P1DT12H" or "PT1.5S", with the
+// designators it is written with.
+type isoDuration struct {
+	fields   [7]float64 // years, months, weeks, days, hours, minutes, seconds
+	used     [7]bool
+	decimals [7]int // digits written after the decimal sign
+}
+
+// isoDesignators are the designators of isoDuration fields, in order; "M" is
+// months before "T" and minutes after it.
+const isoDesignators = "YMWDHMS"
+
+// isoTimeField is the index of the first time field.
+const isoTimeField = 4
+
+// isoFieldSeconds are the nominal lengths of isoDuration fields in seconds,
+// used to compare durations. Years and months have their average length.
+var isoFieldSeconds = [7]float64{365.2425 * 86400, 30.436875 * 86400, 7 * 86400, 86400, 3600, 60, 1}
+
+// parseISODuration parses an ISO 8601 duration. Only the last field may have
+// a fraction, written with "." or ",".
+func parseISODuration(s string) (isoDuration, error) {
+	var d isoDuration
+	invalid := fmt.Errorf("%q is not an ISO 8601 duration", s)
+	rest, ok := strings.CutPrefix(s, "P")
+	if !ok || rest == "" {
+		return d, invalid
+	}
+
+	next, inTime, fraction := 0, false, false
+	for rest != "" {
+		if rest[0] == 'T' {
+			if inTime || len(rest) == 1 {
+				return d, invalid
+			}
+			inTime, next, rest = true, isoTimeField, rest[1:]
+			continue
+		}
+		end := strings.IndexFunc(rest, func(r rune) bool { return (r < '0' || r > '9') && r != '.' && r != ',' })
+		if end <= 0 || fraction {
+			return d, invalid
+		}
+		number := strings.Replace(rest[:end], ",", ".", 1)
+		value, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return d, invalid
+		}
+		decimals := 0
+		if i := strings.IndexByte(number, '.'); i >= 0 {
+			fraction, decimals = true, len(number)-i-1
+		}
+
+		designators, offset := "YMWD", 0
+		if inTime {
+			designators, offset = "HMS", isoTimeField
+		}
+		i := strings.IndexByte(designators, rest[end])
+		if i < 0 || offset+i < next {
+			return d, invalid
+		}
+		field := offset + i
+		d.fields[field], d.used[field], d.decimals[field] = value, true, decimals
+		next = field + 1
+		rest = rest[end+1:]
+	}
+	if !slices.Contains(d.used[:], true) {
+		return d, invalid
+	}
+	return d, nil
+}
+
+// seconds returns the nominal length of the duration in seconds.
+func (d isoDuration) seconds() float64 {
+	total := 0.0
+	for i, value := range d.fields {
+		total += value * isoFieldSeconds[i]
+	}
+	return total
+}
+
+// add returns the sum of two durations in normal form, whatever designators
+// the operands use: weeks combined with other fields become days, as ISO 8601
+// writes weeks alone; months carry into years; and the time fields are
+// written as hours, minutes below 60 and seconds below 60, with as many
+// decimals as the operands need. Days are not carried into months, nor hours
+// into days, as their lengths vary: P1M plus P30D is P1M30D.
+func (d isoDuration) add(other isoDuration) (isoDuration, error) {
+	var sum isoDuration
+	for i := range sum.fields {
+		sum.fields[i] = d.fields[i] + other.fields[i]
+		sum.used[i] = d.used[i] || other.used[i]
+		sum.decimals[i] = max(d.decimals[i], other.decimals[i])
+	}
+	const years, months, weeks, days, hours, minutes, seconds = 0, 1, 2, 3, 4, 5, 6
+	if sum.used[weeks] && (slices.Contains(sum.used[:weeks], true) || slices.Contains(sum.used[days:], true)) {
+		sum.fields[days] += 7 * sum.fields[weeks]
+		sum.fields[weeks], sum.used[weeks], sum.used[days] = 0, false, true
+	}
+	if sum.decimals[months] == 0 && sum.fields[months] >= 12 {
+		sum.fields[years] += math.Floor(sum.fields[months] / 12)
+		sum.fields[months] = math.Mod(sum.fields[months], 12)
+		sum.used[years], sum.used[months] = true, sum.fields[months] != 0
+	}
+
+	if timeUsed := slices.Contains(sum.used[isoTimeField:], true); timeUsed {
+		// Fractions of hours and minutes become whole seconds, or seconds
+		// with fewer decimals.
+		decimals := max(sum.decimals[seconds], sum.decimals[hours]-2, sum.decimals[minutes]-1)
+		scale := math.Pow10(decimals)
+		total := math.Round((sum.fields[hours]*3600+sum.fields[minutes]*60+sum.fields[seconds])*scale) / scale
+		h := math.Floor(total / 3600)
+		m := math.Floor((total - h*3600) / 60)
+		s := math.Round((total-h*3600-m*60)*scale) / scale
+		sum.fields[hours], sum.fields[minutes], sum.fields[seconds] = h, m, s
+		sum.decimals[hours], sum.decimals[minutes], sum.decimals[seconds] = 0, 0, decimals
+		sum.used[hours], sum.used[minutes], sum.used[seconds] = h != 0, m != 0, s != 0
+		if !slices.Contains(sum.used[:], true) {
+			sum.used[seconds] = true // PT0S
+		}
+	}
+
+	last := 0
+	for i, used := range sum.used {
+		if used {
+			last = i
+		}
+	}
+	for i := range last {
+		if sum.used[i] && sum.decimals[i] > 0 {
+			return sum, fmt.Errorf("the sum of %s and %s would have a fraction before its last field", d, other)
+		}
+	}
+	return sum, nil
+}
+
+// String formats the duration with the designators of its fields.
+func (d isoDuration) String() string {
+	var sb strings.Builder
+	sb.WriteString("P")
+	inTime := false
+	for i, value := range d.fields {
+		if !d.used[i] {
+			continue
+		}
+		if i >= isoTimeField && !inTime {
+			sb.WriteString("T")
+			inTime = true
+		}
+		sb.WriteString(strconv.FormatFloat(value, 'f', d.decimals[i], 64))
+		sb.WriteByte(isoDesignators[i])
+	}
+	return sb.String()
+}
@@ -20,14 +20,37 @@ const (
 	StrategyKeepRequest MergeStrategy = "keepRequest"
 	// StrategyDeepMerge recursively merges objects, with A winning on conflict. Respects nullHandling. (default)
 	StrategyDeepMerge MergeStrategy = "deepMerge"
+	// StrategyDeepMergeBaseWins recursively merges objects like deepMerge, but B wins on conflict
+	// and A only fills gaps. Nested fields without their own rules inherit this strategy.
+	StrategyDeepMergeBaseWins MergeStrategy = "deepMergeBaseWins"
+	// StrategyShallowMerge merges object keys down to Depth levels (default 1); below that,
+	// nested objects are atomic and A's object replaces B's whole.
+	StrategyShallowMerge MergeStrategy = "shallowMerge"
 	// StrategyReplace replaces B's value with A's entirely (default for arrays).
 	StrategyReplace MergeStrategy = "replace"
 	// StrategyConcat appends A's array items to B's. Use Unique option to deduplicate.
 	StrategyConcat MergeStrategy = "concat"
 	// StrategyMergeByDiscriminator merges array items by discriminator field.
 	StrategyMergeByDiscriminator MergeStrategy = "mergeByDiscriminator"
-	// StrategyNumeric performs numeric operations (sum, max, min) based on Operation option.
+	// StrategyNumeric performs numeric operations (sum, max, min, avg, product, clamp) based on
+	// Operation option, optionally aligning the result with MultipleOf and RoundTo.
 	StrategyNumeric MergeStrategy = "numeric"
+	// StrategySemver resolves semantic versions to the higher (max, default) or lower (min) one,
+	// or to the first of A and B that satisfies Constraint (satisfies). Constraint also limits
+	// max and min. On objects, such as mergeByDiscriminator items, VersionField holds the version.
+	StrategySemver MergeStrategy = "semver"
+	// StrategyTemporal resolves RFC 3339 timestamps (format "date-time": latest/max, default,
+	// or earliest/min) and ISO 8601 durations (format "duration": max, min or sum), keeping
+	// the values' formatting. Number fields with format "duration" hold seconds.
+	StrategyTemporal MergeStrategy = "temporal"
+	// StrategyQuantity resolves quantities with units, such as "5M" bitrates, in the unit
+	// system named by Unit: the larger (max, default), the smaller (min) or their sum,
+	// written in CanonicalUnit when set.
+	StrategyQuantity MergeStrategy = "quantity"
+	// StrategyStringJoin joins A's and B's strings with Separator in Order, or places A at the
+	// start (prefix) or end (suffix) of B unless it is already there. Use Unique option to drop
+	// repeated tokens.
+	StrategyStringJoin MergeStrategy = "stringJoin"
 )
 
 // NullHandling defines how explicit null values are handled during merge.
@@ -42,6 +65,50 @@ const (
 	NullPreserve NullHandling = "preserve"
 )
 
+// MapKeysMode defines how the keys of two objects combine under deepMerge.
+type MapKeysMode string
+
+const (
+	// MapKeysMerge keeps the keys of both objects (default).
+	MapKeysMerge MapKeysMode = "mergeKeys"
+	// MapKeysReplace keeps only A's keys; values of keys present on both sides are still merged.
+	MapKeysReplace MapKeysMode = "replace"
+)
+
+// RoundMode defines how the numeric strategy aligns a result to a multiple.
+type RoundMode string
+
+const (
+	// RoundNearest aligns to the nearest multiple, halfway values rounding up (default).
+	RoundNearest RoundMode = "nearest"
+	// RoundUp aligns to the next multiple up.
+	RoundUp RoundMode = "up"
+	// RoundDown aligns to the next multiple down.
+	RoundDown RoundMode = "down"
+)
+
+// JoinOrder defines which string comes first under the stringJoin strategy.
+type JoinOrder string
+
+const (
+	// JoinBaseFirst writes B's string before A's, as concat does with arrays (default).
+	JoinBaseFirst JoinOrder = "baseFirst"
+	// JoinRequestFirst writes A's string before B's.
+	JoinRequestFirst JoinOrder = "requestFirst"
+)
+
+// JoinMode defines how the stringJoin strategy combines strings.
+type JoinMode string
+
+const (
+	// JoinModeJoin joins both strings in Order (default).
+	JoinModeJoin JoinMode = "join"
+	// JoinModePrefix places A's string at the start of B's unless B already starts with it.
+	JoinModePrefix JoinMode = "prefix"
+	// JoinModeSuffix places A's string at the end of B's unless B already ends with it.
+	JoinModeSuffix JoinMode = "suffix"
+)
+
 // GlobalMergeConfig holds schema-level merge configuration.
 type GlobalMergeConfig struct {
 	DefaultStrategy MergeStrategy `json:"defaultStrategy,omitempty"`
@@ -56,8 +123,29 @@ type FieldMergeConfig struct {
 	DiscriminatorField string        `json:"discriminatorField,omitempty"`
 	ReplaceOnMatch     *bool         `json:"replaceOnMatch,omitempty"`
 	NullHandling       NullHandling  `json:"nullHandling,omitempty"`
-	Unique             *bool         `json:"unique,omitempty"`    // For concat strategy: deduplicate items
-	Operation          string        `json:"operation,omitempty"` // For numeric strategy: "sum", "max", "min"
+	Unique             *bool         `json:"unique,omitempty"`        // For concat and stringJoin strategies: deduplicate items or tokens
+	Operation          string        `json:"operation,omitempty"`     // For strategies in strategyOperations
+	MultipleOf         *float64      `json:"multipleOf,omitempty"`    // For numeric strategy: align the result to a multiple of this step
+	RoundTo            RoundMode     `json:"roundTo,omitempty"`       // For numeric strategy: how the result is aligned
+	Constraint         string        `json:"constraint,omitempty"`    // For semver strategy: version range, e.g. "^2.0.0"
+	VersionField       string        `json:"versionField,omitempty"`  // For semver strategy on objects: the version's key
+	Unit               string        `json:"unit,omitempty"`          // For quantity strategy: the unit system, e.g. "bitrate"
+	CanonicalUnit      string        `json:"canonicalUnit,omitempty"` // For quantity strategy: the unit results are written in
+	Separator          *string       `json:"separator,omitempty"`     // For stringJoin strategy: written between strings and splitting tokens
+	Order              JoinOrder     `json:"order,omitempty"`         // For stringJoin strategy: which string comes first
+	Mode               JoinMode      `json:"mode,omitempty"`          // For stringJoin strategy: join, prefix or suffix
+	KeepLayer          string        `json:"keepLayer,omitempty"`     // For layered merges: the named layer's value wins, whole, when it has one
+	Depth              *int          `json:"depth,omitempty"`         // For shallowMerge strategy: levels of keys to merge
+	MapKeys            MapKeysMode   `json:"mapKeys,omitempty"`       // For deepMerge on objects: how keys combine
+	// ByDiscriminator holds per-item rules for mergeByDiscriminator arrays, keyed by discriminator value.
+	ByDiscriminator map[string]FieldMergeConfig `json:"byDiscriminator,omitempty"`
+	// When holds alternative configurations; the first clause whose predicate holds replaces this one.
+	When []ConditionalConfig `json:"when,omitempty"`
+
+	bounds *numericBounds // For numeric strategy: the range keywords of the field's schema
+	format string         // For temporal strategy: the format of the field's schema
+
+	constraint semverConstraint // For semver strategy: Constraint, parsed
 }
 
 // UniqueOrDefault returns the Unique setting with default false.
@@ -68,14 +156,74 @@ func (c FieldMergeConfig) UniqueOrDefault() bool {
 	return false
 }
 
-// OperationOrDefault returns the Operation setting with default "sum".
+// OperationOrDefault returns the Operation setting with default the strategy's
+// first operation ("sum" for numeric, "max" for the others).
 func (c FieldMergeConfig) OperationOrDefault() string {
 	if c.Operation != "" {
 		return c.Operation
 	}
+	if operations := strategyOperations[c.Strategy]; len(operations) > 0 {
+		return operations[0]
+	}
 	return "sum"
 }
 
+// VersionFieldOrDefault returns the VersionField setting with default "version".
+func (c FieldMergeConfig) VersionFieldOrDefault() string {
+	if c.VersionField != "" {
+		return c.VersionField
+	}
+	return "version"
+}
+
+// RoundToOrDefault returns the RoundTo setting with default "nearest".
+func (c FieldMergeConfig) RoundToOrDefault() RoundMode {
+	if c.RoundTo != "" {
+		return c.RoundTo
+	}
+	return RoundNearest
+}
+
+// DepthOrDefault returns the Depth setting with default 1.
+func (c FieldMergeConfig) DepthOrDefault() int {
+	if c.Depth != nil {
+		return *c.Depth
+	}
+	return 1
+}
+
+// MapKeysOrDefault returns the MapKeys setting with default "mergeKeys".
+func (c FieldMergeConfig) MapKeysOrDefault() MapKeysMode {
+	if c.MapKeys != "" {
+		return c.MapKeys
+	}
+	return MapKeysMerge
+}
+
+// SeparatorOrDefault returns the Separator setting with default " ".
+func (c FieldMergeConfig) SeparatorOrDefault() string {
+	if c.Separator != nil {
+		return *c.Separator
+	}
+	return " "
+}
+
+// OrderOrDefault returns the Order setting with default JoinBaseFirst.
+func (c FieldMergeConfig) OrderOrDefault() JoinOrder {
+	if c.Order != "" {
+		return c.Order
+	}
+	return JoinBaseFirst
+}
+
+// ModeOrDefault returns the Mode setting with default JoinModeJoin.
+func (c FieldMergeConfig) ModeOrDefault() JoinMode {
+	if c.Mode != "" {
+		return c.Mode
+	}
+	return JoinModeJoin
+}
+
 // DefaultGlobalConfig returns GlobalMergeConfig with default values.
 func DefaultGlobalConfig() GlobalMergeConfig {
 	return GlobalMergeConfig{
@@ -104,8 +252,40 @@ type MergeOptions struct {
 	SkipValidateB      bool
 	SkipValidateResult bool
 	ApplyDefaults      *bool // nil uses schema setting, non-nil overrides
+	MaxDepth           int   // maximum nesting depth of merged values; 0 uses DefaultMaxMergeDepth
+}
+
+// DefaultMaxMergeDepth is the maximum nesting depth merged when MergeOptions.MaxDepth is 0.
+const DefaultMaxMergeDepth = 1000
+
+// MaxDepthOrDefault returns the maximum merge depth, defaulting to DefaultMaxMergeDepth.
+func (o MergeOptions) MaxDepthOrDefault() int {
+	if o.MaxDepth > 0 {
+		return o.MaxDepth
+	}
+	return DefaultMaxMergeDepth
+}
+
+// Layer is a named JSON instance taking part in a layered merge.
+// Layers are ordered from lowest to highest precedence.
+type Layer struct {
+	Name string
+	JSON []byte
 }
 
+// LayeredResult holds the outcome of a layered merge.
+type LayeredResult struct {
+	JSON []byte
+	// Value is the merged instance as decoded JSON.
+	Value any
+	// Provenance maps the JSON pointer of every leaf value in the result to
+	// the name of the layer it was taken from.
+	Provenance map[string]string
+}
+
+// DefaultsLayerName is the provenance name reported for values taken from schema defaults.
+const DefaultsLayerName = "schemaDefaults"
+
 // DefaultMergeOptions returns the default options (all validations enabled).
 func DefaultMergeOptions() MergeOptions {
 	return MergeOptions{}
@@ -0,0 +1,351 @@
+package kfsmerge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// unionInfo describes a polymorphic oneOf/anyOf node with two or more object branches.
+type unionInfo struct {
+	branches      []*unionBranch
+	discriminator string // property whose const value identifies the branch
+	hasOwnConfig  bool   // the union node carries its own x-kfs-merge block
+}
+
+// unionBranch is one object branch of a union and the merge rules declared inside it.
+type unionBranch struct {
+	compiled     *jsonschema.Schema
+	constValues  map[string]any              // const-valued properties of the branch
+	config       *FieldMergeConfig           // branch-level x-kfs-merge
+	fieldConfigs map[string]FieldMergeConfig // relative path -> config inside the branch
+	defName      string                      // $defs entry the branch references, if any
+	plan         *planNode                   // merge plan of the rules inside the branch
+}
+
+// activeBranch is a union branch the merger is currently merging within.
+type activeBranch struct {
+	union  *unionInfo
+	branch *unionBranch
+}
+
+// branchOf returns the index of the branch value belongs to, or -1 if unknown.
+// A declared or detected discriminator is tried first, then validation against
+// each branch's compiled schema.
+func (u *unionInfo) branchOf(value map[string]any) int {
+	if u.discriminator != "" {
+		if discValue, ok := value[u.discriminator]; ok {
+			for i, branch := range u.branches {
+				if constValue, ok := branch.constValues[u.discriminator]; ok && valuesEqual(constValue, discValue) {
+					return i
+				}
+			}
+		}
+	}
+
+	for i, branch := range u.branches {
+		if branch.compiled != nil && branch.compiled.Validate(value) == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveUnion determines the branches of A and B. It returns the shared branch
+// when both match the same one, and conflict when they match different ones.
+func (u *unionInfo) resolveUnion(a, b any) (branch *unionBranch, conflict bool) {
+	aMap, aIsMap := a.(map[string]any)
+	bMap, bIsMap := b.(map[string]any)
+	if !aIsMap || !bIsMap {
+		return nil, false
+	}
+
+	aIdx, bIdx := u.branchOf(aMap), u.branchOf(bMap)
+	if aIdx < 0 || bIdx < 0 {
+		return nil, false
+	}
+	if aIdx != bIdx {
+		return nil, true
+	}
+	return u.branches[aIdx], false
+}
+
+// parseUnions walks the schema from node and registers every polymorphic
+// oneOf/anyOf by instance path, including those in allOf parts and map
+// values. $refs are followed, guarded against cycles.
+// location is the absolute location of node, used to compile union branches.
+func (s *Schema) parseUnions(compiler *jsonschema.Compiler, path, location string, node map[string]any, visiting map[string]bool) error {
+	if ref, ok := schemaRef(node); ok {
+		if defName, isLocal := s.resolveRef(ref); isLocal && !visiting[defName] {
+			if defNode, ok := s.defNode(defName); ok {
+				visiting[defName] = true
+				err := s.parseUnions(compiler, path, s.defLocation(defName), defNode, visiting)
+				delete(visiting, defName)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, keyword := range []string{"oneOf", "anyOf"} {
+		alts, ok := node[keyword].([]any)
+		if !ok {
+			continue
+		}
+
+		var branches []*unionBranch
+		for i, alt := range alts {
+			altMap, ok := alt.(map[string]any)
+			if !ok {
+				continue
+			}
+			altLocation := fmt.Sprintf("%s/%s/%d", location, keyword, i)
+
+			if s.isObjectBranch(altMap) {
+				branch, err := s.parseUnionBranch(compiler, altLocation, altMap)
+				if err != nil {
+					return err
+				}
+				branches = append(branches, branch)
+			}
+
+			if err := s.parseUnions(compiler, path, altLocation, altMap, visiting); err != nil {
+				return err
+			}
+		}
+
+		if len(branches) < 2 {
+			continue
+		}
+		if _, exists := s.unions[path]; exists {
+			continue
+		}
+
+		union := &unionInfo{branches: branches, discriminator: declaredDiscriminator(node)}
+		if _, ok := node[MergeExtensionKey]; ok {
+			union.hasOwnConfig = true
+		}
+		if union.discriminator == "" {
+			union.discriminator = detectDiscriminator(branches)
+		}
+		s.unions[path] = union
+	}
+
+	if parts, ok := node["allOf"].([]any); ok {
+		for i, part := range parts {
+			if partMap, ok := part.(map[string]any); ok {
+				if err := s.parseUnions(compiler, path, fmt.Sprintf("%s/allOf/%d", location, i), partMap, visiting); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if props, ok := node["properties"].(map[string]any); ok {
+		for propName, propValue := range props {
+			if propMap, ok := propValue.(map[string]any); ok {
+				propLocation := location + "/properties/" + escapePointer(propName)
+				if err := s.parseUnions(compiler, childPath(path, propName), propLocation, propMap, visiting); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if items, ok := node["items"].(map[string]any); ok {
+		if err := s.parseUnions(compiler, path+"/items", location+"/items", items, visiting); err != nil {
+			return err
+		}
+	}
+
+	// Values of map-like objects are registered under the segment their
+	// rules are stored under.
+	if additional, ok := node["additionalProperties"].(map[string]any); ok {
+		if err := s.parseUnions(compiler, childPath(path, additionalSegment), location+"/additionalProperties", additional, visiting); err != nil {
+			return err
+		}
+	}
+	if patternProps, ok := node["patternProperties"].(map[string]any); ok {
+		for pattern, sub := range patternProps {
+			if subMap, ok := sub.(map[string]any); ok {
+				subLocation := location + "/patternProperties/" + escapePointer(pattern)
+				if err := s.parseUnions(compiler, childPath(path, patternSegment(pattern)), subLocation, subMap, visiting); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseUnionBranch compiles a union branch and collects the merge rules declared in it.
+func (s *Schema) parseUnionBranch(compiler *jsonschema.Compiler, location string, node map[string]any) (*unionBranch, error) {
+	compiled, err := compiler.Compile(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile union branch %s: %w", location, err)
+	}
+
+	branch := &unionBranch{
+		compiled:     compiled,
+		constValues:  make(map[string]any),
+		fieldConfigs: make(map[string]FieldMergeConfig),
+	}
+
+	body := node
+	if ref, ok := schemaRef(node); ok {
+		if defName, isLocal := s.resolveRef(ref); isLocal {
+			if defNode, ok := s.defNode(defName); ok {
+				body = defNode
+			}
+			branch.defName = defName
+			if config, ok := s.defConfigAt(defName, ""); ok {
+				branch.config = &config
+			}
+			prefix := defName + ":"
+			for key, config := range s.defConfigs {
+				if strings.HasPrefix(key, prefix) {
+					branch.fieldConfigs[key[len(prefix):]] = config
+				}
+			}
+		}
+	}
+
+	if props, ok := body["properties"].(map[string]any); ok {
+		for propName, propValue := range props {
+			if propMap, ok := propValue.(map[string]any); ok {
+				if constValue, ok := constOf(propMap); ok {
+					branch.constValues[propName] = constValue
+				}
+			}
+		}
+	}
+
+	if mergeRaw, ok := node[MergeExtensionKey]; ok {
+		mergeMap, ok := mergeRaw.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s in union branch %s must be an object", MergeExtensionKey, location)
+		}
+		config, err := s.parseNodeMergeConfig(node, mergeMap)
+		if err != nil {
+			return nil, fmt.Errorf("%s in union branch %s: %w", MergeExtensionKey, location, err)
+		}
+		branch.config = &config
+	}
+
+	if err := s.collectBranchConfigs(branch.fieldConfigs, "", node, location); err != nil {
+		return nil, err
+	}
+	return branch, nil
+}
+
+// collectBranchConfigs collects x-kfs-merge rules declared inline below a branch.
+func (s *Schema) collectBranchConfigs(configs map[string]FieldMergeConfig, path string, node map[string]any, pointer string) error {
+	if path != "" {
+		if mergeRaw, ok := node[MergeExtensionKey]; ok {
+			mergeMap, ok := mergeRaw.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s in union branch %s at %s must be an object", MergeExtensionKey, pointer, path)
+			}
+			config, err := s.parseNodeMergeConfig(node, mergeMap)
+			if err != nil {
+				return fmt.Errorf("%s in union branch %s at %s: %w", MergeExtensionKey, pointer, path, err)
+			}
+			configs[path] = config
+		}
+	}
+
+	if props, ok := node["properties"].(map[string]any); ok {
+		for propName, propValue := range props {
+			if propMap, ok := propValue.(map[string]any); ok {
+				if err := s.collectBranchConfigs(configs, childPath(path, propName), propMap, pointer); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if items, ok := node["items"].(map[string]any); ok {
+		if err := s.collectBranchConfigs(configs, path+"/items", items, pointer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isObjectBranch reports whether a union alternative describes an object.
+func (s *Schema) isObjectBranch(node map[string]any) bool {
+	if ref, ok := schemaRef(node); ok {
+		if defName, isLocal := s.resolveRef(ref); isLocal {
+			if defNode, ok := s.defNode(defName); ok {
+				return s.isObjectBranch(defNode)
+			}
+		}
+		return false
+	}
+	if _, ok := node["properties"].(map[string]any); ok {
+		return true
+	}
+	return node["type"] == "object"
+}
+
+// declaredDiscriminator returns the discriminator property declared on a union
+// node, either as x-kfs-merge discriminatorField or as an OpenAPI-style
+// discriminator.propertyName (as emitted by pydantic).
+func declaredDiscriminator(node map[string]any) string {
+	if mergeMap, ok := node[MergeExtensionKey].(map[string]any); ok {
+		if field, ok := mergeMap["discriminatorField"].(string); ok {
+			return field
+		}
+	}
+	if disc, ok := node["discriminator"].(map[string]any); ok {
+		if propertyName, ok := disc["propertyName"].(string); ok {
+			return propertyName
+		}
+	}
+	return ""
+}
+
+// detectDiscriminator returns a property that carries a const value in every branch.
+func detectDiscriminator(branches []*unionBranch) string {
+	var candidates []string
+	for propName := range branches[0].constValues {
+		candidates = append(candidates, propName)
+	}
+	sort.Strings(candidates)
+
+	for _, propName := range candidates {
+		shared := true
+		for _, branch := range branches[1:] {
+			if _, ok := branch.constValues[propName]; !ok {
+				shared = false
+				break
+			}
+		}
+		if shared {
+			return propName
+		}
+	}
+	return ""
+}
+
+// constOf returns the const value of a property schema, also accepting a single-value enum.
+func constOf(node map[string]any) (any, bool) {
+	if constValue, ok := node["const"]; ok {
+		return constValue, true
+	}
+	if enum, ok := node["enum"].([]any); ok && len(enum) == 1 {
+		return enum[0], true
+	}
+	return nil, false
+}
+
+// escapePointer escapes a property name for use as a JSON pointer token.
+func escapePointer(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	return strings.ReplaceAll(token, "/", "~1")
+}
@@ -1,10 +1,14 @@
 package kfsmerge
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 
 	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
 )
 
 // ValidationError represents a validation failure.
@@ -31,32 +35,97 @@ func NewValidator(s *Schema) *Validator {
 
 // Validate validates a JSON instance and returns the first error encountered.
 func (v *Validator) Validate(instanceJSON []byte, phase ValidationPhase) error {
-	var instance any
-	if err := json.Unmarshal(instanceJSON, &instance); err != nil {
-		return ValidationError{
-			Path:    "",
-			Message: fmt.Sprintf("invalid JSON: %v", err),
-			Phase:   phase,
-		}
+	instance, err := decodeJSON(instanceJSON)
+	if err != nil {
+		return invalidJSONError(err, phase)
+	}
+	return v.ValidateValue(instance, phase)
+}
+
+// decodeJSON decodes a JSON instance, keeping numbers as json.Number.
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after top-level value")
+	}
+	return value, nil
+}
+
+// invalidJSONError reports an instance that failed to decode.
+func invalidJSONError(err error, phase ValidationPhase) ValidationError {
+	return ValidationError{
+		Path:    "",
+		Message: fmt.Sprintf("invalid JSON: %v", err),
+		Phase:   phase,
 	}
+}
 
+// ValidateValue validates an already-parsed value.
+func (v *Validator) ValidateValue(instance any, phase ValidationPhase) error {
 	err := v.schema.CompiledSchema().Validate(instance)
 	if err == nil {
 		return nil
 	}
-
 	return v.convertError(err, phase)
 }
 
-// ValidateValue validates an already-parsed value.
-func (v *Validator) ValidateValue(instance any, phase ValidationPhase) error {
+// validateRequest validates an instance that is merged as A. Values of clamp
+// fields may lie outside the field's range, as the merge bounds them.
+func (v *Validator) validateRequest(instance any, phase ValidationPhase) error {
 	err := v.schema.CompiledSchema().Validate(instance)
 	if err == nil {
 		return nil
 	}
+	if validationErr, ok := err.(*jsonschema.ValidationError); ok && v.schema.clampedOnly(validationErr) {
+		return nil
+	}
 	return v.convertError(err, phase)
 }
 
+// clampedOnly reports whether every cause of a validation error is a range
+// keyword of a field bounded by the clamp operation.
+func (s *Schema) clampedOnly(err *jsonschema.ValidationError) bool {
+	if len(err.Causes) == 0 {
+		switch err.ErrorKind.(type) {
+		case *kind.Minimum, *kind.Maximum, *kind.ExclusiveMinimum, *kind.ExclusiveMaximum:
+			return s.clamps(joinPath(err.InstanceLocation))
+		}
+		return false
+	}
+	for _, cause := range err.Causes {
+		if !s.clampedOnly(cause) {
+			return false
+		}
+	}
+	return true
+}
+
+// clamps reports whether the rule at an instance path, or one of its when
+// clauses, is the clamp operation.
+func (s *Schema) clamps(path string) bool {
+	node := s.plan.at(path)
+	if node == nil || !node.hasConfig {
+		return false
+	}
+	isClamp := func(c FieldMergeConfig) bool {
+		return c.Strategy == StrategyNumeric && c.OperationOrDefault() == "clamp"
+	}
+	if isClamp(node.config) {
+		return true
+	}
+	for _, clause := range node.config.When {
+		if isClamp(clause.Then) {
+			return true
+		}
+	}
+	return false
+}
+
 // convertError converts a jsonschema validation error to our ValidationError type.
 func (v *Validator) convertError(err error, phase ValidationPhase) ValidationError {
 	if validationErr, ok := err.(*jsonschema.ValidationError); ok {
@@ -75,15 +144,14 @@ func (v *Validator) convertError(err error, phase ValidationPhase) ValidationErr
 	}
 }
 
-// joinPath joins path segments with /.
+// joinPath joins path segments with /, escaped as JSON pointer tokens.
 func joinPath(segments []string) string {
 	if len(segments) == 0 {
 		return ""
 	}
-	result := segments[0]
+	result := escapePointer(segments[0])
 	for _, s := range segments[1:] {
-		result += "/" + s
+		result = childPath(result, s)
 	}
 	return result
 }
-
@@ -228,25 +228,25 @@ func TestApplyDefaultsSchemaLevel(t *testing.T) {
 			name:     "defaults fill missing fields",
 			a:        `{"name": "test"}`,
 			b:        `{}`,
-			expected: map[string]any{"name": "test", "timeout": float64(30), "retries": float64(3)},
+			expected: map[string]any{"name": "test", "timeout": json.Number("30"), "retries": json.Number("3")},
 		},
 		{
 			name:     "B overrides defaults",
 			a:        `{"name": "test"}`,
 			b:        `{"timeout": 60}`,
-			expected: map[string]any{"name": "test", "timeout": float64(60), "retries": float64(3)},
+			expected: map[string]any{"name": "test", "timeout": json.Number("60"), "retries": json.Number("3")},
 		},
 		{
 			name:     "A overrides B overrides defaults",
 			a:        `{"name": "test", "timeout": 10}`,
 			b:        `{"timeout": 60}`,
-			expected: map[string]any{"name": "test", "timeout": float64(10), "retries": float64(3)},
+			expected: map[string]any{"name": "test", "timeout": json.Number("10"), "retries": json.Number("3")},
 		},
 		{
 			name:     "all from defaults",
 			a:        `{}`,
 			b:        `{}`,
-			expected: map[string]any{"timeout": float64(30), "retries": float64(3)},
+			expected: map[string]any{"timeout": json.Number("30"), "retries": json.Number("3")},
 		},
 	}
 
@@ -310,10 +310,10 @@ func TestApplyDefaultsNestedObjects(t *testing.T) {
 	resultMap := result.(map[string]any)
 	config := resultMap["config"].(map[string]any)
 
-	if config["timeout"] != float64(30) {
+	if config["timeout"] != json.Number("30") {
 		t.Errorf("config.timeout = %v, want 30", config["timeout"])
 	}
-	if config["retries"] != float64(3) {
+	if config["retries"] != json.Number("3") {
 		t.Errorf("config.retries = %v, want 3", config["retries"])
 	}
 
@@ -321,7 +321,7 @@ func TestApplyDefaultsNestedObjects(t *testing.T) {
 	if server["host"] != "localhost" {
 		t.Errorf("config.server.host = %v, want localhost", server["host"])
 	}
-	if server["port"] != float64(9000) {
+	if server["port"] != json.Number("9000") {
 		t.Errorf("config.server.port = %v, want 9000 (A's value)", server["port"])
 	}
 }
@@ -362,7 +362,7 @@ func TestApplyDefaultsMergeOptionsOverride(t *testing.T) {
 		t.Fatalf("MergeToValueWithOptions failed: %v", err)
 	}
 	resultMap = result.(map[string]any)
-	if resultMap["timeout"] != float64(30) {
+	if resultMap["timeout"] != json.Number("30") {
 		t.Errorf("timeout = %v, want 30", resultMap["timeout"])
 	}
 }
@@ -398,11 +398,11 @@ func TestApplyDefaultsWithObjectLevelDefault(t *testing.T) {
 
 	config := defaults["config"].(map[string]any)
 	// timeout: leaf default (30) should override object default (60)
-	if config["timeout"] != float64(30) {
+	if config["timeout"] != json.Number("30") {
 		t.Errorf("default config.timeout = %v, want 30 (leaf wins)", config["timeout"])
 	}
 	// retries: only in leaf defaults
-	if config["retries"] != float64(3) {
+	if config["retries"] != json.Number("3") {
 		t.Errorf("default config.retries = %v, want 3", config["retries"])
 	}
 	// enabled: only in object default, should be preserved
@@ -442,10 +442,10 @@ func TestApplyDefaultsWithRef(t *testing.T) {
 	}
 
 	resultMap := result.(map[string]any)
-	if resultMap["requestTimeout"] != float64(10) {
+	if resultMap["requestTimeout"] != json.Number("10") {
 		t.Errorf("requestTimeout = %v, want 10 (from A)", resultMap["requestTimeout"])
 	}
-	if resultMap["responseTimeout"] != float64(30) {
+	if resultMap["responseTimeout"] != json.Number("30") {
 		t.Errorf("responseTimeout = %v, want 30 (from default)", resultMap["responseTimeout"])
 	}
 }